@@ -1,8 +1,11 @@
 package p9
 
 import (
+	"context"
 	"errors"
 	"net"
+	"slices"
+	"sync"
 	"sync/atomic"
 
 	"github.com/DeedleFake/p9/proto"
@@ -19,16 +22,30 @@ var (
 //
 // A Client must be closed when it is no longer going to be used in
 // order to free up the related resources.
+//
+// If reconnecting has been enabled with SetRedial, the underlying
+// proto.Client is replaced when the client reconnects. The methods of
+// Client always use the current connection, and settings made with
+// SetFlush and SetDisconnectHandler carry over to new connections.
 type Client struct {
-	*proto.Client
-
 	fid uint32
+
+	m          sync.Mutex
+	pc         *proto.Client
+	version    string
+	redial     func() (net.Conn, error)
+	gen        uint64
+	closed     bool
+	msize      uint32
+	versions   []string
+	flush      func(tag uint16) any
+	disconnect func(err error)
 }
 
 // NewClient returns a client that communicates using c. The Client
 // will close c when the Client is closed.
 func NewClient(c net.Conn) *Client {
-	return &Client{Client: proto.NewClient(Proto(), c)}
+	return newClient(proto.NewClient(Proto(), c))
 }
 
 // Dial is a convenience function that dials and creates a client in
@@ -39,7 +56,25 @@ func Dial(network, addr string) (*Client, error) {
 		return nil, err
 	}
 
-	return &Client{Client: pc}, nil
+	return newClient(pc), nil
+}
+
+func newClient(pc *proto.Client) *Client {
+	c := &Client{
+		pc: pc,
+		flush: func(tag uint16) any {
+			return &Tflush{OldTag: tag}
+		},
+	}
+	c.configure(pc)
+	return c
+}
+
+// configure applies the client's settings to a new connection. c.m
+// must be held if c may be in use.
+func (c *Client) configure(pc *proto.Client) {
+	pc.SetFlush(c.flush)
+	pc.SetDisconnectHandler(c.disconnect)
 }
 
 func (c *Client) nextFID() uint32 {
@@ -49,35 +84,134 @@ func (c *Client) nextFID() uint32 {
 // Handshake performs an initial handshake to establish the maximum
 // allowed message size. A handshake must be performed before any
 // other request types may be sent.
-func (c *Client) Handshake(msize uint32) (uint32, error) {
-	rsp, err := c.Send(&Tversion{
-		Msize:   msize,
-		Version: Version,
-	})
+//
+// versions is a list of acceptable versions of the protocol in order
+// of preference, such as VersionDotU and then Version. If it is
+// empty, only Version is requested. The most preferred version is
+// requested first. If the server responds with a different version
+// that is also in the list, that version is used. If the server
+// responds with proto.VersionUnknown, the next version in the list is
+// requested instead. The negotiated version is available from the
+// Version method afterwards.
+//
+// The client supports Version and VersionDotU. Requesting any other
+// version results in ErrUnsupportedVersion.
+func (c *Client) Handshake(msize uint32, versions ...string) (uint32, error) {
+	return c.HandshakeContext(context.Background(), msize, versions...)
+}
+
+// HandshakeContext is like Handshake, but gives up if ctx is
+// cancelled. As version requests can't be flushed, the client should
+// be closed if that happens.
+func (c *Client) HandshakeContext(ctx context.Context, msize uint32, versions ...string) (uint32, error) {
+	if len(versions) == 0 {
+		versions = []string{Version}
+	}
+
+	dialects := clientDialects()
+	for _, v := range versions {
+		if _, ok := dialects[v]; !ok {
+			return 0, ErrUnsupportedVersion
+		}
+	}
+
+	pc, _, err := c.conn(ctx)
 	if err != nil {
 		return 0, err
 	}
 
-	version := rsp.(*Rversion)
-	if version.Version != Version {
-		return 0, ErrUnsupportedVersion
+	version, err := handshake(ctx, pc, msize, versions)
+	if err != nil {
+		return 0, err
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.version = version
+	c.msize = msize
+	c.versions = versions
+
+	return pc.Msize(), nil
+}
+
+// handshake performs a handshake using pc, returning the negotiated
+// version.
+func handshake(ctx context.Context, pc *proto.Client, msize uint32, versions []string) (string, error) {
+	dialects := clientDialects()
+	for _, v := range versions {
+		rsp, err := pc.SendContext(ctx, &Tversion{
+			Msize:   msize,
+			Version: v,
+		})
+		if err != nil {
+			return "", err
+		}
+
+		rversion := rsp.(*Rversion)
+		if rversion.Version == proto.VersionUnknown {
+			continue
+		}
+		if !slices.Contains(versions, rversion.Version) {
+			return "", ErrUnsupportedVersion
+		}
+
+		pc.SetProto(dialects[rversion.Version])
+		pc.SetMsize(rversion.Msize)
+
+		return rversion.Version, nil
 	}
 
-	c.SetMsize(version.Msize)
+	return "", ErrUnsupportedVersion
+}
 
-	return version.Msize, nil
+// clientDialects returns the dialects that the client supports.
+func clientDialects() proto.Dialects {
+	d := Dialects()
+	delete(d, VersionDotL)
+	return d
+}
+
+// Version returns the version of the protocol that was negotiated
+// during the handshake.
+func (c *Client) Version() string {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.version
+}
+
+func (c *Client) dotu() bool {
+	return c.Version() == VersionDotU
 }
 
 // Auth requests an auth file from the server, returning a Remote
 // representing it or an error if one occurred.
+//
+// Auth files can't be restored after reconnecting, so neither they
+// nor files attached using them survive a reconnect.
 func (c *Client) Auth(user, aname string) (*Remote, error) {
+	return c.AuthContext(context.Background(), user, aname)
+}
+
+// AuthContext is like Auth, but flushes the request if ctx is
+// cancelled before it completes.
+func (c *Client) AuthContext(ctx context.Context, user, aname string) (*Remote, error) {
 	fid := c.nextFID()
 
-	rsp, err := c.Send(&Tauth{
+	var msg any = &Tauth{
 		AFID:  fid,
 		Uname: user,
 		Aname: aname,
-	})
+	}
+	if c.dotu() {
+		msg = &TauthDotU{
+			Tauth:  *msg.(*Tauth),
+			NUname: NoUID,
+		}
+	}
+
+	rsp, gen, err := c.send(ctx, nil, false, msg, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -87,6 +221,7 @@ func (c *Client) Auth(user, aname string) (*Remote, error) {
 		client: c,
 		fid:    fid,
 		qid:    rauth.AQID,
+		gen:    gen,
 	}, nil
 }
 
@@ -94,6 +229,12 @@ func (c *Client) Auth(user, aname string) (*Remote, error) {
 // with the given attributes. If no authentication has been done,
 // afile may be nil.
 func (c *Client) Attach(afile *Remote, user, aname string) (*Remote, error) {
+	return c.AttachContext(context.Background(), afile, user, aname)
+}
+
+// AttachContext is like Attach, but flushes the request if ctx is
+// cancelled before it completes.
+func (c *Client) AttachContext(ctx context.Context, afile *Remote, user, aname string) (*Remote, error) {
 	fid := c.nextFID()
 
 	afid := NoFID
@@ -101,20 +242,37 @@ func (c *Client) Attach(afile *Remote, user, aname string) (*Remote, error) {
 		afid = afile.fid
 	}
 
-	rsp, err := c.Send(&Tattach{
-		FID:   fid,
-		AFID:  afid,
-		Uname: user,
-		Aname: aname,
-	})
+	rsp, gen, err := c.send(ctx, afile, afile == nil, c.attachMsg(fid, afid, user, aname), nil)
 	if err != nil {
 		return nil, err
 	}
 	attach := rsp.(*Rattach)
 
-	return &Remote{
+	file := &Remote{
 		client: c,
 		fid:    fid,
 		qid:    attach.QID,
-	}, nil
+		gen:    gen,
+		path:   ".",
+	}
+	if afile == nil {
+		file.attach = &attachParams{user: user, aname: aname}
+	}
+	return file, nil
+}
+
+func (c *Client) attachMsg(fid, afid uint32, user, aname string) any {
+	var msg any = &Tattach{
+		FID:   fid,
+		AFID:  afid,
+		Uname: user,
+		Aname: aname,
+	}
+	if c.dotu() {
+		msg = &TattachDotU{
+			Tattach: *msg.(*Tattach),
+			NUname:  NoUID,
+		}
+	}
+	return msg
 }
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
+	"time"
 
 	"github.com/DeedleFake/p9"
 	"github.com/DeedleFake/p9/internal/util"
@@ -33,6 +35,9 @@ func (cmd *exportCmd) Run(options GlobalOptions, args []string) error {
 		fset.PrintDefaults()
 	}
 	rw := fset.Bool("rw", false, "Make exported FS writable.")
+	escape := fset.Bool("escape", false, "Allow symlinks to be followed outside of the exported directory.")
+	squash := fset.String("squash", "", "Enforce permissions for the users that clients attach as, treating none, root, or all of them as nobody.")
+	timeout := fset.Duration("shutdown", 5*time.Second, "Maximum time to wait for pending requests when interrupted.")
 	err := fset.Parse(args[1:])
 	if err != nil {
 		return util.Errorf("parse flags: %w", err)
@@ -45,7 +50,26 @@ func (cmd *exportCmd) Run(options GlobalOptions, args []string) error {
 		return flag.ErrHelp
 	}
 
-	fs := p9.FileSystem(p9.Dir(args[0]))
+	fs := p9.FileSystem(p9.ConfinedDir(args[0]))
+	if *escape {
+		fs = p9.Dir(args[0])
+	}
+	if *squash != "" {
+		mode, ok := map[string]p9.Squash{
+			"none": p9.NoSquash,
+			"root": p9.RootSquash,
+			"all":  p9.AllSquash,
+		}[*squash]
+		if !ok {
+			return util.Errorf("unknown squash mode: %q", *squash)
+		}
+
+		fs = p9.PermFS{FileSystem: p9.MappedDir{
+			Dir:     p9.Dir(args[0]),
+			Confine: !*escape,
+			Squash:  mode,
+		}}
+	}
 	if !*rw {
 		fs = p9.ReadOnlyFS(fs)
 	}
@@ -54,16 +78,16 @@ func (cmd *exportCmd) Run(options GlobalOptions, args []string) error {
 	if err != nil {
 		return util.Errorf("listen: %w", err)
 	}
-	defer lis.Close()
+
+	srv := &proto.Server{
+		Proto:       p9.Proto(),
+		ConnHandler: p9.FSConnHandler(fs, uint32(options.MSize)),
+	}
 
 	errC := make(chan error, 1)
 	go func() {
-		err = proto.Serve(
-			lis,
-			p9.Proto(),
-			p9.FSConnHandler(fs, uint32(options.MSize)),
-		)
-		if err != nil {
+		err := srv.Serve(lis)
+		if err != proto.ErrServerClosed {
 			errC <- util.Errorf("serve: %w", err)
 		}
 	}()
@@ -76,8 +100,25 @@ func (cmd *exportCmd) Run(options GlobalOptions, args []string) error {
 	case err := <-errC:
 		return err
 	case <-c:
-		return nil
 	}
+
+	// Give pending requests a chance to finish, but don't wait forever.
+	// A second interrupt skips straight to closing everything.
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-c:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err = srv.Shutdown(ctx)
+	if err != nil {
+		srv.Close()
+	}
+	return nil
 }
 
 func init() {
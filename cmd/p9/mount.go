@@ -159,6 +159,27 @@ func (node *fuseNode) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Nod
 	return &fuseNode{n: n, p: p}, nil
 }
 
+func (node *fuseNode) Symlink(ctx context.Context, req *fuse.SymlinkRequest) (fs.Node, error) {
+	p := path.Join(node.p, req.NewName)
+
+	err := node.n.SymlinkContext(ctx, req.Target, p)
+	if err != nil {
+		log.Printf("Error creating symlink: %v", err)
+		return nil, err
+	}
+
+	return &fuseNode{n: node.n, p: p}, nil
+}
+
+func (node *fuseNode) Readlink(ctx context.Context, req *fuse.ReadlinkRequest) (string, error) {
+	target, err := node.n.ReadlinkContext(ctx, node.p)
+	if err != nil {
+		log.Printf("Error reading symlink: %v", err)
+		return "", err
+	}
+	return target, nil
+}
+
 func (node *fuseNode) direntType(m p9.FileMode) fuse.DirentType {
 	switch {
 	case m&p9.ModeDir != 0:
@@ -221,6 +242,11 @@ func (node *fuseNode) Release(ctx context.Context, req *fuse.ReleaseRequest) err
 	return node.n.Close()
 }
 
+var (
+	_ fs.NodeSymlinker  = (*fuseNode)(nil)
+	_ fs.NodeReadlinker = (*fuseNode)(nil)
+)
+
 func init() {
 	RegisterCommand(&mountCmd{})
 }
@@ -108,7 +108,8 @@ func attach(options GlobalOptions, f func(*p9.Remote) error) error {
 	}
 	defer c.Close()
 
-	_, err = c.Handshake(uint32(options.MSize))
+	// 9P2000.u is preferred for its support of symlinks.
+	_, err = c.Handshake(uint32(options.MSize), p9.VersionDotU, p9.Version)
 	if err != nil {
 		return util.Errorf("handshake: %w", err)
 	}
@@ -0,0 +1,356 @@
+package p9
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ConfinedDir is a variant of Dir that confines clients to the
+// directory that it serves. Every element of every path is resolved
+// beneath the directory, so symlinks are only followed if they point
+// to somewhere inside of it. Requests that would escape the directory,
+// such as opening a symlink to an absolute path or to a parent of the
+// directory, fail instead. Symlinks that point outside of the directory
+// can still be created, read, and removed, but not followed.
+//
+// On Linux, paths are resolved by the kernel using openat2 with
+// RESOLVE_BENEATH. Elsewhere, or if openat2 is not available, they are
+// resolved by walking them one element at a time. In both cases, files
+// are opened and created without any window between the resolution of
+// the path and its use. Other operations, such as removing or renaming
+// files, operate on the resolved path and so can be raced by
+// concurrent changes to the directory tree.
+type ConfinedDir string
+
+// errEscape is returned when a path would escape a ConfinedDir.
+var errEscape = errors.New("path escapes from exported directory")
+
+// rel converts p into a path relative to the root of d in the local
+// system's format.
+func (d ConfinedDir) rel(p string) string {
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if p == "" {
+		return "."
+	}
+	return filepath.FromSlash(p)
+}
+
+// resolve resolves p beneath d, returning a path that has no symlinks
+// in it that can be passed to the methods of Dir. If follow is false
+// and the last element of p is a symlink, it is not followed.
+func (d ConfinedDir) resolve(p string, follow bool) (string, error) {
+	rel := d.rel(p)
+	if rel == "." {
+		return "", nil
+	}
+
+	r, err := resolveBeneath(string(d), rel, follow)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(r), nil
+}
+
+// resolveWalk resolves rel beneath root by walking it one element at
+// a time, following symlinks as it goes. It returns the resolved path
+// relative to root. If follow is false, the last element of rel is not
+// followed if it is a symlink. The last element of rel does not need
+// to exist.
+func resolveWalk(root, rel string, follow bool) (string, error) {
+	const maxLinks = 255
+
+	var resolved []string
+	pending := strings.Split(rel, string(filepath.Separator))
+	var links int
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) == 0 {
+				return "", &fs.PathError{Op: "resolve", Path: rel, Err: errEscape}
+			}
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
+
+		if !follow && (len(pending) == 0) {
+			resolved = append(resolved, name)
+			break
+		}
+
+		cur := filepath.Join(append([]string{root}, append(resolved, name)...)...)
+		fi, err := os.Lstat(cur)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && (len(pending) == 0) {
+				resolved = append(resolved, name)
+				break
+			}
+			return "", err
+		}
+		if fi.Mode()&fs.ModeSymlink == 0 {
+			resolved = append(resolved, name)
+			continue
+		}
+
+		links++
+		if links > maxLinks {
+			return "", &fs.PathError{Op: "resolve", Path: rel, Err: errors.New("too many levels of symbolic links")}
+		}
+
+		target, err := os.Readlink(cur)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) || (filepath.VolumeName(target) != "") {
+			return "", &fs.PathError{Op: "resolve", Path: rel, Err: errEscape}
+		}
+		pending = append(strings.Split(target, string(filepath.Separator)), pending...)
+	}
+
+	return filepath.Join(resolved...), nil
+}
+
+// openRoot opens rel beneath root using an os.Root.
+func openRoot(root, rel string, flag int, perm os.FileMode) (*os.File, error) {
+	r, err := os.OpenRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return r.OpenFile(rel, flag, perm)
+}
+
+// Stat implements Attachment.Stat. As with Dir, if p is a symlink, it
+// is not followed.
+func (d ConfinedDir) Stat(p string) (DirEntry, error) {
+	r, err := d.resolve(p, false)
+	if err != nil {
+		return DirEntry{}, err
+	}
+	return Dir(d).Stat(r)
+}
+
+// WriteStat implements Attachment.WriteStat.
+func (d ConfinedDir) WriteStat(p string, changes StatChanges) error {
+	// Most changes follow symlinks, so make sure that the target of
+	// the file is inside of the directory.
+	_, err := d.resolve(p, true)
+	if err != nil {
+		return err
+	}
+
+	r, err := d.resolve(p, false)
+	if err != nil {
+		return err
+	}
+
+	// Renames are done separately so that the new name can be resolved
+	// beneath the directory as well.
+	name, rename := changes.Name()
+	var rn string
+	if rename {
+		if !validName(name) {
+			return &fs.PathError{Op: "wstat", Path: p, Err: fs.ErrInvalid}
+		}
+
+		rn, err = d.resolve(path.Join(path.Dir(path.Clean("/"+p)), name), false)
+		if err != nil {
+			return err
+		}
+		changes.DirEntry.EntryName = ""
+	}
+
+	err = Dir(d).WriteStat(r, changes)
+	if err != nil {
+		return err
+	}
+
+	if rename {
+		return Dir(d).Rename(r, rn)
+	}
+	return nil
+}
+
+// Auth implements FileSystem.Auth.
+func (d ConfinedDir) Auth(user, aname string) (File, error) {
+	return nil, errors.New("auth not supported")
+}
+
+// Attach implements FileSystem.Attach.
+func (d ConfinedDir) Attach(afile File, user, aname string) (Attachment, error) {
+	switch aname {
+	case "", "/":
+		return d, nil
+	}
+
+	return nil, errors.New("unknown attachment")
+}
+
+// Open implements Attachment.Open.
+func (d ConfinedDir) Open(p string, mode uint8) (File, error) {
+	file, err := openBeneath(string(d), d.rel(p), toOSFlags(mode), 0)
+	if err != nil {
+		return nil, err
+	}
+	return &dirFile{File: file}, nil
+}
+
+// Create implements Attachment.Create.
+func (d ConfinedDir) Create(p string, perm FileMode, mode uint8) (File, error) {
+	flag := toOSFlags(mode)
+
+	if perm&ModeDir != 0 {
+		r, err := d.resolve(p, false)
+		if err != nil {
+			return nil, err
+		}
+
+		err = os.Mkdir(Dir(d).path(r), os.FileMode(perm.Perm()))
+		if err != nil {
+			return nil, err
+		}
+
+		// Directories can't be opened with O_CREATE.
+		file, err := openBeneath(string(d), d.rel(p), flag, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &dirFile{File: file}, nil
+	}
+
+	file, err := openBeneath(string(d), d.rel(p), flag|os.O_CREATE, os.FileMode(perm.Perm()))
+	if err != nil {
+		return nil, err
+	}
+	return &dirFile{File: file}, nil
+}
+
+// Remove implements Attachment.Remove.
+func (d ConfinedDir) Remove(p string) error {
+	r, err := d.resolve(p, false)
+	if err != nil {
+		return err
+	}
+	return Dir(d).Remove(r)
+}
+
+// Symlink implements SpecialFS.Symlink. The target is not checked, as
+// the link will not be followed if it points outside of the directory.
+func (d ConfinedDir) Symlink(target, p string) error {
+	r, err := d.resolve(p, false)
+	if err != nil {
+		return err
+	}
+	return Dir(d).Symlink(target, r)
+}
+
+// Link implements SpecialFS.Link.
+func (d ConfinedDir) Link(target, p string) error {
+	rt, err := d.resolve(target, false)
+	if err != nil {
+		return err
+	}
+	r, err := d.resolve(p, false)
+	if err != nil {
+		return err
+	}
+	return Dir(d).Link(rt, r)
+}
+
+// Mknod implements SpecialFS.Mknod.
+func (d ConfinedDir) Mknod(p string, mode os.FileMode, major, minor uint32) error {
+	r, err := d.resolve(p, false)
+	if err != nil {
+		return err
+	}
+	return Dir(d).Mknod(r, mode, major, minor)
+}
+
+// Readlink implements ReadlinkFS.Readlink.
+func (d ConfinedDir) Readlink(p string) (string, error) {
+	r, err := d.resolve(p, false)
+	if err != nil {
+		return "", err
+	}
+	return Dir(d).Readlink(r)
+}
+
+// Rename implements RenameFS.Rename.
+func (d ConfinedDir) Rename(oldpath, newpath string) error {
+	ro, err := d.resolve(oldpath, false)
+	if err != nil {
+		return err
+	}
+	rn, err := d.resolve(newpath, false)
+	if err != nil {
+		return err
+	}
+	return Dir(d).Rename(ro, rn)
+}
+
+// GetAttr implements AttrFS.GetAttr.
+func (d ConfinedDir) GetAttr(p string) (Attr, error) {
+	r, err := d.resolve(p, false)
+	if err != nil {
+		return Attr{}, err
+	}
+	return Dir(d).GetAttr(r)
+}
+
+// GetQID implements QIDFS.GetQID. Symlinks that can't be followed,
+// such as those that point outside of the directory, are given QIDs
+// based on the links themselves so that they can still be walked to.
+func (d ConfinedDir) GetQID(p string) (QID, error) {
+	r, err := d.resolve(p, true)
+	if err != nil {
+		r, lerr := d.resolve(p, false)
+		if lerr != nil {
+			return QID{}, err
+		}
+
+		stat, lerr := Dir(d).Stat(r)
+		if (lerr != nil) || (stat.FileMode&ModeSymlink == 0) {
+			return QID{}, err
+		}
+		return pathQID(p, stat), nil
+	}
+
+	if q, ok := any(Dir(d)).(QIDFS); ok {
+		return q.GetQID(r)
+	}
+
+	stat, err := Dir(d).Stat(r)
+	if err != nil {
+		return QID{}, err
+	}
+	return pathQID(p, stat), nil
+}
+
+// StatFS implements StatFSFS.StatFS.
+func (d ConfinedDir) StatFS(p string) (FSStat, error) {
+	r, err := d.resolve(p, true)
+	if err != nil {
+		return FSStat{}, err
+	}
+
+	if s, ok := any(Dir(d)).(StatFSFS); ok {
+		return s.StatFS(r)
+	}
+	return defaultFSStat, nil
+}
+
+var (
+	_ FileSystem     = ConfinedDir("")
+	_ AttachmentDotL = ConfinedDir("")
+	_ QIDFS          = ConfinedDir("")
+	_ StatFSFS       = ConfinedDir("")
+)
@@ -0,0 +1,120 @@
+package p9
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/sys/unix"
+)
+
+// noOpenat2 is set if openat2 is not available, in which case the
+// portable implementations are used instead.
+var noOpenat2 atomic.Bool
+
+const resolveFlags = unix.RESOLVE_BENEATH | unix.RESOLVE_NO_MAGICLINKS
+
+// openat2 opens rel beneath the directory open as dirfd.
+func openat2(dirfd int, rel string, flag int, perm os.FileMode) (int, error) {
+	how := unix.OpenHow{
+		Flags:   uint64(flag | unix.O_CLOEXEC),
+		Resolve: resolveFlags,
+	}
+	if flag&os.O_CREATE != 0 {
+		how.Mode = uint64(perm.Perm())
+	}
+
+	for {
+		fd, err := unix.Openat2(dirfd, rel, &how)
+		switch err {
+		case nil:
+			return fd, nil
+		case unix.EINTR:
+			continue
+		case unix.EXDEV:
+			return -1, &fs.PathError{Op: "openat2", Path: rel, Err: errEscape}
+		default:
+			return -1, &fs.PathError{Op: "openat2", Path: rel, Err: err}
+		}
+	}
+}
+
+// openRootFD opens root for use with openat2.
+func openRootFD(root string) (int, error) {
+	fd, err := unix.Open(root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, &fs.PathError{Op: "open", Path: root, Err: err}
+	}
+	return fd, nil
+}
+
+func openBeneath(root, rel string, flag int, perm os.FileMode) (*os.File, error) {
+	if noOpenat2.Load() {
+		return openRoot(root, rel, flag, perm)
+	}
+
+	dirfd, err := openRootFD(root)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(dirfd)
+
+	fd, err := openat2(dirfd, rel, flag, perm)
+	if errors.Is(err, unix.ENOSYS) {
+		noOpenat2.Store(true)
+		return openRoot(root, rel, flag, perm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), filepath.Join(root, rel)), nil
+}
+
+func resolveBeneath(root, rel string, follow bool) (string, error) {
+	if noOpenat2.Load() {
+		return resolveWalk(root, rel, follow)
+	}
+
+	dir, name := rel, ""
+	if !follow {
+		dir, name = filepath.Split(rel)
+		if dir == "" {
+			dir = "."
+		}
+	}
+
+	dirfd, err := openRootFD(root)
+	if err != nil {
+		return "", err
+	}
+	defer unix.Close(dirfd)
+
+	fd, err := openat2(dirfd, dir, unix.O_PATH, 0)
+	if errors.Is(err, unix.ENOSYS) {
+		noOpenat2.Store(true)
+		return resolveWalk(root, rel, follow)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer unix.Close(fd)
+
+	// The kernel has already made sure that the path is beneath the
+	// root, so all that's left is to find out where it ended up.
+	real, err1 := os.Readlink("/proc/self/fd/" + strconv.Itoa(fd))
+	rootReal, err2 := os.Readlink("/proc/self/fd/" + strconv.Itoa(dirfd))
+	if (err1 != nil) || (err2 != nil) {
+		// /proc is probably not mounted.
+		return resolveWalk(root, rel, follow)
+	}
+
+	r, err := filepath.Rel(rootReal, real)
+	if (err != nil) || (r == "..") || strings.HasPrefix(r, "../") {
+		return "", &fs.PathError{Op: "resolve", Path: rel, Err: errEscape}
+	}
+	return filepath.Join(r, name), nil
+}
@@ -0,0 +1,13 @@
+package p9_test
+
+import (
+	"testing"
+
+	"github.com/DeedleFake/p9"
+)
+
+func TestConfinedDirFallback(t *testing.T) {
+	defer p9.SetOpenat2(p9.SetOpenat2(false))
+
+	testConfinedDir(t)
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package p9
+
+import "os"
+
+func openBeneath(root, rel string, flag int, perm os.FileMode) (*os.File, error) {
+	return openRoot(root, rel, flag, perm)
+}
+
+func resolveBeneath(root, rel string, follow bool) (string, error) {
+	return resolveWalk(root, rel, follow)
+}
@@ -0,0 +1,166 @@
+package p9_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DeedleFake/p9"
+)
+
+func testConfinedDir(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "root")
+	outside := filepath.Join(tmp, "outside")
+
+	write := func(p, data string) {
+		t.Helper()
+
+		err := os.WriteFile(p, []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	symlink := func(target, p string) {
+		t.Helper()
+
+		err := os.Symlink(target, filepath.Join(root, p))
+		if err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+
+	for _, dir := range []string{root, outside, filepath.Join(root, "sub")} {
+		err := os.Mkdir(dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(root, "inside.txt"), "inside")
+	write(filepath.Join(outside, "secret"), "secret")
+
+	symlink("inside.txt", "link-in")
+	symlink("../inside.txt", "sub/link-up")
+	symlink(filepath.Join("..", "outside", "secret"), "link-out")
+	symlink(filepath.Join(outside, "secret"), "abs-out")
+	symlink(filepath.Join("..", "outside"), "dir-out")
+	symlink("..", "sub/up")
+	symlink(filepath.Join("..", ".."), "sub/upup")
+
+	d := p9.ConfinedDir(root)
+
+	inside := []string{
+		"inside.txt",
+		"link-in",
+		"sub/link-up",
+		"sub/up/inside.txt",
+		"/../inside.txt",
+	}
+	for _, p := range inside {
+		_, err := d.Stat(p)
+		if err != nil {
+			t.Errorf("Stat(%q): %v", p, err)
+		}
+
+		file, err := d.Open(p, p9.OREAD)
+		if err != nil {
+			t.Errorf("Open(%q): %v", p, err)
+			continue
+		}
+		data, err := io.ReadAll(io.NewSectionReader(file, 0, 1024))
+		file.Close()
+		if (err != nil) || (string(data) != "inside") {
+			t.Errorf("Open(%q): read %q, %v", p, data, err)
+		}
+	}
+
+	escapes := []string{
+		"link-out",
+		"abs-out",
+		"dir-out/secret",
+		"sub/upup/outside/secret",
+		"sub/up/link-out",
+	}
+	for _, p := range escapes {
+		// Escaping links can be stated, but not followed.
+		stat, err := d.Stat(p)
+		if (err == nil) && (stat.FileMode&p9.ModeSymlink == 0) {
+			t.Errorf("Stat(%q) followed an escaping link", p)
+		}
+
+		file, err := d.Open(p, p9.OREAD)
+		if err == nil {
+			file.Close()
+			t.Errorf("Open(%q) succeeded", p)
+		}
+	}
+
+	_, err := d.Create("dir-out/new", 0644, p9.OWRITE)
+	if err == nil {
+		t.Error("Create through an escaping link succeeded")
+	}
+	_, err = d.Create("dir-out/newdir", p9.ModeDir|0755, p9.OREAD)
+	if err == nil {
+		t.Error("Create of a directory through an escaping link succeeded")
+	}
+	for _, name := range []string{"new", "newdir"} {
+		_, err := os.Lstat(filepath.Join(outside, name))
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%v was created outside of the directory: %v", name, err)
+		}
+	}
+
+	target, err := d.Readlink("link-out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != filepath.Join("..", "outside", "secret") {
+		t.Errorf("Unexpected link target: %q", target)
+	}
+	err = d.Remove("link-out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(filepath.Join(outside, "secret"))
+	if err != nil {
+		t.Errorf("Removing a link removed its target: %v", err)
+	}
+
+	rename := func(p, name string) error {
+		return d.WriteStat(p, p9.StatChanges{DirEntry: p9.DirEntry{
+			FileMode:  0xFFFFFFFF,
+			ATime:     unsetTime,
+			MTime:     unsetTime,
+			Length:    0xFFFFFFFFFFFFFFFF,
+			EntryName: name,
+			NUID:      p9.NoUID,
+			NGID:      p9.NoUID,
+			NMUID:     p9.NoUID,
+		}})
+	}
+	for _, name := range []string{"../escaped", "..", "sub/escaped"} {
+		err := rename("/inside.txt", name)
+		if err == nil {
+			t.Errorf("Renaming to %q succeeded", name)
+		}
+	}
+	_, err = os.Lstat(filepath.Join(tmp, "escaped"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Rename escaped from the directory: %v", err)
+	}
+	err = rename("/sub/link-up", "renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Lstat(filepath.Join(root, "sub", "renamed"))
+	if err != nil {
+		t.Errorf("Rename within the directory failed: %v", err)
+	}
+}
+
+func TestConfinedDir(t *testing.T) {
+	testConfinedDir(t)
+}
@@ -3,9 +3,11 @@ package p9
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"math"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // Dir is an implementation of FileSystem that serves from the local
@@ -15,20 +17,36 @@ import (
 // Note that Dir does not support authentication, simply returning an
 // error for any attempt to do so. If authentication is necessary,
 // wrap a Dir in an AuthFS instance.
+//
+// The owners and groups of files are mapped to and from names using
+// SystemIDs. To map them differently, use a MappedDir.
+//
+// Symlinks are reported by Stat and Readdir as files with ModeSymlink
+// set and their targets in the Extension field, which is sent to
+// 9P2000.u clients. Opening a symlink, walking through one, or getting
+// its QID follows it, wherever it points, including outside of the
+// directory. To prevent that, use a ConfinedDir.
 type Dir string
 
 func (d Dir) path(p string) string {
 	return filepath.Join(string(d), filepath.FromSlash(p))
 }
 
-// Stat implements Attachment.Stat.
+// Stat implements Attachment.Stat. If p is a symlink, it is not
+// followed.
 func (d Dir) Stat(p string) (DirEntry, error) {
-	fi, err := os.Stat(d.path(p))
+	stat := os.Lstat
+	if d.path(p) == d.path("") {
+		// The root is always followed, as it's what is being served.
+		stat = os.Stat
+	}
+
+	fi, err := stat(d.path(p))
 	if err != nil {
 		return DirEntry{}, err
 	}
 
-	e := infoToEntry(fi)
+	e := linkEntry(d.path(p), fi)
 	if e.EntryName == "." {
 		e.EntryName = ""
 	}
@@ -36,6 +54,30 @@ func (d Dir) Stat(p string) (DirEntry, error) {
 	return e, nil
 }
 
+// linkEntry is like infoToEntry, but also fills in the target of the
+// file at p, if it is a symlink.
+func linkEntry(p string, fi os.FileInfo) DirEntry {
+	e := infoToEntry(fi)
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(p)
+		if err == nil {
+			e.Extension = filepath.ToSlash(target)
+		}
+	}
+	return e
+}
+
+// qidInfo returns information about the file at p for use in its QID.
+// Symlinks are followed unless they are dangling, so that the links
+// themselves can still be walked to.
+func (d Dir) qidInfo(p string) (os.FileInfo, error) {
+	fi, err := os.Stat(d.path(p))
+	if errors.Is(err, fs.ErrNotExist) {
+		return os.Lstat(d.path(p))
+	}
+	return fi, err
+}
+
 // WriteStat implements Attachment.WriteStat.
 func (d Dir) WriteStat(p string, changes StatChanges) error {
 	// TODO: Add support for other values.
@@ -54,17 +96,58 @@ func (d Dir) WriteStat(p string, changes StatChanges) error {
 	atime, ok1 := changes.ATime()
 	mtime, ok2 := changes.MTime()
 	if ok1 || ok2 {
+		// Zero times are left unchanged by os.Chtimes.
+		if !ok1 {
+			atime = time.Time{}
+		}
+		if !ok2 {
+			mtime = time.Time{}
+		}
+
 		err := os.Chtimes(p, atime, mtime)
 		if err != nil {
 			return err
 		}
 	}
 
-	length, ok := changes.Length()
-	if length > math.MaxInt64 {
-		return fmt.Errorf("truncate length too large: %d", length)
+	uid, ok1 := changes.NUID()
+	if name, ok := changes.UID(); ok && !ok1 {
+		id, err := SystemIDs.UID(name)
+		if err != nil {
+			return err
+		}
+		uid, ok1 = id, true
 	}
+	gid, ok2 := changes.NGID()
+	if name, ok := changes.GID(); ok && !ok2 {
+		id, err := SystemIDs.GID(name)
+		if err != nil {
+			return err
+		}
+		gid, ok2 = id, true
+	}
+	if ok1 || ok2 {
+		// -1 leaves the ID unchanged.
+		nuid, ngid := -1, -1
+		if ok1 {
+			nuid = int(uid)
+		}
+		if ok2 {
+			ngid = int(gid)
+		}
+
+		err := os.Lchown(p, nuid, ngid)
+		if err != nil {
+			return err
+		}
+	}
+
+	length, ok := changes.Length()
 	if ok {
+		if length > math.MaxInt64 {
+			return fmt.Errorf("truncate length too large: %d", length)
+		}
+
 		err := os.Truncate(p, int64(length))
 		if err != nil {
 			return err
@@ -111,14 +194,20 @@ func (d Dir) Open(p string, mode uint8) (File, error) {
 func (d Dir) Create(p string, perm FileMode, mode uint8) (File, error) {
 	p = d.path(p)
 
+	flag := toOSFlags(mode)
+
 	if perm&ModeDir != 0 {
 		err := os.Mkdir(p, os.FileMode(perm.Perm()))
 		if err != nil {
 			return nil, err
 		}
-	}
 
-	flag := toOSFlags(mode)
+		// Directories can't be opened with O_CREATE.
+		file, err := os.OpenFile(p, flag, 0)
+		return &dirFile{
+			File: file,
+		}, err
+	}
 
 	file, err := os.OpenFile(p, flag|os.O_CREATE, os.FileMode(perm.Perm()))
 	return &dirFile{
@@ -131,6 +220,39 @@ func (d Dir) Remove(p string) error {
 	return os.Remove(d.path(p))
 }
 
+// Symlink implements SpecialFS.Symlink.
+func (d Dir) Symlink(target, p string) error {
+	return os.Symlink(filepath.FromSlash(target), d.path(p))
+}
+
+// Link implements SpecialFS.Link.
+func (d Dir) Link(target, p string) error {
+	return os.Link(d.path(target), d.path(p))
+}
+
+// Readlink implements ReadlinkFS.Readlink.
+func (d Dir) Readlink(p string) (string, error) {
+	target, err := os.Readlink(d.path(p))
+	return filepath.ToSlash(target), err
+}
+
+// Rename implements RenameFS.Rename.
+func (d Dir) Rename(oldpath, newpath string) error {
+	return os.Rename(d.path(oldpath), d.path(newpath))
+}
+
+// GetAttr implements AttrFS.GetAttr.
+func (d Dir) GetAttr(p string) (Attr, error) {
+	fi, err := os.Lstat(d.path(p))
+	if err != nil {
+		return Attr{}, err
+	}
+
+	return infoToAttr(fi), nil
+}
+
+var _ AttachmentDotL = Dir("")
+
 type dirFile struct {
 	*os.File
 }
@@ -143,11 +265,30 @@ func (f *dirFile) Readdir() ([]DirEntry, error) {
 
 	entries := make([]DirEntry, 0, len(fi))
 	for _, info := range fi {
-		entries = append(entries, infoToEntry(info))
+		entries = append(entries, linkEntry(filepath.Join(f.Name(), info.Name()), info))
 	}
 	return entries, nil
 }
 
+// ReadDirN implements DirReader.
+func (f *dirFile) ReadDirN(n int) ([]DirEntry, error) {
+	dir, err := f.File.ReadDir(n)
+
+	entries := make([]DirEntry, 0, len(dir))
+	for _, d := range dir {
+		info, err := d.Info()
+		if err != nil {
+			// The file was probably removed since the directory was
+			// read.
+			continue
+		}
+		entries = append(entries, linkEntry(filepath.Join(f.Name(), info.Name()), info))
+	}
+	return entries, err
+}
+
+var _ DirReader = (*dirFile)(nil)
+
 // ReadOnlyFS wraps a filesystem implementation with an implementation
 // that rejects any attempts to cause changes to the filesystem with
 // the exception of writing to an authfile.
@@ -165,27 +306,65 @@ func (ro readOnlyFS) Attach(afile File, user, aname string) (Attachment, error)
 		return nil, err
 	}
 
-	return passQIDFS(&readOnlyAttachment{a}, a), nil
+	return &readOnlyAttachment{a}, nil
 }
 
-type qidfsPasser struct {
+type readOnlyAttachment struct {
 	Attachment
-	QIDFS
 }
 
-func passQIDFS(w Attachment, u Attachment) Attachment {
-	if q, ok := u.(QIDFS); ok {
-		return &qidfsPasser{
-			Attachment: w,
-			QIDFS:      q,
-		}
+func (ro readOnlyAttachment) GetQID(path string) (QID, error) {
+	if q, ok := ro.Attachment.(QIDFS); ok {
+		return q.GetQID(path)
 	}
 
-	return w
+	stat, err := ro.Attachment.Stat(path)
+	if err != nil {
+		return QID{}, err
+	}
+	return pathQID(path, stat), nil
 }
 
-type readOnlyAttachment struct {
-	Attachment
+func (ro readOnlyAttachment) GetAttr(path string) (Attr, error) {
+	if a, ok := ro.Attachment.(AttrFS); ok {
+		return a.GetAttr(path)
+	}
+
+	stat, err := ro.Attachment.Stat(path)
+	if err != nil {
+		return Attr{}, err
+	}
+	return attrFromEntry(stat), nil
+}
+
+func (ro readOnlyAttachment) Readlink(path string) (string, error) {
+	if r, ok := ro.Attachment.(ReadlinkFS); ok {
+		return r.Readlink(path)
+	}
+	return "", errors.ErrUnsupported
+}
+
+func (ro readOnlyAttachment) StatFS(path string) (FSStat, error) {
+	if s, ok := ro.Attachment.(StatFSFS); ok {
+		return s.StatFS(path)
+	}
+	return defaultFSStat, nil
+}
+
+func (ro readOnlyAttachment) Symlink(target, path string) error {
+	return errors.New("read-only filesystem")
+}
+
+func (ro readOnlyAttachment) Link(target, path string) error {
+	return errors.New("read-only filesystem")
+}
+
+func (ro readOnlyAttachment) Mknod(path string, mode os.FileMode, major, minor uint32) error {
+	return errors.New("read-only filesystem")
+}
+
+func (ro readOnlyAttachment) Rename(oldpath, newpath string) error {
+	return errors.New("read-only filesystem")
 }
 
 func (ro readOnlyAttachment) WriteStat(path string, changes StatChanges) error {
@@ -242,13 +421,12 @@ func (a AuthFS) Attach(afile File, user, aname string) (Attachment, error) {
 }
 
 func toOSFlags(mode uint8) (flag int) {
-	if mode == 0 { // OREAD is all bits zero.
+	switch mode & 3 {
+	case OREAD, OEXEC:
 		flag |= os.O_RDONLY
-	}
-	if mode&OWRITE != 0 {
+	case OWRITE:
 		flag |= os.O_WRONLY
-	}
-	if mode&ORDWR != 0 {
+	case ORDWR:
 		flag |= os.O_RDWR
 	}
 	if mode&OTRUNC != 0 {
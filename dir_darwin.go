@@ -3,10 +3,10 @@ package p9
 import (
 	"errors"
 	"os"
-	"os/user"
-	"strconv"
 	"syscall"
 	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 func infoToEntry(fi os.FileInfo) DirEntry {
@@ -17,20 +17,14 @@ func infoToEntry(fi os.FileInfo) DirEntry {
 			MTime:     fi.ModTime(),
 			Length:    uint64(fi.Size()),
 			EntryName: fi.Name(),
+			NUID:      NoUID,
+			NGID:      NoUID,
+			NMUID:     NoUID,
 		}
 	}
 
-	var uname string
-	uid, err := user.LookupId(strconv.FormatUint(uint64(sys.Uid), 10))
-	if err == nil {
-		uname = uid.Username
-	}
-
-	var gname string
-	gid, err := user.LookupGroupId(strconv.FormatUint(uint64(sys.Gid), 10))
-	if err == nil {
-		gname = gid.Name
-	}
+	uname, _ := SystemIDs.User(sys.Uid)
+	gname, _ := SystemIDs.Group(sys.Gid)
 
 	return DirEntry{
 		FileMode:  ModeFromOS(fi.Mode()),
@@ -40,11 +34,35 @@ func infoToEntry(fi os.FileInfo) DirEntry {
 		EntryName: fi.Name(),
 		UID:       uname,
 		GID:       gname,
+		NUID:      sys.Uid,
+		NGID:      sys.Gid,
+		NMUID:     NoUID,
+	}
+}
+
+func infoToAttr(fi os.FileInfo) Attr {
+	sys, _ := fi.Sys().(*syscall.Stat_t)
+	if sys == nil {
+		return attrFromEntry(infoToEntry(fi))
+	}
+
+	return Attr{
+		Mode:      fi.Mode(),
+		UID:       sys.Uid,
+		GID:       sys.Gid,
+		NLink:     uint64(sys.Nlink),
+		RDev:      uint64(sys.Rdev),
+		Size:      uint64(sys.Size),
+		BlockSize: uint64(sys.Blksize),
+		Blocks:    uint64(sys.Blocks),
+		ATime:     time.Unix(sys.Atimespec.Unix()),
+		MTime:     time.Unix(sys.Mtimespec.Unix()),
+		CTime:     time.Unix(sys.Ctimespec.Unix()),
 	}
 }
 
 func (d Dir) GetQID(p string) (QID, error) {
-	fi, err := os.Stat(d.path(p))
+	fi, err := d.qidInfo(p)
 	if err != nil {
 		return QID{}, err
 	}
@@ -56,7 +74,30 @@ func (d Dir) GetQID(p string) (QID, error) {
 
 	return QID{
 		Type:    ModeFromOS(fi.Mode()).QIDType(),
-		Version: 0,
-		Path:    sys.Ino,
+		Version: qidVersion(fi.ModTime(), time.Unix(sys.Ctimespec.Unix()), uint64(fi.Size())),
+		Path:    qidPath(uint64(uint32(sys.Dev)), sys.Ino),
 	}, nil
 }
+
+// Mknod implements SpecialFS.Mknod.
+func (d Dir) Mknod(p string, mode os.FileMode, major, minor uint32) error {
+	m := uint32(mode.Perm())
+	switch {
+	case mode&os.ModeCharDevice != 0:
+		m |= unix.S_IFCHR
+	case mode&os.ModeDevice != 0:
+		m |= unix.S_IFBLK
+	case mode&os.ModeNamedPipe != 0:
+		m |= unix.S_IFIFO
+	case mode&os.ModeSocket != 0:
+		m |= unix.S_IFSOCK
+	default:
+		return errors.New("mknod: invalid file type")
+	}
+
+	err := unix.Mknod(d.path(p), m, int(unix.Mkdev(major, minor)))
+	if err != nil {
+		return &os.PathError{Op: "mknod", Path: p, Err: err}
+	}
+	return nil
+}
@@ -3,7 +3,10 @@
 
 package p9
 
-import "os"
+import (
+	"errors"
+	"os"
+)
 
 func infoToEntry(fi os.FileInfo) DirEntry {
 	return DirEntry{
@@ -11,5 +14,18 @@ func infoToEntry(fi os.FileInfo) DirEntry {
 		MTime:     fi.ModTime(),
 		Length:    uint64(fi.Size()),
 		EntryName: fi.Name(),
+		NUID:      NoUID,
+		NGID:      NoUID,
+		NMUID:     NoUID,
 	}
 }
+
+func infoToAttr(fi os.FileInfo) Attr {
+	return attrFromEntry(infoToEntry(fi))
+}
+
+// Mknod implements SpecialFS.Mknod. It is not supported on this
+// platform.
+func (d Dir) Mknod(p string, mode os.FileMode, major, minor uint32) error {
+	return errors.New("mknod not supported")
+}
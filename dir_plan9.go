@@ -15,6 +15,9 @@ func infoToEntry(fi os.FileInfo) DirEntry {
 			MTime:     fi.ModTime(),
 			Length:    uint64(fi.Size()),
 			EntryName: fi.Name(),
+			NUID:      NoUID,
+			NGID:      NoUID,
+			NMUID:     NoUID,
 		}
 	}
 
@@ -27,11 +30,14 @@ func infoToEntry(fi os.FileInfo) DirEntry {
 		UID:       sys.Uid,
 		GID:       sys.Gid,
 		MUID:      sys.Muid,
+		NUID:      NoUID,
+		NGID:      NoUID,
+		NMUID:     NoUID,
 	}
 }
 
 func (d Dir) GetQID(p string) (QID, error) {
-	fi, err := os.Stat(d.path(p))
+	fi, err := d.qidInfo(p)
 	if err != nil {
 		return QID{}, err
 	}
@@ -41,9 +47,21 @@ func (d Dir) GetQID(p string) (QID, error) {
 		return QID{}, errors.New("failed to get QID: FileInfo was not Dir")
 	}
 
+	// Plan 9 already provides QIDs, but their paths are only unique
+	// within a single device.
 	return QID{
-		Type:    sys.Qid.Type,
+		Type:    QIDType(sys.Qid.Type),
 		Version: sys.Qid.Vers,
-		Path:    sys.Qid.Path,
+		Path:    qidPath(uint64(sys.Type)<<32|uint64(sys.Dev), sys.Qid.Path),
 	}, nil
 }
+
+func infoToAttr(fi os.FileInfo) Attr {
+	return attrFromEntry(infoToEntry(fi))
+}
+
+// Mknod implements SpecialFS.Mknod. It is not supported on this
+// platform.
+func (d Dir) Mknod(p string, mode os.FileMode, major, minor uint32) error {
+	return errors.New("mknod not supported")
+}
@@ -1,9 +1,12 @@
 package p9
 
 import (
+	"errors"
 	"os"
 	"syscall"
 	"time"
+
+	"golang.org/x/sys/windows"
 )
 
 func infoToEntry(fi os.FileInfo) DirEntry {
@@ -14,6 +17,9 @@ func infoToEntry(fi os.FileInfo) DirEntry {
 			MTime:     fi.ModTime(),
 			Length:    uint64(fi.Size()),
 			EntryName: fi.Name(),
+			NUID:      NoUID,
+			NGID:      NoUID,
+			NMUID:     NoUID,
 		}
 	}
 
@@ -23,5 +29,63 @@ func infoToEntry(fi os.FileInfo) DirEntry {
 		MTime:     fi.ModTime(),
 		Length:    uint64(fi.Size()),
 		EntryName: fi.Name(),
+		NUID:      NoUID,
+		NGID:      NoUID,
+		NMUID:     NoUID,
 	}
 }
+
+func infoToAttr(fi os.FileInfo) Attr {
+	return attrFromEntry(infoToEntry(fi))
+}
+
+// Mknod implements SpecialFS.Mknod. It is not supported on this
+// platform.
+func (d Dir) Mknod(p string, mode os.FileMode, major, minor uint32) error {
+	return errors.New("mknod not supported")
+}
+
+func (d Dir) GetQID(p string) (QID, error) {
+	fi, err := d.qidInfo(p)
+	if err != nil {
+		return QID{}, err
+	}
+
+	name, err := windows.UTF16PtrFromString(d.path(p))
+	if err != nil {
+		return QID{}, err
+	}
+
+	// Directories can only be opened with FILE_FLAG_BACKUP_SEMANTICS.
+	flags := uint32(windows.FILE_FLAG_BACKUP_SEMANTICS)
+	if fi.Mode()&os.ModeSymlink != 0 {
+		// The link is dangling, so the link itself is used instead.
+		flags |= windows.FILE_FLAG_OPEN_REPARSE_POINT
+	}
+
+	h, err := windows.CreateFile(
+		name,
+		0,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil,
+		windows.OPEN_EXISTING,
+		flags,
+		0,
+	)
+	if err != nil {
+		return QID{}, &os.PathError{Op: "open", Path: p, Err: err}
+	}
+	defer windows.CloseHandle(h)
+
+	var info windows.ByHandleFileInformation
+	err = windows.GetFileInformationByHandle(h, &info)
+	if err != nil {
+		return QID{}, &os.PathError{Op: "getfileinformationbyhandle", Path: p, Err: err}
+	}
+
+	return QID{
+		Type:    ModeFromOS(fi.Mode()).QIDType(),
+		Version: qidVersion(fi.ModTime(), time.Time{}, uint64(fi.Size())),
+		Path:    qidPath(uint64(info.VolumeSerialNumber), uint64(info.FileIndexHigh)<<32|uint64(info.FileIndexLow)),
+	}, nil
+}
@@ -54,10 +54,22 @@
 // the user can provide a filesystem by implementing the FileSystem
 // interface and passing an instance of their implementation to the
 // FSConnHandler function to get a handler to pass to ListenAndServe.
+// For more control, such as graceful shutdown and timeouts, the
+// handler can be used with a proto.Server instead.
 //
 // If the user only wants to serve local files, the Dir type provides
 // a pre-built implementation of FileSystem that does just that.
 // Similarly, the AuthFS type allows the user to add the ability to
 // authenticate to a FileSystem implementation that otherwise has
-// none, such as the aforementioned Dir.
+// none, such as the aforementioned Dir, and the PermFS type enforces
+// the permissions of files for each user that attaches.
+//
+// MemFS, IOFS, and Mux provide FileSystems for serving files kept in
+// memory, the contents of an fs.FS, and synthetic control and status
+// files in the style of Plan 9's services, respectively.
+//
+// Note that the numeric values of the open flags, such as OTRUNC and
+// ORCLOSE, and of some FileMode bits, such as ModeNamedPipe and
+// ModeSetuid, were changed to match the protocol. Their names should
+// be used rather than their values.
 package p9
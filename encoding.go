@@ -2,8 +2,6 @@ package p9
 
 import (
 	"io"
-
-	"github.com/DeedleFake/p9/proto"
 )
 
 // ReadDir decodes a series of directory entries from a reader. It
@@ -14,10 +12,14 @@ import (
 // read pieces of a directory. Wrapping the reader with a bufio.Reader
 // is often sufficient.
 func ReadDir(r io.Reader) ([]DirEntry, error) {
+	return readDir(r, false)
+}
+
+func readDir(r io.Reader, dotu bool) ([]DirEntry, error) {
 	var entries []DirEntry
 	for {
 		var stat Stat
-		err := proto.Read(r, &stat)
+		err := stat.decode(r, dotu)
 		if err != nil {
 			if err == io.EOF {
 				err = nil
@@ -31,8 +33,18 @@ func ReadDir(r io.Reader) ([]DirEntry, error) {
 
 // WriteDir writes a series of directory entries to w.
 func WriteDir(w io.Writer, entries []DirEntry) error {
+	return writeDir(w, entries, false)
+}
+
+func writeDir(w io.Writer, entries []DirEntry, dotu bool) error {
 	for _, entry := range entries {
-		err := proto.Write(w, entry.Stat())
+		stat := entry.Stat()
+		buf, err := stat.encode(dotu)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(buf)
 		if err != nil {
 			return err
 		}
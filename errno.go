@@ -0,0 +1,74 @@
+package p9
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+)
+
+// errno returns the error number to send for err in a 9P2000.u error
+// response. If err does not wrap a system error number, a few common
+// errors are mapped to their Linux error numbers. Otherwise, it
+// returns 0, which tells the client to derive the error from the
+// error string instead.
+func errno(err error) uint32 {
+	if n, ok := sysErrno(err); ok {
+		return n
+	}
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return 2 // ENOENT
+	case errors.Is(err, fs.ErrPermission):
+		return 13 // EACCES
+	case errors.Is(err, fs.ErrExist):
+		return 17 // EEXIST
+	case errors.Is(err, errors.ErrUnsupported):
+		return 95 // EOPNOTSUPP
+	}
+
+	return 0
+}
+
+// errnoIs reports whether the Linux error number n corresponds to
+// target. It is used to match errors received from servers.
+func errnoIs(n uint32, target error) bool {
+	switch target {
+	case fs.ErrNotExist:
+		return n == 2 // ENOENT
+	case fs.ErrPermission:
+		return (n == 1) || (n == 13) // EPERM, EACCES
+	case fs.ErrExist:
+		return n == 17 // EEXIST
+	case errors.ErrUnsupported:
+		return n == 95 // EOPNOTSUPP
+	}
+
+	return false
+}
+
+// enames maps the error messages used for common errors by Plan 9,
+// Go, and Unix-like systems to the errors that they correspond to.
+var enames = map[string]error{
+	"file does not exist":       fs.ErrNotExist,
+	"no such file or directory": fs.ErrNotExist,
+	"permission denied":         fs.ErrPermission,
+	"operation not permitted":   fs.ErrPermission,
+	"file already exists":       fs.ErrExist,
+	"file exists":               fs.ErrExist,
+	"unsupported operation":     errors.ErrUnsupported,
+	"operation not supported":   errors.ErrUnsupported,
+}
+
+// enameIs reports whether the error string ename received from a
+// server corresponds to target. The message is looked up in enames
+// either as is or, if it has the form "op path: message" used by Go
+// and Unix-like systems, without its prefix.
+func enameIs(ename string, target error) bool {
+	if i := strings.LastIndex(ename, ": "); i >= 0 {
+		ename = ename[i+2:]
+	}
+
+	err, ok := enames[ename]
+	return ok && (err == target)
+}
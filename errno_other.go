@@ -0,0 +1,7 @@
+//go:build !unix
+
+package p9
+
+func sysErrno(err error) (uint32, bool) {
+	return 0, false
+}
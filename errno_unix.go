@@ -0,0 +1,16 @@
+//go:build unix
+
+package p9
+
+import (
+	"errors"
+	"syscall"
+)
+
+func sysErrno(err error) (uint32, bool) {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return uint32(errno), true
+	}
+	return 0, false
+}
@@ -0,0 +1,7 @@
+package p9
+
+// SetOpenat2 sets whether or not ConfinedDir uses openat2, returning
+// the previous setting.
+func SetOpenat2(use bool) bool {
+	return !noOpenat2.Swap(!use)
+}
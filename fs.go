@@ -1,12 +1,18 @@
 package p9
 
 import (
-	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"os"
 	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 	"unsafe"
@@ -33,6 +39,20 @@ type FileSystem interface {
 	Attach(afile File, user, aname string) (Attachment, error)
 }
 
+// DialectFS is implemented by FileSystems that want to control which
+// dialects of the protocol they can be served with. The FileSystem's
+// dialects are negotiated with each client as described by
+// proto.Dialects.Negotiate. FileSystems that do not implement
+// DialectFS can be served with any of the dialects returned by
+// Dialects.
+//
+// Only the dialects returned by Dialects are fully understood by the
+// server. Any others are treated as plain 9P2000, but using the
+// message types of the provided Proto.
+type DialectFS interface {
+	Dialects() proto.Dialects
+}
+
 // Attachment is a file hierarchy provided by an FS.
 //
 // All paths passed to the methods of this system begin with the aname
@@ -58,6 +78,11 @@ type Attachment interface {
 
 	// Open opens the file at path in the given mode. If an error is
 	// returned, it will be transmitted to the client.
+	//
+	// The mode is checked against the mode of the file before Open is
+	// called, so directories are never opened for writing and files
+	// without any execute bits set are never opened with OEXEC. If the
+	// mode includes ORCLOSE, Remove is called once the file is closed.
 	Open(path string, mode uint8) (File, error)
 
 	// Create creates and opens a file at path with the given perms and
@@ -85,11 +110,88 @@ type IOUnitFS interface {
 // manually. A QID represents a unique identifier for a given file. In
 // particular, the Path field must be unique for every path, even if
 // the file at that path has been deleted and replaced with a
-// completely new file.
+// completely new file. The Version field should change whenever the
+// file does, as clients may use it to invalidate their caches.
+//
+// If an Attachment does not implement QIDFS, QIDs are generated from
+// the paths of its files. QIDGen may be useful for implementing QIDFS
+// otherwise.
 type QIDFS interface {
 	GetQID(p string) (QID, error)
 }
 
+// RefFS is implemented by Attachments that want to know which files
+// are referenced by FIDs. This allows the lifetime of a file to be
+// tied to whether or not any client can still access it, as is done by
+// SessionDir.
+//
+// Every call to Ref for a path is eventually followed by a matching
+// call to Unref for the same path, even if the connection is lost.
+type RefFS interface {
+	// Ref is called when a FID begins referring to the file at p.
+	Ref(p string)
+
+	// Unref is called when a FID stops referring to the file at p,
+	// such as when it is clunked.
+	Unref(p string)
+}
+
+// UserFS is implemented by Attachments that act as a different user
+// than the one that attached, such as those of a MappedDir that squash
+// users. PermFS checks permissions as the user returned by User rather
+// than the one that attached.
+type UserFS interface {
+	User() string
+}
+
+// SpecialFS is implemented by Attachments that support the creation
+// of special files, such as links and devices, which can not be
+// created via Create. It is used to handle 9P2000.u create requests
+// for such files.
+//
+// Paths passed to the methods of SpecialFS follow the same rules as
+// those passed to Attachment. The target passed to Symlink, however,
+// is passed as given by the client.
+type SpecialFS interface {
+	// Symlink creates a symbolic link at path pointing to target.
+	Symlink(target, path string) error
+
+	// Link creates a hard link at path to the existing file at target.
+	Link(target, path string) error
+
+	// Mknod creates a device, named pipe, or socket at path. The type
+	// of the file to create is given by the type bits of mode. major
+	// and minor are only used for devices.
+	Mknod(path string, mode os.FileMode, major, minor uint32) error
+}
+
+// DirReader is implemented by Files that can read a directory a few
+// entries at a time. If a File implements DirReader, ReadDirN is used
+// instead of Readdir to read it as a directory, so that the directory's
+// entries don't all need to be in memory at once.
+//
+// In order for a directory to be read from the beginning again after
+// some of it has already been read, the File must also implement
+// io.Seeker. It is seeked to the start of the directory when that
+// happens. If it doesn't implement io.Seeker, such reads fail.
+type DirReader interface {
+	// ReadDirN returns up to n entries of the directory, continuing
+	// from where the previous call left off. Once there are no entries
+	// left, it returns io.EOF, possibly along with the last entries.
+	ReadDirN(n int) ([]DirEntry, error)
+}
+
+// DirReaderContext is implemented by DirReaders that want to be able
+// to stop reading a directory early, in the same way as FileContext.
+// If a File implements DirReaderContext, ReadDirNContext is called
+// instead of ReadDirN. The context is also cancelled if the FID that
+// the directory is open for is clunked.
+type DirReaderContext interface {
+	DirReader
+
+	ReadDirNContext(ctx context.Context, n int) ([]DirEntry, error)
+}
+
 // File is the interface implemented by files being dealt with by a
 // FileSystem.
 //
@@ -101,7 +203,9 @@ type File interface {
 	// Used to handle 9P read requests.
 	io.ReaderAt
 
-	// Used to handle 9P write requests.
+	// Used to handle 9P write requests. As required by io.WriterAt,
+	// implementations must not retain the data passed to WriteAt, as
+	// it is reused for later requests.
 	io.WriterAt
 
 	// Used to handle 9P clunk requests.
@@ -114,26 +218,216 @@ type File interface {
 	//
 	// When a client attempts to read a file, if file reports itself as
 	// a QTDir, then this method will be used to read it instead of
-	// ReadAt().
+	// ReadAt(), unless the file implements DirReader.
 	Readdir() ([]DirEntry, error)
 }
 
+// FileContext is implemented by Files that want to be able to stop
+// pending operations early. If a File implements FileContext, the
+// methods of FileContext are called instead of their File
+// equivalents.
+//
+// The contexts passed to its methods behave in the same way as those
+// passed to the methods of FileSystemContext. This is particularly
+// useful for files whose reads block until data becomes
+// available, as otherwise a client has no way of interrupting such a
+// read.
+type FileContext interface {
+	File
+
+	ReadAtContext(ctx context.Context, buf []byte, off int64) (int, error)
+	WriteAtContext(ctx context.Context, data []byte, off int64) (int, error)
+	ReaddirContext(ctx context.Context) ([]DirEntry, error)
+}
+
+// FileSystemContext is implemented by FileSystems that want to know
+// when the requests that they are handling have been abandoned. If a
+// FileSystem implements FileSystemContext, the methods of
+// FileSystemContext are called instead of their FileSystem
+// equivalents.
+//
+// The context passed to each method is cancelled if the client
+// flushes the request, if the connection to the client is closed, or
+// if the server is shut down.
+type FileSystemContext interface {
+	FileSystem
+
+	AuthContext(ctx context.Context, user, aname string) (File, error)
+	AttachContext(ctx context.Context, afile File, user, aname string) (Attachment, error)
+}
+
+// AttachmentContext is implemented by Attachments that want to know
+// when the requests that they are handling have been abandoned. If an
+// Attachment implements AttachmentContext, the methods of
+// AttachmentContext are called instead of their Attachment
+// equivalents.
+//
+// The contexts passed to its methods behave in the same way as those
+// passed to the methods of FileSystemContext.
+type AttachmentContext interface {
+	Attachment
+
+	StatContext(ctx context.Context, path string) (DirEntry, error)
+	WriteStatContext(ctx context.Context, path string, changes StatChanges) error
+	OpenContext(ctx context.Context, path string, mode uint8) (File, error)
+	CreateContext(ctx context.Context, path string, perm FileMode, mode uint8) (File, error)
+	RemoveContext(ctx context.Context, path string) error
+}
+
+// fsWithContext returns fs as a FileSystemContext, wrapping it if it
+// does not implement the interface itself.
+func fsWithContext(fs FileSystem) FileSystemContext {
+	if fs, ok := fs.(FileSystemContext); ok {
+		return fs
+	}
+	return fsContext{fs}
+}
+
+type fsContext struct {
+	FileSystem
+}
+
+func (fs fsContext) AuthContext(ctx context.Context, user, aname string) (File, error) {
+	return fs.Auth(user, aname)
+}
+
+func (fs fsContext) AttachContext(ctx context.Context, afile File, user, aname string) (Attachment, error) {
+	return fs.Attach(afile, user, aname)
+}
+
+// attachmentWithContext returns a as an AttachmentContext, wrapping
+// it if it does not implement the interface itself.
+func attachmentWithContext(a Attachment) AttachmentContext {
+	if a, ok := a.(AttachmentContext); ok {
+		return a
+	}
+	return attachmentContext{a}
+}
+
+type attachmentContext struct {
+	Attachment
+}
+
+func (a attachmentContext) StatContext(ctx context.Context, path string) (DirEntry, error) {
+	return a.Stat(path)
+}
+
+func (a attachmentContext) WriteStatContext(ctx context.Context, path string, changes StatChanges) error {
+	return a.WriteStat(path, changes)
+}
+
+func (a attachmentContext) OpenContext(ctx context.Context, path string, mode uint8) (File, error) {
+	return a.Open(path, mode)
+}
+
+func (a attachmentContext) CreateContext(ctx context.Context, path string, perm FileMode, mode uint8) (File, error) {
+	return a.Create(path, perm, mode)
+}
+
+func (a attachmentContext) RemoveContext(ctx context.Context, path string) error {
+	return a.Remove(path)
+}
+
+// fileWithContext returns file as a FileContext, wrapping it if it
+// does not implement the interface itself.
+func fileWithContext(file File) FileContext {
+	if file, ok := file.(FileContext); ok {
+		return file
+	}
+	return fileContext{file}
+}
+
+type fileContext struct {
+	File
+}
+
+func (file fileContext) ReadAtContext(ctx context.Context, buf []byte, off int64) (int, error) {
+	return file.ReadAt(buf, off)
+}
+
+func (file fileContext) WriteAtContext(ctx context.Context, data []byte, off int64) (int, error) {
+	return file.WriteAt(data, off)
+}
+
+func (file fileContext) ReaddirContext(ctx context.Context) ([]DirEntry, error) {
+	return file.Readdir()
+}
+
 type fsFile struct {
 	sync.RWMutex
 
+	// ctx is canceled when the FID is clunked in order to interrupt
+	// any reads from it that are blocked.
+	ctx    context.Context
+	cancel context.CancelFunc
+
 	path string
 
 	a Attachment
 
 	file File
-	dir  bytes.Buffer
+
+	// The following are used to read the file as a directory. dirents
+	// holds entries that have been read from file but not yet sent,
+	// dirOff is the offset that the next read must be at, dirEOF is
+	// true once file has no entries left, and dirRead is true if any
+	// have been read since file was opened or last rewound. For
+	// 9P2000.L, dirOff is the number of entries sent so far.
+	dirents []DirEntry
+	dirOff  uint64
+	dirEOF  bool
+	dirRead bool
+
+	// rclose is true if the file was opened with ORCLOSE and should
+	// be removed when it is clunked.
+	rclose bool
+}
+
+// refer makes file refer to the file at p in a, notifying a if it
+// implements RefFS. file must be locked for writing.
+func (file *fsFile) refer(a Attachment, p string) {
+	if r, ok := a.(RefFS); ok {
+		r.Ref(p)
+	}
+	file.unref()
+
+	file.a = a
+	file.path = p
+}
+
+// unref notifies the file's Attachment that file no longer refers to
+// its path if the Attachment implements RefFS. file must be locked.
+func (file *fsFile) unref() {
+	if r, ok := file.a.(RefFS); ok {
+		r.Unref(file.path)
+	}
 }
 
 type fsHandler struct {
-	fs    FileSystem
+	fs FileSystem
+
+	// m protects the state negotiated by Tversion. Every other request
+	// holds it for reading while it is handled so that a new
+	// negotiation can wait for them to finish. vm serializes
+	// negotiations.
+	m     sync.RWMutex
+	vm    sync.Mutex
 	msize uint32
+	p     proto.Proto
+	dotu  bool
+	dotl  bool
+
+	// session is the parent of the contexts of all requests. abort
+	// cancels it when the session is reset by a new negotiation.
+	session context.Context
+	abort   context.CancelFunc
 
 	fids sync.Map // map[uint32]*fsFile
+
+	// reads maps Rread responses that have not yet been released to
+	// the pooled buffers that hold their data.
+	rm    sync.Mutex
+	reads map[*Rread]*[]byte
 }
 
 // FSHandler returns a MessageHandler that provides a virtual
@@ -144,13 +438,22 @@ type fsHandler struct {
 // The returned MessageHandler implementation will print debug
 // messages to stderr if the p9debug build tag is set.
 //
-// BUG: Tflush requests are not currently handled at all by this
-// implementation due to no clear method of stopping a pending call to
-// ReadAt or WriteAt.
+// Flushed reads and writes are only interrupted if the File being
+// read from or written to implements FileContext. Otherwise, the
+// pending call is allowed to finish and its result is discarded.
+//
+// A version request resets the session, as required by the protocol.
+// Requests that are in flight are aborted in the same way as flushed
+// ones, and every FID is clunked before the version is negotiated.
 func FSHandler(fs FileSystem, msize uint32) proto.MessageHandler {
+	session, abort := context.WithCancel(context.Background())
 	return &fsHandler{
-		fs:    fs,
-		msize: msize,
+		fs:      fs,
+		msize:   msize,
+		p:       Proto(),
+		session: session,
+		abort:   abort,
+		reads:   make(map[*Rread]*[]byte),
 	}
 }
 
@@ -166,28 +469,46 @@ func FSConnHandler(fs FileSystem, msize uint32) proto.ConnHandler {
 	})
 }
 
-func (h *fsHandler) getQID(p string, attach Attachment) (QID, error) {
+func (h *fsHandler) getQID(ctx context.Context, p string, attach Attachment) (QID, error) {
 	if q, ok := attach.(QIDFS); ok {
 		return q.GetQID(p)
 	}
 
-	stat, err := attach.Stat(p)
+	stat, err := attachmentWithContext(attach).StatContext(ctx, p)
 	if err != nil {
 		return QID{}, err
 	}
 
+	return pathQID(p, stat), nil
+}
+
+// pathQID generates a QID for a file from its path. It is used for
+// Attachments that do not implement QIDFS. Unless stat has a Version
+// of its own, the version is derived from the modification time and
+// length of the file.
+func pathQID(p string, stat DirEntry) QID {
 	sum := sha256.Sum256(unsafe.Slice(unsafe.StringData(p), len(p)))
 	path := binary.LittleEndian.Uint64(sum[:])
 
+	version := stat.Version
+	if version == 0 {
+		version = qidVersion(stat.MTime, time.Time{}, stat.Length)
+	}
+
 	return QID{
-		Type: stat.FileMode.QIDType(),
-		Path: path,
-	}, nil
+		Type:    stat.FileMode.QIDType(),
+		Version: version,
+		Path:    path,
+	}
 }
 
 func (h *fsHandler) getFile(fid uint32, create bool) (*fsFile, bool) {
 	if create {
-		f, ok := h.fids.LoadOrStore(fid, new(fsFile))
+		ctx, cancel := context.WithCancel(context.Background())
+		f, ok := h.fids.LoadOrStore(fid, &fsFile{ctx: ctx, cancel: cancel})
+		if ok {
+			cancel()
+		}
 		return f.(*fsFile), ok
 	}
 
@@ -202,29 +523,105 @@ func (h *fsHandler) largeCount(count uint32) bool {
 	return IOHeaderSize+count > h.msize
 }
 
+// version handles a version request. As it resets the session, any
+// requests that are in flight are aborted and every FID is clunked
+// first.
 func (h *fsHandler) version(msg *Tversion) any {
-	if msg.Version != Version {
-		return &Rerror{
-			Ename: ErrUnsupportedVersion.Error(),
-		}
+	h.vm.Lock()
+	defer h.vm.Unlock()
+
+	h.abort()
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.clunkAll()
+	h.session, h.abort = context.WithCancel(context.Background())
+
+	dialects := Dialects()
+	if d, ok := h.fs.(DialectFS); ok {
+		dialects = d.Dialects()
 	}
 
 	if h.msize > msg.Msize {
 		h.msize = msg.Msize
 	}
 
+	version, p, ok := dialects.Negotiate(msg.Version)
+	if !ok {
+		// An msize of 0 lets the client try again with a different
+		// version.
+		return &Rversion{
+			Version: version,
+		}
+	}
+
+	h.p = p
+	h.dotu = version == VersionDotU
+	h.dotl = version == VersionDotL
+
 	return &Rversion{
 		Msize:   h.msize,
-		Version: Version,
+		Version: version,
 	}
 }
 
-func (h *fsHandler) auth(msg *Tauth) any {
-	file, err := h.fs.Auth(msg.Uname, msg.Aname)
-	if err != nil {
-		return &Rerror{
-			Ename: err.Error(),
+// P9Proto implements proto.Protoer.
+func (h *fsHandler) P9Proto() proto.Proto {
+	h.m.RLock()
+	defer h.m.RUnlock()
+
+	return h.p
+}
+
+// rerror returns an error response for err that is appropriate for
+// the negotiated version.
+func (h *fsHandler) rerror(err error) any {
+	if h.dotu || h.dotl {
+		return &RerrorDotU{
+			Rerror: Rerror{
+				Ename: err.Error(),
+			},
+			Errno: errno(err),
+		}
+	}
+
+	return &Rerror{
+		Ename: err.Error(),
+	}
+}
+
+// dotuResponse converts a response to its 9P2000.u variant, if it has
+// one.
+func dotuResponse(rsp any) any {
+	switch rsp := rsp.(type) {
+	case *Rerror:
+		return &RerrorDotU{
+			Rerror: *rsp,
 		}
+
+	case *Rstat:
+		return &RstatDotU{
+			Stat: rsp.Stat,
+		}
+
+	default:
+		return rsp
+	}
+}
+
+// numericUname returns a user name that can be used for a 9P2000.u
+// request that only specified a numeric user ID.
+func numericUname(uname string, nuname uint32) string {
+	if (uname == "") && (nuname != NoUID) {
+		return strconv.FormatUint(uint64(nuname), 10)
+	}
+	return uname
+}
+
+func (h *fsHandler) auth(ctx context.Context, msg *Tauth) any {
+	file, err := fsWithContext(h.fs).AuthContext(ctx, msg.Uname, msg.Aname)
+	if err != nil {
+		return h.rerror(err)
 	}
 
 	f, _ := h.getFile(msg.AFID, true)
@@ -242,13 +639,12 @@ func (h *fsHandler) auth(msg *Tauth) any {
 }
 
 func (h *fsHandler) flush(msg *Tflush) any {
-	// TODO: Implement this.
-	return &Rerror{
-		Ename: "flush is not supported",
-	}
+	// By the time that this is called, the flushed request has already
+	// been dealt with by the proto package.
+	return &Rflush{}
 }
 
-func (h *fsHandler) attach(msg *Tattach) any {
+func (h *fsHandler) attach(ctx context.Context, msg *Tattach) any {
 	var afile File
 	if msg.AFID != NoFID {
 		tmp, ok := h.getFile(msg.AFID, false)
@@ -263,18 +659,14 @@ func (h *fsHandler) attach(msg *Tattach) any {
 		tmp.RUnlock()
 	}
 
-	attach, err := h.fs.Attach(afile, msg.Uname, msg.Aname)
+	attach, err := fsWithContext(h.fs).AttachContext(ctx, afile, msg.Uname, msg.Aname)
 	if err != nil {
-		return &Rerror{
-			Ename: err.Error(),
-		}
+		return h.rerror(err)
 	}
 
-	qid, err := h.getQID(msg.Aname, attach)
+	qid, err := h.getQID(ctx, msg.Aname, attach)
 	if err != nil {
-		return &Rerror{
-			Ename: err.Error(),
-		}
+		return h.rerror(err)
 	}
 
 	file, ok := h.getFile(msg.FID, true)
@@ -286,15 +678,14 @@ func (h *fsHandler) attach(msg *Tattach) any {
 	file.Lock()
 	defer file.Unlock()
 
-	file.path = msg.Aname
-	file.a = attach
+	file.refer(attach, msg.Aname)
 
 	return &Rattach{
 		QID: qid,
 	}
 }
 
-func (h *fsHandler) walk(msg *Twalk) any {
+func (h *fsHandler) walk(ctx context.Context, msg *Twalk) any {
 	file, ok := h.getFile(msg.FID, false)
 	if !ok {
 		return &Rerror{
@@ -311,12 +702,10 @@ func (h *fsHandler) walk(msg *Twalk) any {
 	for i, name := range msg.Wname {
 		next := path.Join(base, name)
 
-		qid, err := h.getQID(next, a)
+		qid, err := h.getQID(ctx, next, a)
 		if err != nil {
 			if i == 0 {
-				return &Rerror{
-					Ename: err.Error(),
-				}
+				return h.rerror(err)
 			}
 
 			return &Rwalk{
@@ -337,15 +726,31 @@ func (h *fsHandler) walk(msg *Twalk) any {
 	file.Lock()
 	defer file.Unlock()
 
-	file.path = base
-	file.a = a
+	file.refer(a, base)
 
 	return &Rwalk{
 		WQID: qids,
 	}
 }
 
-func (h *fsHandler) open(msg *Topen) any {
+// checkOpenMode checks whether or not a file with the given mode can
+// be opened with the open mode omode.
+func checkOpenMode(mode FileMode, omode uint8) error {
+	if mode&ModeDir != 0 {
+		if (omode&3 != OREAD) || (omode&OTRUNC != 0) {
+			return errors.New("is a directory")
+		}
+		return nil
+	}
+
+	if (omode&3 == OEXEC) && (mode&0111 == 0) {
+		return fs.ErrPermission
+	}
+
+	return nil
+}
+
+func (h *fsHandler) open(ctx context.Context, msg *Topen) any {
 	file, ok := h.getFile(msg.FID, false)
 	if !ok {
 		return &Rerror{
@@ -361,21 +766,29 @@ func (h *fsHandler) open(msg *Topen) any {
 		}
 	}
 
-	f, err := file.a.Open(file.path, msg.Mode)
+	stat, err := attachmentWithContext(file.a).StatContext(ctx, file.path)
 	if err != nil {
-		return &Rerror{
-			Ename: err.Error(),
-		}
+		return h.rerror(err)
+	}
+	err = checkOpenMode(stat.FileMode, msg.Mode)
+	if err != nil {
+		return h.rerror(err)
 	}
-	file.file = f
 
-	qid, err := h.getQID(file.path, file.a)
+	f, err := attachmentWithContext(file.a).OpenContext(ctx, file.path, msg.Mode)
 	if err != nil {
-		return &Rerror{
-			Ename: err.Error(),
-		}
+		return h.rerror(err)
+	}
+
+	qid, err := h.getQID(ctx, file.path, file.a)
+	if err != nil {
+		f.Close()
+		return h.rerror(err)
 	}
 
+	file.file = f
+	file.rclose = msg.Mode&ORCLOSE != 0
+
 	var iounit uint32
 	if unit, ok := file.a.(IOUnitFS); ok {
 		iounit = unit.IOUnit()
@@ -387,7 +800,7 @@ func (h *fsHandler) open(msg *Topen) any {
 	}
 }
 
-func (h *fsHandler) create(msg *Tcreate) any {
+func (h *fsHandler) create(ctx context.Context, msg *Tcreate, ext string) any {
 	file, ok := h.getFile(msg.FID, false)
 	if !ok {
 		return &Rerror{
@@ -405,23 +818,32 @@ func (h *fsHandler) create(msg *Tcreate) any {
 
 	p := path.Join(file.path, msg.Name)
 
-	f, err := file.a.Create(p, msg.Perm, msg.Mode)
+	if h.dotu && (msg.Perm&(ModeSymlink|ModeLink|ModeDevice|ModeNamedPipe|ModeSocket) != 0) {
+		return h.createSpecial(ctx, file, p, msg.Perm, ext)
+	}
+
+	// As in Plan 9, the permissions of a new file don't restrict the
+	// mode that it is opened with by its creator.
+	err := checkOpenMode(msg.Perm&ModeDir, msg.Mode)
 	if err != nil {
-		return &Rerror{
-			Ename: err.Error(),
-		}
+		return h.rerror(err)
 	}
 
-	file.path = p
-	file.file = f
+	f, err := attachmentWithContext(file.a).CreateContext(ctx, p, msg.Perm, msg.Mode)
+	if err != nil {
+		return h.rerror(err)
+	}
 
-	qid, err := h.getQID(p, file.a)
+	qid, err := h.getQID(ctx, p, file.a)
 	if err != nil {
-		return &Rerror{
-			Ename: err.Error(),
-		}
+		f.Close()
+		return h.rerror(err)
 	}
 
+	file.refer(file.a, p)
+	file.file = f
+	file.rclose = msg.Mode&ORCLOSE != 0
+
 	var iounit uint32
 	if unit, ok := file.a.(IOUnitFS); ok {
 		iounit = unit.IOUnit()
@@ -433,27 +855,102 @@ func (h *fsHandler) create(msg *Tcreate) any {
 	}
 }
 
-func (h *fsHandler) read(msg *Tread) any {
+// createSpecial handles the creation of special files for create.
+// file must already be locked.
+func (h *fsHandler) createSpecial(ctx context.Context, file *fsFile, p string, perm FileMode, ext string) any {
+	special, ok := file.a.(SpecialFS)
+	if !ok {
+		return &Rerror{
+			Ename: "special files not supported",
+		}
+	}
+
+	var err error
+	switch {
+	case perm&ModeSymlink != 0:
+		err = special.Symlink(ext, p)
+
+	case perm&ModeLink != 0:
+		fid, perr := strconv.ParseUint(ext, 10, 32)
+		if perr != nil {
+			return &Rerror{
+				Ename: "invalid link extension",
+			}
+		}
+
+		target, ok := h.getFile(uint32(fid), false)
+		if !ok {
+			return &Rerror{
+				Ename: "unknown FID",
+			}
+		}
+		target.RLock()
+		tpath := target.path
+		target.RUnlock()
+
+		err = special.Link(tpath, p)
+
+	case perm&ModeDevice != 0:
+		var t byte
+		var major, minor uint32
+		_, serr := fmt.Sscanf(ext, "%c %d %d", &t, &major, &minor)
+		if (serr != nil) || ((t != 'b') && (t != 'c')) {
+			return &Rerror{
+				Ename: "invalid device extension",
+			}
+		}
+
+		mode := perm.OS()
+		if t == 'c' {
+			mode |= os.ModeCharDevice
+		}
+		err = special.Mknod(p, mode, major, minor)
+
+	default:
+		err = special.Mknod(p, perm.OS(), 0, 0)
+	}
+	if err != nil {
+		return h.rerror(err)
+	}
+
+	file.refer(file.a, p)
+
+	// Some special files, such as dangling symlinks, might not be able
+	// to produce a QID normally.
+	qid, err := h.getQID(ctx, p, file.a)
+	if err != nil {
+		qid = QID{Type: perm.QIDType()}
+	}
+
+	return &Rcreate{
+		QID: qid,
+	}
+}
+
+func (h *fsHandler) read(ctx context.Context, msg *Tread) any {
 	file, ok := h.getFile(msg.FID, false)
 	if !ok {
 		return &Rerror{
 			Ename: "unknown FID",
 		}
 	}
-	file.Lock()
-	defer file.Unlock()
 
-	if file.file == nil {
+	// Reads from files can block indefinitely, such as for streams, so
+	// the lock is only held for as long as is necessary. Otherwise, a
+	// blocked read would prevent the FID from being clunked.
+	file.RLock()
+	f, p, a := file.file, file.path, file.a
+	file.RUnlock()
+
+	if f == nil {
 		return &Rerror{
 			Ename: "file not open",
 		}
 	}
 
-	qid, err := h.getQID(file.path, file.a)
+	qid, err := h.getQID(ctx, p, a)
 	if err != nil {
-		return &Rerror{
-			Ename: err.Error(),
-		}
+		return h.rerror(err)
 	}
 
 	if h.largeCount(msg.Count) {
@@ -462,71 +959,182 @@ func (h *fsHandler) read(msg *Tread) any {
 		}
 	}
 
+	bp := getReadBuffer(msg.Count)
+	buf := *bp
 	var n int
-	buf := make([]byte, msg.Count)
+	if qid.Type&QTDir != 0 {
+		n, err = h.readDir(ctx, file, msg.Offset, buf)
+	} else {
+		n, err = h.readFile(ctx, file, f, msg.Offset, buf)
+	}
+	if err != nil {
+		putReadBuffer(bp)
+		return h.rerror(err)
+	}
 
-	switch {
-	case qid.Type&QTDir != 0:
-		if msg.Offset == 0 {
-			dir, err := file.file.Readdir()
+	// buf is returned to the pool by P9Release once the response has
+	// been sent.
+	rsp := &Rread{
+		Data: buf[:n],
+	}
+	h.rm.Lock()
+	h.reads[rsp] = bp
+	h.rm.Unlock()
+	return rsp
+}
+
+// dirBatch is the number of entries that are read at a time from a
+// File that implements DirReader.
+const dirBatch = 64
+
+// readDir reads the directory represented by file into buf for a
+// Tread. As required by the specification, a read must either be at
+// offset 0, which restarts the read from the beginning of the
+// directory, or directly after the previous read, and each read only
+// returns whole entries.
+func (h *fsHandler) readDir(ctx context.Context, file *fsFile, off uint64, buf []byte) (int, error) {
+	file.Lock()
+	defer file.Unlock()
+
+	if file.file == nil {
+		return 0, errors.New("file not open")
+	}
+
+	switch off {
+	case 0:
+		err := file.rewindDir()
+		if err != nil {
+			return 0, err
+		}
+	case file.dirOff:
+	default:
+		return 0, errors.New("bad offset in directory read")
+	}
+
+	var n int
+	for {
+		if (len(file.dirents) == 0) && !file.dirEOF {
+			err := file.fillDir(ctx)
 			if err != nil {
-				return &Rerror{
-					Ename: err.Error(),
-				}
+				return 0, err
 			}
+		}
+		if len(file.dirents) == 0 {
+			break
+		}
 
-			for i := range dir {
-				qid, err := h.getQID(path.Join(file.path, dir[i].EntryName), file.a)
-				if err != nil {
-					return &Rerror{
-						Ename: err.Error(),
-					}
-				}
+		entry := file.dirents[0]
+		qid, err := h.getQID(ctx, path.Join(file.path, entry.EntryName), file.a)
+		if err != nil {
+			return 0, err
+		}
+		entry.Version = qid.Version
+		entry.Path = qid.Path
 
-				dir[i].Version = qid.Version
-				dir[i].Path = qid.Path
+		stat := entry.Stat()
+		data, err := stat.encode(h.dotu)
+		if err != nil {
+			return 0, err
+		}
+		if n+len(data) > len(buf) {
+			if n == 0 {
+				return 0, errors.New("directory entry too large for read")
 			}
+			break
+		}
+
+		n += copy(buf[n:], data)
+		file.dirents = file.dirents[1:]
+	}
 
-			file.dir.Reset()
-			err = WriteDir(&file.dir, dir)
+	file.dirOff = off + uint64(n)
+	return n, nil
+}
+
+// rewindDir resets file so that its directory is read from the
+// beginning. file must be locked for writing.
+func (file *fsFile) rewindDir() error {
+	if file.dirRead {
+		if _, ok := file.file.(DirReader); ok {
+			s, ok := file.file.(io.Seeker)
+			if !ok {
+				return errors.New("directory can not be reread")
+			}
+			_, err := s.Seek(0, io.SeekStart)
 			if err != nil {
-				return &Rerror{
-					Ename: err.Error(),
-				}
+				return err
 			}
 		}
+	}
 
-		// This technically isn't quite accurate to the 9P specification.
-		// The specification states that all reads of a directory must
-		// either be at offset 0 or at the previous offset plus the length
-		// of the previous read. Instead, this implemenation just ignores
-		// the offset if it's not zero. This is backwards compatible with
-		// the specification, however, so it's probably not really an
-		// issue.
-		tmp, err := file.dir.Read(buf)
-		if (err != nil) && (err != io.EOF) {
-			return &Rerror{
-				Ename: err.Error(),
-			}
+	file.dirents = nil
+	file.dirOff = 0
+	file.dirEOF = false
+	file.dirRead = false
+	return nil
+}
+
+// fillDir reads more entries from the directory open as file into
+// file.dirents. file must be locked for writing. As that blocks other
+// requests for the FID, the read is interrupted if file is clunked.
+func (file *fsFile) fillDir(ctx context.Context) error {
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer context.AfterFunc(file.ctx, cancel)()
+
+	file.dirRead = true
+
+	if r, ok := file.file.(DirReader); ok {
+		var entries []DirEntry
+		if rc, ok := r.(DirReaderContext); ok {
+			entries, err = rc.ReadDirNContext(ctx, dirBatch)
+		} else {
+			entries, err = r.ReadDirN(dirBatch)
+		}
+		if err == io.EOF {
+			err = nil
+			file.dirEOF = true
+		}
+		if err != nil {
+			return err
 		}
-		n = tmp
 
-	default:
-		tmp, err := file.file.ReadAt(buf, int64(msg.Offset))
-		if (err != nil) && (err != io.EOF) {
-			return &Rerror{
-				Ename: err.Error(),
-			}
+		file.dirents = entries
+		if len(entries) == 0 {
+			file.dirEOF = true
 		}
-		n = tmp
+		return nil
 	}
 
-	return &Rread{
-		Data: buf[:n],
+	entries, err := fileWithContext(file.file).ReaddirContext(ctx)
+	if err != nil {
+		return err
 	}
+	file.dirents = entries
+	file.dirEOF = true
+	return nil
 }
 
-func (h *fsHandler) write(msg *Twrite) any {
+// readFile reads from f, the File open for file, into buf for a Tread.
+// The read is interrupted if file is clunked before it finishes.
+func (h *fsHandler) readFile(ctx context.Context, file *fsFile, f File, off uint64, buf []byte) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer context.AfterFunc(file.ctx, cancel)()
+
+	n, err := fileWithContext(f).ReadAtContext(ctx, buf, int64(off))
+	if (err != nil) && (err != io.EOF) {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (h *fsHandler) write(ctx context.Context, msg *Twrite) any {
 	file, ok := h.getFile(msg.FID, false)
 	if !ok {
 		return &Rerror{
@@ -542,11 +1150,9 @@ func (h *fsHandler) write(msg *Twrite) any {
 		}
 	}
 
-	n, err := file.file.WriteAt(msg.Data, int64(msg.Offset))
+	n, err := fileWithContext(file.file).WriteAtContext(ctx, msg.Data, int64(msg.Offset))
 	if err != nil {
-		return &Rerror{
-			Ename: err.Error(),
-		}
+		return h.rerror(err)
 	}
 
 	return &Rwrite{
@@ -554,60 +1160,76 @@ func (h *fsHandler) write(msg *Twrite) any {
 	}
 }
 
-func (h *fsHandler) clunk(msg *Tclunk) any {
-	defer h.fids.Delete(msg.FID)
-
-	file, ok := h.getFile(msg.FID, false)
+func (h *fsHandler) clunk(ctx context.Context, msg *Tclunk) any {
+	v, ok := h.fids.LoadAndDelete(msg.FID)
 	if !ok {
 		return &Rerror{
 			Ename: "unknown FID",
 		}
 	}
+	file := v.(*fsFile)
+	file.cancel()
+
 	file.RLock()
 	defer file.RUnlock()
+	defer file.unref()
+
+	err := file.close(ctx)
+	if err != nil {
+		return h.rerror(err)
+	}
 
+	return &Rclunk{}
+}
+
+// close closes the File open for file, if there is one, and then
+// removes it if it was opened with ORCLOSE. file must be locked.
+func (file *fsFile) close(ctx context.Context) error {
 	if file.file == nil {
-		return &Rclunk{}
+		return nil
 	}
 
 	err := file.file.Close()
-	if err != nil {
-		return &Rerror{
-			Ename: err.Error(),
+	if file.rclose {
+		rerr := attachmentWithContext(file.a).RemoveContext(ctx, file.path)
+		if err == nil {
+			err = rerr
 		}
 	}
-
-	return &Rclunk{}
+	return err
 }
 
-func (h *fsHandler) remove(msg *Tremove) any {
+func (h *fsHandler) remove(ctx context.Context, msg *Tremove) any {
 	file, ok := h.getFile(msg.FID, false)
 	if !ok {
 		return &Rerror{
 			Ename: "unknown FID",
 		}
 	}
-	file.RLock()
-	defer file.RUnlock()
 
-	rsp := h.clunk(&Tclunk{
+	// The file is removed below regardless, so there's no need for the
+	// clunk to remove it, too.
+	file.Lock()
+	p, a := file.path, file.a
+	file.rclose = false
+	file.Unlock()
+
+	rsp := h.clunk(ctx, &Tclunk{
 		FID: msg.FID,
 	})
 	if _, ok := rsp.(error); ok {
 		return rsp
 	}
 
-	err := file.a.Remove(file.path)
+	err := attachmentWithContext(a).RemoveContext(ctx, p)
 	if err != nil {
-		return &Rerror{
-			Ename: err.Error(),
-		}
+		return h.rerror(err)
 	}
 
 	return &Rremove{}
 }
 
-func (h *fsHandler) stat(msg *Tstat) any {
+func (h *fsHandler) stat(ctx context.Context, msg *Tstat) any {
 	file, ok := h.getFile(msg.FID, false)
 	if !ok {
 		return &Rerror{
@@ -617,18 +1239,14 @@ func (h *fsHandler) stat(msg *Tstat) any {
 	file.RLock()
 	defer file.RUnlock()
 
-	stat, err := file.a.Stat(file.path)
+	stat, err := attachmentWithContext(file.a).StatContext(ctx, file.path)
 	if err != nil {
-		return &Rerror{
-			Ename: err.Error(),
-		}
+		return h.rerror(err)
 	}
 
-	qid, err := h.getQID(file.path, file.a)
+	qid, err := h.getQID(ctx, file.path, file.a)
 	if err != nil {
-		return &Rerror{
-			Ename: err.Error(),
-		}
+		return h.rerror(err)
 	}
 	stat.Version = qid.Version
 	stat.Path = qid.Path
@@ -638,7 +1256,17 @@ func (h *fsHandler) stat(msg *Tstat) any {
 	}
 }
 
-func (h *fsHandler) wstat(msg *Twstat) any {
+// validName reports whether or not name can be used as the name of a
+// file within a directory, such as when renaming it.
+func validName(name string) bool {
+	switch name {
+	case "", ".", "..":
+		return false
+	}
+	return !strings.ContainsRune(name, '/') && !strings.ContainsRune(name, filepath.Separator)
+}
+
+func (h *fsHandler) wstat(ctx context.Context, msg *Twstat) any {
 	file, ok := h.getFile(msg.FID, false)
 	if !ok {
 		return &Rerror{
@@ -651,79 +1279,177 @@ func (h *fsHandler) wstat(msg *Twstat) any {
 	changes := StatChanges{
 		DirEntry: msg.Stat.DirEntry(),
 	}
-
-	err := file.a.WriteStat(file.path, changes)
-	if err != nil {
+	if name, ok := changes.Name(); ok && !validName(name) {
 		return &Rerror{
-			Ename: err.Error(),
+			Ename: "invalid file name",
 		}
 	}
 
+	err := attachmentWithContext(file.a).WriteStatContext(ctx, file.path, changes)
+	if err != nil {
+		return h.rerror(err)
+	}
+
 	return &Rwstat{}
 }
 
-func (h *fsHandler) HandleMessage(msg any) (r any) {
+func (h *fsHandler) HandleMessage(msg any) any {
+	return h.HandleMessageContext(context.Background(), msg)
+}
+
+func (h *fsHandler) HandleMessageContext(ctx context.Context, msg any) (r any) {
 	defer func() {
 		debug.Log("%#v\n", r)
 	}()
 
 	debug.Log("%#v\n", msg)
 
-	switch msg := msg.(type) {
-	case *Tversion:
+	if msg, ok := msg.(*Tversion); ok {
 		return h.version(msg)
+	}
 
+	h.m.RLock()
+	defer h.m.RUnlock()
+
+	// Requests are aborted if the session is reset.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(h.session, cancel)
+	defer stop()
+
+	r = h.handle(ctx, msg)
+	switch {
+	case h.dotu:
+		r = dotuResponse(r)
+	case h.dotl:
+		r = dotlResponse(r)
+	}
+	return r
+}
+
+func (h *fsHandler) handle(ctx context.Context, msg any) any {
+	switch msg := msg.(type) {
 	case *Tauth:
-		return h.auth(msg)
+		return h.auth(ctx, msg)
 
 	case *Tflush:
 		return h.flush(msg)
 
+	case *TauthDotU:
+		msg.Uname = numericUname(msg.Uname, msg.NUname)
+		return h.auth(ctx, &msg.Tauth)
+
 	case *Tattach:
-		return h.attach(msg)
+		return h.attach(ctx, msg)
+
+	case *TattachDotU:
+		msg.Uname = numericUname(msg.Uname, msg.NUname)
+		return h.attach(ctx, &msg.Tattach)
 
 	case *Twalk:
-		return h.walk(msg)
+		return h.walk(ctx, msg)
 
 	case *Topen:
-		return h.open(msg)
+		return h.open(ctx, msg)
 
 	case *Tcreate:
-		return h.create(msg)
+		return h.create(ctx, msg, "")
+
+	case *TcreateDotU:
+		return h.create(ctx, &msg.Tcreate, msg.Extension)
 
 	case *Tread:
-		return h.read(msg)
+		return h.read(ctx, msg)
 
 	case *Twrite:
-		return h.write(msg)
+		return h.write(ctx, msg)
 
 	case *Tclunk:
-		return h.clunk(msg)
+		return h.clunk(ctx, msg)
 
 	case *Tremove:
-		return h.remove(msg)
+		return h.remove(ctx, msg)
 
 	case *Tstat:
-		return h.stat(msg)
+		return h.stat(ctx, msg)
 
 	case *Twstat:
-		return h.wstat(msg)
+		return h.wstat(ctx, msg)
+
+	case *TwstatDotU:
+		return h.wstat(ctx, &Twstat{
+			FID:  msg.FID,
+			Stat: msg.Stat,
+		})
 
 	default:
+		if h.dotl {
+			if r := h.handleDotL(ctx, msg); r != nil {
+				return r
+			}
+		}
+
 		return &Rerror{
 			Ename: fmt.Sprintf("unexpected message type: %T", msg),
 		}
 	}
 }
 
+// readBuffers holds the buffers used for the data of Rread
+// responses.
+var readBuffers sync.Pool
+
+func getReadBuffer(size uint32) *[]byte {
+	if bp, ok := readBuffers.Get().(*[]byte); ok && (uint32(cap(*bp)) >= size) {
+		*bp = (*bp)[:size]
+		return bp
+	}
+
+	buf := make([]byte, size)
+	return &buf
+}
+
+func putReadBuffer(bp *[]byte) {
+	readBuffers.Put(bp)
+}
+
+// P9Release implements proto.Releaser.
+func (h *fsHandler) P9Release(msg any) {
+	read, ok := msg.(*Rread)
+	if !ok {
+		return
+	}
+
+	h.rm.Lock()
+	bp, ok := h.reads[read]
+	delete(h.reads, read)
+	h.rm.Unlock()
+
+	if ok {
+		putReadBuffer(bp)
+	}
+}
+
 func (h *fsHandler) Close() error {
+	h.clunkAll()
+	return nil
+}
+
+// clunkAll clunks every FID.
+func (h *fsHandler) clunkAll() {
 	h.fids.Range(func(k, v any) bool {
-		file := v.(*fsFile)
-		if file.file != nil {
-			file.file.Close()
+		if _, ok := h.fids.LoadAndDelete(k); !ok {
+			return true
 		}
+
+		file := v.(*fsFile)
+		file.cancel()
+
+		file.RLock()
+		defer file.RUnlock()
+
+		file.close(context.Background())
+		file.unref()
 		return true
 	})
-
-	return nil
 }
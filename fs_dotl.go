@@ -0,0 +1,858 @@
+package p9
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path"
+	"time"
+
+	"github.com/DeedleFake/p9/proto"
+)
+
+// AttrFS is implemented by Attachments that can provide more detailed
+// information about files than Stat does. It is used to handle
+// 9P2000.L getattr requests. If an Attachment does not implement
+// AttrFS, the information is derived from Stat instead.
+type AttrFS interface {
+	GetAttr(path string) (Attr, error)
+}
+
+// ReadlinkFS is implemented by Attachments that can read the targets
+// of symlinks.
+type ReadlinkFS interface {
+	Readlink(path string) (string, error)
+}
+
+// RenameFS is implemented by Attachments that can move files between
+// directories. If an Attachment does not implement RenameFS, renames
+// within a single directory are done via WriteStat and all others
+// fail.
+type RenameFS interface {
+	Rename(oldpath, newpath string) error
+}
+
+// StatFSFS is implemented by Attachments that can report information
+// about the filesystem as a whole.
+type StatFSFS interface {
+	StatFS(path string) (FSStat, error)
+}
+
+// AttachmentDotL is the full set of interfaces that an Attachment
+// needs to implement in order to support every 9P2000.L request.
+// Attachments that do not implement all of them can still be served
+// using 9P2000.L, but requests that require the missing methods will
+// fail.
+type AttachmentDotL interface {
+	Attachment
+	AttrFS
+	ReadlinkFS
+	RenameFS
+	SpecialFS
+}
+
+// Attr holds the attributes of a file as used by 9P2000.L.
+type Attr struct {
+	Mode      os.FileMode
+	UID       uint32
+	GID       uint32
+	NLink     uint64
+	RDev      uint64
+	Size      uint64
+	BlockSize uint64
+	Blocks    uint64
+	ATime     time.Time
+	MTime     time.Time
+	CTime     time.Time
+}
+
+func attrFromEntry(e DirEntry) Attr {
+	return Attr{
+		Mode:      e.FileMode.OS(),
+		UID:       e.NUID,
+		GID:       e.NGID,
+		NLink:     1,
+		Size:      e.Length,
+		BlockSize: 4096,
+		Blocks:    (e.Length + 511) / 512,
+		ATime:     e.ATime,
+		MTime:     e.MTime,
+		CTime:     e.MTime,
+	}
+}
+
+// FSStat holds information about a filesystem as used by 9P2000.L.
+type FSStat struct {
+	Type        uint32
+	BlockSize   uint32
+	Blocks      uint64
+	BlocksFree  uint64
+	BlocksAvail uint64
+	Files       uint64
+	FilesFree   uint64
+	FSID        uint64
+	NameLen     uint32
+}
+
+// defaultFSStat is reported for Attachments that do not implement
+// StatFSFS.
+var defaultFSStat = FSStat{
+	BlockSize: 4096,
+	NameLen:   255,
+}
+
+// Linux constants used by 9P2000.L.
+const (
+	linuxOAccMode = 03
+	linuxOTrunc   = 01000
+
+	linuxSIFMT   = 0170000
+	linuxSIFSOCK = 0140000
+	linuxSIFLNK  = 0120000
+	linuxSIFREG  = 0100000
+	linuxSIFBLK  = 0060000
+	linuxSIFDIR  = 0040000
+	linuxSIFCHR  = 0020000
+	linuxSIFIFO  = 0010000
+	linuxSISUID  = 04000
+	linuxSISGID  = 02000
+	linuxSISVTX  = 01000
+
+	linuxEIO = 5
+
+	getattrBasic = 0x7ff
+
+	setattrMode     = 0x1
+	setattrUID      = 0x2
+	setattrGID      = 0x4
+	setattrSize     = 0x8
+	setattrATime    = 0x10
+	setattrMTime    = 0x20
+	setattrATimeSet = 0x80
+	setattrMTimeSet = 0x100
+
+	lockSuccess = 0
+	lockUnlock  = 2
+)
+
+func modeFromLinuxFlags(flags uint32) uint8 {
+	mode := uint8(flags & linuxOAccMode)
+	if flags&linuxOTrunc != 0 {
+		mode |= OTRUNC
+	}
+	return mode
+}
+
+func linuxMode(m os.FileMode) uint32 {
+	r := uint32(m.Perm())
+	if m&os.ModeSetuid != 0 {
+		r |= linuxSISUID
+	}
+	if m&os.ModeSetgid != 0 {
+		r |= linuxSISGID
+	}
+	if m&os.ModeSticky != 0 {
+		r |= linuxSISVTX
+	}
+
+	switch {
+	case m&os.ModeDir != 0:
+		r |= linuxSIFDIR
+	case m&os.ModeSymlink != 0:
+		r |= linuxSIFLNK
+	case m&os.ModeCharDevice != 0:
+		r |= linuxSIFCHR
+	case m&os.ModeDevice != 0:
+		r |= linuxSIFBLK
+	case m&os.ModeNamedPipe != 0:
+		r |= linuxSIFIFO
+	case m&os.ModeSocket != 0:
+		r |= linuxSIFSOCK
+	default:
+		r |= linuxSIFREG
+	}
+
+	return r
+}
+
+func modeFromLinux(m uint32) os.FileMode {
+	r := os.FileMode(m & 0777)
+	if m&linuxSISUID != 0 {
+		r |= os.ModeSetuid
+	}
+	if m&linuxSISGID != 0 {
+		r |= os.ModeSetgid
+	}
+	if m&linuxSISVTX != 0 {
+		r |= os.ModeSticky
+	}
+
+	switch m & linuxSIFMT {
+	case linuxSIFDIR:
+		r |= os.ModeDir
+	case linuxSIFLNK:
+		r |= os.ModeSymlink
+	case linuxSIFCHR:
+		r |= os.ModeDevice | os.ModeCharDevice
+	case linuxSIFBLK:
+		r |= os.ModeDevice
+	case linuxSIFIFO:
+		r |= os.ModeNamedPipe
+	case linuxSIFSOCK:
+		r |= os.ModeSocket
+	}
+
+	return r
+}
+
+// linuxTime splits t into seconds and nanoseconds, treating the zero
+// time as the epoch.
+func linuxTime(t time.Time) (sec, nsec uint64) {
+	if t.IsZero() {
+		return 0, 0
+	}
+	return uint64(t.Unix()), uint64(t.Nanosecond())
+}
+
+// noChanges returns a DirEntry that, when used in a StatChanges,
+// indicates that nothing should be changed.
+func noChanges() DirEntry {
+	return DirEntry{
+		FileMode: 0xFFFFFFFF,
+		ATime:    time.Unix(-1, 0),
+		MTime:    time.Unix(-1, 0),
+		Length:   math.MaxUint64,
+		NUID:     NoUID,
+		NGID:     NoUID,
+		NMUID:    NoUID,
+	}
+}
+
+// dotlResponse converts a response to its 9P2000.L variant, if it has
+// one.
+func dotlResponse(rsp any) any {
+	switch rsp := rsp.(type) {
+	case *Rerror:
+		return rlerror(rsp)
+
+	case *RerrorDotU:
+		if rsp.Errno == 0 {
+			return rlerror(&rsp.Rerror)
+		}
+		return &Rlerror{
+			Ecode: rsp.Errno,
+		}
+
+	default:
+		return rsp
+	}
+}
+
+// rlerror returns a 9P2000.L error response for err. Common errors,
+// such as fs.ErrNotExist, are mapped to their Linux error numbers and
+// anything else is sent as EIO.
+func rlerror(err error) *Rlerror {
+	n := errno(err)
+	if n == 0 {
+		n = linuxEIO
+	}
+	return &Rlerror{
+		Ecode: n,
+	}
+}
+
+// getPath returns the path and Attachment of the file identified by
+// fid, or an error response.
+func (h *fsHandler) getPath(fid uint32) (string, Attachment, any) {
+	file, ok := h.getFile(fid, false)
+	if !ok {
+		return "", nil, &Rerror{
+			Ename: "unknown FID",
+		}
+	}
+	file.RLock()
+	defer file.RUnlock()
+
+	return file.path, file.a, nil
+}
+
+// movePaths updates the paths of all FIDs that refer to oldpath or to
+// files inside of it after a rename.
+func (h *fsHandler) movePaths(oldpath, newpath string) {
+	h.fids.Range(func(k, v any) bool {
+		file := v.(*fsFile)
+		file.Lock()
+		defer file.Unlock()
+
+		switch {
+		case file.path == oldpath:
+			file.refer(file.a, newpath)
+		case (len(file.path) > len(oldpath)) && (file.path[:len(oldpath)+1] == oldpath+"/"):
+			file.refer(file.a, newpath+file.path[len(oldpath):])
+		}
+		return true
+	})
+}
+
+func (h *fsHandler) rename(ctx context.Context, a Attachment, oldpath, newpath string) error {
+	if r, ok := a.(RenameFS); ok {
+		return r.Rename(oldpath, newpath)
+	}
+
+	if path.Dir(oldpath) != path.Dir(newpath) {
+		return errors.ErrUnsupported
+	}
+
+	changes := noChanges()
+	changes.EntryName = path.Base(newpath)
+	return attachmentWithContext(a).WriteStatContext(ctx, oldpath, StatChanges{DirEntry: changes})
+}
+
+// specialQID returns the QID of a newly created special file. Some
+// special files, such as dangling symlinks, might not be able to
+// produce a QID normally.
+func (h *fsHandler) specialQID(ctx context.Context, p string, a Attachment, mode os.FileMode) QID {
+	qid, err := h.getQID(ctx, p, a)
+	if err != nil {
+		return QID{Type: ModeFromOS(mode).QIDType()}
+	}
+	return qid
+}
+
+func (h *fsHandler) statfs(ctx context.Context, msg *Tstatfs) any {
+	p, a, rsp := h.getPath(msg.FID)
+	if rsp != nil {
+		return rsp
+	}
+
+	stat := defaultFSStat
+	if s, ok := a.(StatFSFS); ok {
+		tmp, err := s.StatFS(p)
+		if err != nil {
+			return h.rerror(err)
+		}
+		stat = tmp
+	}
+
+	return &Rstatfs{
+		Type:    stat.Type,
+		BSize:   stat.BlockSize,
+		Blocks:  stat.Blocks,
+		BFree:   stat.BlocksFree,
+		BAvail:  stat.BlocksAvail,
+		Files:   stat.Files,
+		FFree:   stat.FilesFree,
+		FSID:    stat.FSID,
+		NameLen: stat.NameLen,
+	}
+}
+
+func (h *fsHandler) lopen(ctx context.Context, msg *Tlopen) any {
+	rsp := h.open(ctx, &Topen{
+		FID:  msg.FID,
+		Mode: modeFromLinuxFlags(msg.Flags),
+	})
+	if open, ok := rsp.(*Ropen); ok {
+		return &Rlopen{
+			QID:    open.QID,
+			IOUnit: open.IOUnit,
+		}
+	}
+	return rsp
+}
+
+func (h *fsHandler) lcreate(ctx context.Context, msg *Tlcreate) any {
+	rsp := h.create(ctx, &Tcreate{
+		FID:  msg.FID,
+		Name: msg.Name,
+		Perm: ModeFromOS(modeFromLinux(msg.Mode)).Perm(),
+		Mode: modeFromLinuxFlags(msg.Flags),
+	}, "")
+	if create, ok := rsp.(*Rcreate); ok {
+		return &Rlcreate{
+			QID:    create.QID,
+			IOUnit: create.IOUnit,
+		}
+	}
+	return rsp
+}
+
+func (h *fsHandler) symlink(ctx context.Context, msg *Tsymlink) any {
+	dir, a, rsp := h.getPath(msg.FID)
+	if rsp != nil {
+		return rsp
+	}
+
+	special, ok := a.(SpecialFS)
+	if !ok {
+		return h.rerror(errors.ErrUnsupported)
+	}
+
+	p := path.Join(dir, msg.Name)
+	err := special.Symlink(msg.Target, p)
+	if err != nil {
+		return h.rerror(err)
+	}
+
+	return &Rsymlink{
+		QID: h.specialQID(ctx, p, a, os.ModeSymlink),
+	}
+}
+
+func (h *fsHandler) mknod(ctx context.Context, msg *Tmknod) any {
+	dir, a, rsp := h.getPath(msg.DFID)
+	if rsp != nil {
+		return rsp
+	}
+
+	special, ok := a.(SpecialFS)
+	if !ok {
+		return h.rerror(errors.ErrUnsupported)
+	}
+
+	p := path.Join(dir, msg.Name)
+	mode := modeFromLinux(msg.Mode)
+	err := special.Mknod(p, mode, msg.Major, msg.Minor)
+	if err != nil {
+		return h.rerror(err)
+	}
+
+	return &Rmknod{
+		QID: h.specialQID(ctx, p, a, mode),
+	}
+}
+
+func (h *fsHandler) renameFID(ctx context.Context, msg *Trename) any {
+	oldpath, a, rsp := h.getPath(msg.FID)
+	if rsp != nil {
+		return rsp
+	}
+
+	dir, _, rsp := h.getPath(msg.DFID)
+	if rsp != nil {
+		return rsp
+	}
+
+	newpath := path.Join(dir, msg.Name)
+	err := h.rename(ctx, a, oldpath, newpath)
+	if err != nil {
+		return h.rerror(err)
+	}
+	h.movePaths(oldpath, newpath)
+
+	return &Rrename{}
+}
+
+func (h *fsHandler) readlink(ctx context.Context, msg *Treadlink) any {
+	p, a, rsp := h.getPath(msg.FID)
+	if rsp != nil {
+		return rsp
+	}
+
+	r, ok := a.(ReadlinkFS)
+	if !ok {
+		return h.rerror(errors.ErrUnsupported)
+	}
+
+	target, err := r.Readlink(p)
+	if err != nil {
+		return h.rerror(err)
+	}
+
+	return &Rreadlink{
+		Target: target,
+	}
+}
+
+func (h *fsHandler) getattr(ctx context.Context, msg *Tgetattr) any {
+	p, a, rsp := h.getPath(msg.FID)
+	if rsp != nil {
+		return rsp
+	}
+
+	var attr Attr
+	if af, ok := a.(AttrFS); ok {
+		tmp, err := af.GetAttr(p)
+		if err != nil {
+			return h.rerror(err)
+		}
+		attr = tmp
+	} else {
+		stat, err := attachmentWithContext(a).StatContext(ctx, p)
+		if err != nil {
+			return h.rerror(err)
+		}
+		attr = attrFromEntry(stat)
+	}
+
+	qid, err := h.getQID(ctx, p, a)
+	if err != nil {
+		return h.rerror(err)
+	}
+
+	r := Rgetattr{
+		Valid:   getattrBasic,
+		QID:     qid,
+		Mode:    linuxMode(attr.Mode),
+		UID:     attr.UID,
+		GID:     attr.GID,
+		NLink:   attr.NLink,
+		RDev:    attr.RDev,
+		Size:    attr.Size,
+		BlkSize: attr.BlockSize,
+		Blocks:  attr.Blocks,
+	}
+	r.ATimeSec, r.ATimeNSec = linuxTime(attr.ATime)
+	r.MTimeSec, r.MTimeNSec = linuxTime(attr.MTime)
+	r.CTimeSec, r.CTimeNSec = linuxTime(attr.CTime)
+
+	return &r
+}
+
+func (h *fsHandler) setattr(ctx context.Context, msg *Tsetattr) any {
+	p, a, rsp := h.getPath(msg.FID)
+	if rsp != nil {
+		return rsp
+	}
+
+	changes := noChanges()
+	if msg.Valid&setattrMode != 0 {
+		changes.FileMode = ModeFromOS(modeFromLinux(msg.Mode &^ linuxSIFMT))
+	}
+	if msg.Valid&setattrUID != 0 {
+		changes.NUID = msg.UID
+	}
+	if msg.Valid&setattrGID != 0 {
+		changes.NGID = msg.GID
+	}
+	if msg.Valid&setattrSize != 0 {
+		changes.Length = msg.Size
+	}
+	if msg.Valid&setattrATime != 0 {
+		changes.ATime = time.Now()
+		if msg.Valid&setattrATimeSet != 0 {
+			changes.ATime = time.Unix(int64(msg.ATimeSec), int64(msg.ATimeNSec))
+		}
+	}
+	if msg.Valid&setattrMTime != 0 {
+		changes.MTime = time.Now()
+		if msg.Valid&setattrMTimeSet != 0 {
+			changes.MTime = time.Unix(int64(msg.MTimeSec), int64(msg.MTimeNSec))
+		}
+	}
+
+	err := attachmentWithContext(a).WriteStatContext(ctx, p, StatChanges{DirEntry: changes})
+	if err != nil {
+		return h.rerror(err)
+	}
+
+	return &Rsetattr{}
+}
+
+func (h *fsHandler) xattrwalk(ctx context.Context, msg *Txattrwalk) any {
+	return h.rerror(errors.ErrUnsupported)
+}
+
+func (h *fsHandler) xattrcreate(ctx context.Context, msg *Txattrcreate) any {
+	return h.rerror(errors.ErrUnsupported)
+}
+
+func (h *fsHandler) readdirDotL(ctx context.Context, msg *Treaddir) any {
+	file, ok := h.getFile(msg.FID, false)
+	if !ok {
+		return &Rerror{
+			Ename: "unknown FID",
+		}
+	}
+	file.Lock()
+	defer file.Unlock()
+
+	if file.file == nil {
+		return &Rerror{
+			Ename: "file not open",
+		}
+	}
+
+	if h.largeCount(msg.Count) {
+		return &Rerror{
+			Ename: "read too large",
+		}
+	}
+
+	// Offsets are the number of entries that precede an entry. As
+	// with 9P2000 directory reads, a read must either restart at the
+	// beginning or continue from where the previous one stopped.
+	switch msg.Offset {
+	case 0:
+		err := file.rewindDir()
+		if err != nil {
+			return h.rerror(err)
+		}
+	case file.dirOff:
+	default:
+		return &Rerror{
+			Ename: "bad offset in directory read",
+		}
+	}
+
+	var buf bytes.Buffer
+	for {
+		if (len(file.dirents) == 0) && !file.dirEOF {
+			err := file.fillDir(ctx)
+			if err != nil {
+				return h.rerror(err)
+			}
+		}
+		if len(file.dirents) == 0 {
+			break
+		}
+
+		entry := file.dirents[0]
+		if qid, err := h.getQID(ctx, path.Join(file.path, entry.EntryName), file.a); err == nil {
+			entry.Version = qid.Version
+			entry.Path = qid.Path
+		}
+
+		dirent := direntDotL{
+			QID: QID{
+				Type:    entry.FileMode.QIDType(),
+				Version: entry.Version,
+				Path:    entry.Path,
+			},
+			Offset: file.dirOff + 1,
+			Type:   direntType(entry.FileMode.OS()),
+			Name:   entry.EntryName,
+		}
+
+		size, err := proto.Size(dirent)
+		if err != nil {
+			return h.rerror(err)
+		}
+		if uint32(buf.Len())+size > msg.Count {
+			if buf.Len() == 0 {
+				return &Rerror{
+					Ename: "directory entry too large for read",
+				}
+			}
+			break
+		}
+
+		err = proto.Write(&buf, dirent)
+		if err != nil {
+			return h.rerror(err)
+		}
+		file.dirents = file.dirents[1:]
+		file.dirOff++
+	}
+
+	return &Rreaddir{
+		Data: buf.Bytes(),
+	}
+}
+
+// direntDotL is a single entry in the data of an Rreaddir.
+type direntDotL struct {
+	QID    QID
+	Offset uint64
+	Type   uint8
+	Name   string
+}
+
+// direntType returns the Linux directory entry type for a file mode.
+func direntType(m os.FileMode) uint8 {
+	switch {
+	case m&os.ModeDir != 0:
+		return 4
+	case m&os.ModeSymlink != 0:
+		return 10
+	case m&os.ModeCharDevice != 0:
+		return 2
+	case m&os.ModeDevice != 0:
+		return 6
+	case m&os.ModeNamedPipe != 0:
+		return 1
+	case m&os.ModeSocket != 0:
+		return 12
+	default:
+		return 8
+	}
+}
+
+func (h *fsHandler) fsync(ctx context.Context, msg *Tfsync) any {
+	file, ok := h.getFile(msg.FID, false)
+	if !ok {
+		return &Rerror{
+			Ename: "unknown FID",
+		}
+	}
+	file.RLock()
+	defer file.RUnlock()
+
+	if file.file == nil {
+		return &Rerror{
+			Ename: "file not open",
+		}
+	}
+
+	if s, ok := file.file.(interface{ Sync() error }); ok {
+		err := s.Sync()
+		if err != nil {
+			return h.rerror(err)
+		}
+	}
+
+	return &Rfsync{}
+}
+
+// lock always reports success. Locks are not enforced between
+// clients.
+func (h *fsHandler) lock(ctx context.Context, msg *Tlock) any {
+	return &Rlock{
+		Status: lockSuccess,
+	}
+}
+
+func (h *fsHandler) getlock(ctx context.Context, msg *Tgetlock) any {
+	return &Rgetlock{
+		Type:     lockUnlock,
+		Start:    msg.Start,
+		Length:   msg.Length,
+		ProcID:   msg.ProcID,
+		ClientID: msg.ClientID,
+	}
+}
+
+func (h *fsHandler) link(ctx context.Context, msg *Tlink) any {
+	dir, a, rsp := h.getPath(msg.DFID)
+	if rsp != nil {
+		return rsp
+	}
+
+	target, _, rsp := h.getPath(msg.FID)
+	if rsp != nil {
+		return rsp
+	}
+
+	special, ok := a.(SpecialFS)
+	if !ok {
+		return h.rerror(errors.ErrUnsupported)
+	}
+
+	err := special.Link(target, path.Join(dir, msg.Name))
+	if err != nil {
+		return h.rerror(err)
+	}
+
+	return &Rlink{}
+}
+
+func (h *fsHandler) mkdir(ctx context.Context, msg *Tmkdir) any {
+	dir, a, rsp := h.getPath(msg.DFID)
+	if rsp != nil {
+		return rsp
+	}
+
+	p := path.Join(dir, msg.Name)
+	perm := ModeDir | ModeFromOS(modeFromLinux(msg.Mode&^linuxSIFMT))
+	f, err := attachmentWithContext(a).CreateContext(ctx, p, perm, OREAD)
+	if err != nil {
+		return h.rerror(err)
+	}
+	if f != nil {
+		f.Close()
+	}
+
+	qid, err := h.getQID(ctx, p, a)
+	if err != nil {
+		return h.rerror(err)
+	}
+
+	return &Rmkdir{
+		QID: qid,
+	}
+}
+
+func (h *fsHandler) renameat(ctx context.Context, msg *Trenameat) any {
+	olddir, a, rsp := h.getPath(msg.OldDirFID)
+	if rsp != nil {
+		return rsp
+	}
+
+	newdir, _, rsp := h.getPath(msg.NewDirFID)
+	if rsp != nil {
+		return rsp
+	}
+
+	oldpath := path.Join(olddir, msg.OldName)
+	newpath := path.Join(newdir, msg.NewName)
+	err := h.rename(ctx, a, oldpath, newpath)
+	if err != nil {
+		return h.rerror(err)
+	}
+	h.movePaths(oldpath, newpath)
+
+	return &Rrenameat{}
+}
+
+func (h *fsHandler) unlinkat(ctx context.Context, msg *Tunlinkat) any {
+	dir, a, rsp := h.getPath(msg.DirFID)
+	if rsp != nil {
+		return rsp
+	}
+
+	err := attachmentWithContext(a).RemoveContext(ctx, path.Join(dir, msg.Name))
+	if err != nil {
+		return h.rerror(err)
+	}
+
+	return &Runlinkat{}
+}
+
+// handleDotL handles messages that are specific to 9P2000.L. It
+// returns nil if msg is not one of them.
+func (h *fsHandler) handleDotL(ctx context.Context, msg any) any {
+	switch msg := msg.(type) {
+	case *Tstatfs:
+		return h.statfs(ctx, msg)
+	case *Tlopen:
+		return h.lopen(ctx, msg)
+	case *Tlcreate:
+		return h.lcreate(ctx, msg)
+	case *Tsymlink:
+		return h.symlink(ctx, msg)
+	case *Tmknod:
+		return h.mknod(ctx, msg)
+	case *Trename:
+		return h.renameFID(ctx, msg)
+	case *Treadlink:
+		return h.readlink(ctx, msg)
+	case *Tgetattr:
+		return h.getattr(ctx, msg)
+	case *Tsetattr:
+		return h.setattr(ctx, msg)
+	case *Txattrwalk:
+		return h.xattrwalk(ctx, msg)
+	case *Txattrcreate:
+		return h.xattrcreate(ctx, msg)
+	case *Treaddir:
+		return h.readdirDotL(ctx, msg)
+	case *Tfsync:
+		return h.fsync(ctx, msg)
+	case *Tlock:
+		return h.lock(ctx, msg)
+	case *Tgetlock:
+		return h.getlock(ctx, msg)
+	case *Tlink:
+		return h.link(ctx, msg)
+	case *Tmkdir:
+		return h.mkdir(ctx, msg)
+	case *Trenameat:
+		return h.renameat(ctx, msg)
+	case *Tunlinkat:
+		return h.unlinkat(ctx, msg)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,1075 @@
+package p9_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DeedleFake/p9"
+	"github.com/DeedleFake/p9/proto"
+)
+
+// blockFS is a FileSystem whose files block when read until the read
+// is cancelled. If reading is not nil, a value is sent on it whenever
+// a directory read starts.
+type blockFS struct {
+	reading chan struct{}
+}
+
+func (blockFS) Auth(user, aname string) (p9.File, error) {
+	return nil, errors.New("no auth")
+}
+
+func (fsys blockFS) Attach(afile p9.File, user, aname string) (p9.Attachment, error) {
+	return fsys, nil
+}
+
+func (blockFS) Stat(p string) (p9.DirEntry, error) {
+	if strings.HasSuffix(p, "/dir") {
+		return p9.DirEntry{EntryName: "dir", FileMode: p9.ModeDir | 0755}, nil
+	}
+	return p9.DirEntry{EntryName: p}, nil
+}
+
+func (blockFS) WriteStat(p string, changes p9.StatChanges) error {
+	return errors.New("no wstat")
+}
+
+func (fsys blockFS) Open(p string, mode uint8) (p9.File, error) {
+	return blockFile{reading: fsys.reading}, nil
+}
+
+func (blockFS) Create(p string, perm p9.FileMode, mode uint8) (p9.File, error) {
+	return nil, errors.New("no create")
+}
+
+func (blockFS) Remove(p string) error {
+	return errors.New("no remove")
+}
+
+type blockFile struct {
+	reading chan struct{}
+}
+
+func (blockFile) ReadAt(buf []byte, off int64) (int, error) {
+	panic("ReadAt called instead of ReadAtContext")
+}
+
+func (blockFile) ReadAtContext(ctx context.Context, buf []byte, off int64) (int, error) {
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+func (blockFile) WriteAt(data []byte, off int64) (int, error) {
+	return 0, errors.New("no write")
+}
+
+func (blockFile) WriteAtContext(ctx context.Context, data []byte, off int64) (int, error) {
+	return 0, errors.New("no write")
+}
+
+func (blockFile) Readdir() ([]p9.DirEntry, error) {
+	return nil, errors.New("not a directory")
+}
+
+func (blockFile) ReaddirContext(ctx context.Context) ([]p9.DirEntry, error) {
+	return nil, errors.New("not a directory")
+}
+
+func (blockFile) ReadDirN(n int) ([]p9.DirEntry, error) {
+	panic("ReadDirN called instead of ReadDirNContext")
+}
+
+func (f blockFile) ReadDirNContext(ctx context.Context, n int) ([]p9.DirEntry, error) {
+	if f.reading != nil {
+		f.reading <- struct{}{}
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (blockFile) Close() error {
+	return nil
+}
+
+func isType[T any](v any) bool {
+	_, ok := v.(T)
+	return ok
+}
+
+func TestFlush(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	reading := make(chan struct{}, 1)
+	go proto.Serve(lis, p9.Proto(), p9.FSConnHandler(blockFS{reading: reading}, 4096))
+
+	c, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	send := func(tag uint16, msg any) {
+		err := p9.Proto().Send(c, tag, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	recv := func() (any, uint16) {
+		msg, tag, err := p9.Proto().Receive(c, 4096)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg, tag
+	}
+
+	send(p9.NoTag, &p9.Tversion{Msize: 4096, Version: p9.Version})
+	recv()
+	send(1, &p9.Tattach{FID: 0, AFID: p9.NoFID, Uname: "test", Aname: "/"})
+	recv()
+	send(2, &p9.Topen{FID: 0, Mode: p9.OREAD})
+	if msg, _ := recv(); !isType[*p9.Ropen](msg) {
+		t.Fatalf("Expected Ropen but got %#v", msg)
+	}
+
+	send(3, &p9.Tread{FID: 0, Count: 10})
+	send(4, &p9.Tflush{OldTag: 3})
+
+	msg, tag := recv()
+	if !isType[*p9.Rflush](msg) || (tag != 4) {
+		t.Fatalf("Expected Rflush with tag 4 but got %#v with tag %v", msg, tag)
+	}
+
+	// A blocked directory read must not stop the directory from being
+	// clunked.
+	send(5, &p9.Twalk{FID: 0, NewFID: 1, Wname: []string{"dir"}})
+	recv()
+	send(6, &p9.Topen{FID: 1, Mode: p9.OREAD})
+	if msg, _ := recv(); !isType[*p9.Ropen](msg) {
+		t.Fatalf("Expected Ropen but got %#v", msg)
+	}
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	send(7, &p9.Tread{FID: 1, Count: 100})
+	<-reading
+	send(8, &p9.Tclunk{FID: 1})
+	for range 2 {
+		msg, tag := recv()
+		if (tag == 8) && !isType[*p9.Rclunk](msg) {
+			t.Errorf("Expected Rclunk but got %#v", msg)
+		}
+	}
+}
+
+func TestVersionReset(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go proto.Serve(lis, p9.Proto(), p9.FSConnHandler(blockFS{}, 4096))
+
+	c, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	send := func(tag uint16, msg any) {
+		err := p9.Proto().Send(c, tag, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	recv := func() (any, uint16) {
+		msg, tag, err := p9.Proto().Receive(c, 4096)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg, tag
+	}
+
+	send(p9.NoTag, &p9.Tversion{Msize: 4096, Version: p9.Version})
+	recv()
+	send(1, &p9.Tattach{FID: 0, AFID: p9.NoFID, Uname: "test", Aname: "/"})
+	recv()
+	send(2, &p9.Topen{FID: 0, Mode: p9.OREAD})
+	if msg, _ := recv(); !isType[*p9.Ropen](msg) {
+		t.Fatalf("Expected Ropen but got %#v", msg)
+	}
+
+	// The blocked read must be aborted for the new version to be
+	// negotiated.
+	send(3, &p9.Tread{FID: 0, Count: 10})
+	send(p9.NoTag, &p9.Tversion{Msize: 4096, Version: p9.Version})
+	for {
+		msg, tag := recv()
+		if isType[*p9.Rversion](msg) {
+			break
+		}
+		if tag != 3 {
+			t.Fatalf("Expected Rversion but got %#v with tag %v", msg, tag)
+		}
+	}
+
+	send(4, &p9.Tstat{FID: 0})
+	if msg, _ := recv(); !isType[*p9.Rerror](msg) {
+		t.Errorf("Expected FID to be clunked but got %#v", msg)
+	}
+}
+
+func TestClientFlush(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go proto.Serve(lis, p9.Proto(), p9.FSConnHandler(blockFS{}, 4096))
+
+	c, err := p9.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err = c.Handshake(4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := c.Attach(nil, "test", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := root.Open("", p9.OREAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err = file.ReadAtContext(ctx, make([]byte, 10), 0)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Expected context.DeadlineExceeded but got %v", err)
+		}
+	}
+
+	_, err = root.Stat("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDotU(t *testing.T) {
+	dir := t.TempDir()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go proto.Serve(lis, p9.Proto(), p9.FSConnHandler(p9.Dir(dir), 4096))
+
+	c, err := p9.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err = c.Handshake(4096, p9.VersionDotU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Version() != p9.VersionDotU {
+		t.Fatalf("Negotiated %q", c.Version())
+	}
+
+	root, err := c.Attach(nil, "test", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	file, err := root.Create("test", 0644, p9.OWRITE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	stat, err := root.Stat("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.NUID == p9.NoUID {
+		t.Errorf("Expected numeric UID, got %v", stat.NUID)
+	}
+
+	d, err := root.Open("", p9.OREAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	entries, err := d.Readdir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (len(entries) != 1) || (entries[0].EntryName != "test") {
+		t.Errorf("Unexpected entries: %#v", entries)
+	}
+
+	_, err = root.Open("missing", p9.OREAD)
+	var rerr *p9.RerrorDotU
+	if !errors.As(err, &rerr) || (rerr.Errno != 2) {
+		t.Errorf("Expected ENOENT, got %#v", err)
+	}
+}
+
+func TestSymlink(t *testing.T) {
+	dir := t.TempDir()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go proto.Serve(lis, p9.Proto(), p9.FSConnHandler(p9.Dir(dir), 4096))
+
+	attach := func(versions ...string) *p9.Remote {
+		t.Helper()
+
+		c, err := p9.Dial("tcp", lis.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+
+		_, err = c.Handshake(4096, versions...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		root, err := c.Attach(nil, "test", "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return root
+	}
+
+	root := attach(p9.VersionDotU)
+
+	err = root.Symlink("missing/target", "link")
+	if err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	target, err := os.Readlink(filepath.Join(dir, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != filepath.FromSlash("missing/target") {
+		t.Errorf("Created link to %q", target)
+	}
+
+	target, err = root.Readlink("link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "missing/target" {
+		t.Errorf("Read link to %q", target)
+	}
+
+	d, err := root.Open("", p9.OREAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	entries, err := d.Readdir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (len(entries) != 1) || (entries[0].FileMode&p9.ModeSymlink == 0) || (entries[0].Extension != "missing/target") {
+		t.Errorf("Unexpected entries: %#v", entries)
+	}
+
+	_, err = attach(p9.Version).Readlink("link")
+	if !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Expected errors.ErrUnsupported without 9P2000.u, got %v", err)
+	}
+}
+
+func TestReadDirN(t *testing.T) {
+	dir := t.TempDir()
+	const num = 200
+	for i := range num {
+		err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%03d", i)), nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go proto.Serve(lis, p9.Proto(), p9.FSConnHandler(p9.Dir(dir), 1024))
+
+	c, err := p9.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err = c.Handshake(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := c.Attach(nil, "test", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	d, err := root.Open("", p9.OREAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	seen := make(map[string]bool)
+	for {
+		entries, err := d.ReadDirN(7)
+		for _, e := range entries {
+			if seen[e.EntryName] {
+				t.Errorf("Duplicate entry: %q", e.EntryName)
+			}
+			seen[e.EntryName] = true
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (len(entries) == 0) || (len(entries) > 7) {
+			t.Fatalf("Read %v entries", len(entries))
+		}
+	}
+	if len(seen) != num {
+		t.Errorf("Read %v entries, expected %v", len(seen), num)
+	}
+
+	_, err = d.ReadAt(make([]byte, 100), 3)
+	if err == nil {
+		t.Error("Read at an invalid directory offset succeeded")
+	}
+
+	_, err = d.Seek(0, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := d.Readdir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != num {
+		t.Errorf("Reread %v entries, expected %v", len(entries), num)
+	}
+}
+
+func TestDotL(t *testing.T) {
+	dir := t.TempDir()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go proto.Serve(lis, p9.Proto(), p9.FSConnHandler(p9.Dir(dir), 4096))
+
+	c, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	p := p9.Proto()
+	var tag uint16
+	rpc := func(msg any) any {
+		tag++
+		err := p.Send(c, tag, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp, _, err := p.Receive(c, 4096)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rsp
+	}
+
+	rsp := rpc(&p9.Tversion{Msize: 4096, Version: p9.VersionDotL})
+	if v, ok := rsp.(*p9.Rversion); !ok || (v.Version != p9.VersionDotL) {
+		t.Fatalf("Unexpected version response: %#v", rsp)
+	}
+	p = p9.ProtoDotL()
+
+	rsp = rpc(&p9.TattachDotU{Tattach: p9.Tattach{FID: 0, AFID: p9.NoFID, Uname: "test"}, NUname: p9.NoUID})
+	if !isType[*p9.Rattach](rsp) {
+		t.Fatalf("Expected Rattach but got %#v", rsp)
+	}
+
+	rsp = rpc(&p9.Tmkdir{DFID: 0, Name: "sub", Mode: 0755, GID: p9.NoUID})
+	if mkdir, ok := rsp.(*p9.Rmkdir); !ok || (mkdir.QID.Type&p9.QTDir == 0) {
+		t.Fatalf("Expected Rmkdir with directory QID but got %#v", rsp)
+	}
+
+	rsp = rpc(&p9.Tgetattr{FID: 0, RequestMask: 0x7ff})
+	if attr, ok := rsp.(*p9.Rgetattr); !ok || (attr.Mode&0170000 != 0040000) {
+		t.Fatalf("Expected Rgetattr for directory but got %#v", rsp)
+	}
+
+	rsp = rpc(&p9.Twalk{FID: 0, NewFID: 1, Wname: []string{"missing"}})
+	if lerr, ok := rsp.(*p9.Rlerror); !ok || (lerr.Ecode != 2) {
+		t.Fatalf("Expected Rlerror with ENOENT but got %#v", rsp)
+	}
+
+	rsp = rpc(&p9.Tlopen{FID: 0, Flags: 0})
+	if !isType[*p9.Rlopen](rsp) {
+		t.Fatalf("Expected Rlopen but got %#v", rsp)
+	}
+
+	rsp = rpc(&p9.Treaddir{FID: 0, Offset: 0, Count: 1024})
+	readdir, ok := rsp.(*p9.Rreaddir)
+	if !ok {
+		t.Fatalf("Expected Rreaddir but got %#v", rsp)
+	}
+	if !bytes.Contains(readdir.Data, []byte("sub")) {
+		t.Errorf("Entry not found in readdir data: %q", readdir.Data)
+	}
+
+	rsp = rpc(&p9.Treaddir{FID: 0, Offset: 1, Count: 1024})
+	if readdir, ok := rsp.(*p9.Rreaddir); !ok || (len(readdir.Data) != 0) {
+		t.Errorf("Expected empty Rreaddir but got %#v", rsp)
+	}
+
+	rsp = rpc(&p9.Treaddir{FID: 0, Offset: 5, Count: 1024})
+	if !isType[*p9.Rlerror](rsp) {
+		t.Errorf("Expected Rlerror for a bad offset but got %#v", rsp)
+	}
+
+	rsp = rpc(&p9.Treaddir{FID: 0, Offset: 0, Count: 1024})
+	if readdir, ok := rsp.(*p9.Rreaddir); !ok || !bytes.Contains(readdir.Data, []byte("sub")) {
+		t.Errorf("Expected entry after rereading but got %#v", rsp)
+	}
+}
+
+// errFS is a FileSystem that fails to attach with the error that
+// corresponds to the aname.
+type errFS map[string]error
+
+func (errFS) Auth(user, aname string) (p9.File, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func (fsys errFS) Attach(afile p9.File, user, aname string) (p9.Attachment, error) {
+	return nil, fsys[aname]
+}
+
+func TestDotLErrors(t *testing.T) {
+	fsys := errFS{
+		"notexist":    &fs.PathError{Op: "attach", Path: "notexist", Err: fs.ErrNotExist},
+		"permission":  fs.ErrPermission,
+		"exist":       fs.ErrExist,
+		"unsupported": errors.ErrUnsupported,
+		"other":       errors.New("something else"),
+	}
+	tests := []struct {
+		aname string
+		ecode uint32
+	}{
+		{"notexist", 2},
+		{"permission", 13},
+		{"exist", 17},
+		{"unsupported", 95},
+		{"other", 5},
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go proto.Serve(lis, p9.Proto(), p9.FSConnHandler(fsys, 4096))
+
+	c, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	p := p9.Proto()
+	var tag uint16
+	rpc := func(msg any) any {
+		tag++
+		err := p.Send(c, tag, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp, _, err := p.Receive(c, 4096)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rsp
+	}
+
+	rsp := rpc(&p9.Tversion{Msize: 4096, Version: p9.VersionDotL})
+	if v, ok := rsp.(*p9.Rversion); !ok || (v.Version != p9.VersionDotL) {
+		t.Fatalf("Unexpected version response: %#v", rsp)
+	}
+	p = p9.ProtoDotL()
+
+	for _, test := range tests {
+		rsp := rpc(&p9.TattachDotU{Tattach: p9.Tattach{FID: 0, AFID: p9.NoFID, Uname: "test", Aname: test.aname}, NUname: p9.NoUID})
+		if lerr, ok := rsp.(*p9.Rlerror); !ok || (lerr.Ecode != test.ecode) {
+			t.Errorf("Expected Rlerror with %v for %q but got %#v", test.ecode, test.aname, rsp)
+		}
+	}
+}
+
+type dotuOnlyFS struct {
+	p9.Dir
+}
+
+func (dotuOnlyFS) Dialects() proto.Dialects {
+	return proto.Dialects{p9.VersionDotU: p9.ProtoDotU()}
+}
+
+func TestNegotiation(t *testing.T) {
+	tests := []struct {
+		name     string
+		fs       p9.FileSystem
+		versions []string
+		expect   string
+	}{
+		{name: "Default", fs: p9.Dir(t.TempDir()), expect: p9.Version},
+		{name: "Preferred", fs: p9.Dir(t.TempDir()), versions: []string{p9.VersionDotU, p9.Version}, expect: p9.VersionDotU},
+		{name: "Retry", fs: dotuOnlyFS{p9.Dir(t.TempDir())}, versions: []string{p9.Version, p9.VersionDotU}, expect: p9.VersionDotU},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer lis.Close()
+			go proto.Serve(lis, p9.Proto(), p9.FSConnHandler(test.fs, 4096))
+
+			c, err := p9.Dial("tcp", lis.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			_, err = c.Handshake(4096, test.versions...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Version() != test.expect {
+				t.Fatalf("Expected %q but negotiated %q", test.expect, c.Version())
+			}
+
+			root, err := c.Attach(nil, "test", "/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer root.Close()
+
+			_, err = root.Stat("")
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go proto.Serve(lis, p9.Proto(), p9.FSConnHandler(p9.Dir(t.TempDir()), 8192))
+
+	c, err := p9.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err = c.Handshake(8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := c.Attach(nil, "test", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			data := bytes.Repeat([]byte{byte(i)}, 100*1024+i)
+
+			file, err := root.Create(fmt.Sprintf("file%v", i), 0644, p9.ORDWR)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer file.Close()
+
+			_, err = file.WriteAt(data, 0)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			buf := make([]byte, len(data))
+			n, err := file.ReadAt(buf, 0)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !bytes.Equal(buf[:n], data) {
+				t.Errorf("File %v: data mismatch", i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestReconnect(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "a"), []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "b"), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Deeper than can be restored by a single walk.
+	deep := filepath.Join(dir, strings.Repeat("d/", 20))
+	err = os.MkdirAll(deep, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(deep, "c"), []byte("deep"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go proto.Serve(lis, p9.Proto(), p9.FSConnHandler(p9.Dir(dir), 8192))
+
+	var conn net.Conn
+	var dials int
+	dial := func() (net.Conn, error) {
+		c, err := net.Dial("tcp", lis.Addr().String())
+		conn = c
+		dials++
+		return c, err
+	}
+
+	// Closing the client's end of the connection out from under it
+	// looks the same to it as the server going away.
+	disconnect := func(c *p9.Client) {
+		conn.Close()
+		<-c.Done()
+	}
+
+	pc, err := dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := p9.NewClient(pc)
+	defer c.Close()
+	c.SetRedial(dial)
+
+	lost := make(chan error, 10)
+	c.SetDisconnectHandler(func(err error) { lost <- err })
+
+	_, err = c.Handshake(8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := c.Attach(nil, "test", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := root.Open("a", p9.OREAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := root.Open("b", p9.OREAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := root.Walk(strings.Repeat("d/", 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf, err := d.Open(strings.Repeat("d/", 10)+"c", p9.OREAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	disconnect(c)
+	err = os.Remove(filepath.Join(dir, "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 5)
+	_, err = a.ReadAt(buf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Errorf("Expected %q but got %q", "hello", buf)
+	}
+
+	_, err = b.ReadAt(buf, 0)
+	if !errors.Is(err, p9.ErrStale) {
+		t.Errorf("Expected ErrStale but got %v", err)
+	}
+
+	n, err := cf.ReadAt(buf, 0)
+	if (err != nil) && (err != io.EOF) {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "deep" {
+		t.Errorf("Expected %q but got %q", "deep", buf[:n])
+	}
+
+	// The disconnect handler must carry over to new connections.
+	<-lost
+	disconnect(c)
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Error("Disconnect handler not called after reconnecting")
+	}
+
+	_, err = root.Stat("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Closing files after the connection is lost has nothing to clean
+	// up, so it shouldn't reconnect.
+	disconnect(c)
+	before := dials
+	for _, file := range []*p9.Remote{root, b, d, cf} {
+		err = file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if dials != before {
+		t.Errorf("Closing files reconnected %v times", dials-before)
+	}
+}
+
+// qidFS wraps a FileSystem so that generating QIDs can be made to
+// fail.
+type qidFS struct {
+	p9.FileSystem
+	fail *atomic.Bool
+}
+
+func (fsys qidFS) Attach(afile p9.File, user, aname string) (p9.Attachment, error) {
+	a, err := fsys.FileSystem.Attach(afile, user, aname)
+	return &qidAttachment{Attachment: a, fail: fsys.fail}, err
+}
+
+type qidAttachment struct {
+	p9.Attachment
+	fail *atomic.Bool
+	gen  p9.QIDGen
+}
+
+func (a *qidAttachment) GetQID(p string) (p9.QID, error) {
+	if a.fail.Load() {
+		return p9.QID{}, errors.New("no QID")
+	}
+
+	stat, err := a.Stat(p)
+	if err != nil {
+		return p9.QID{}, err
+	}
+	return a.gen.QID(p, stat), nil
+}
+
+func TestOpenQIDFailure(t *testing.T) {
+	var fsys p9.MemFS
+	var fail atomic.Bool
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go proto.Serve(lis, p9.Proto(), p9.FSConnHandler(qidFS{FileSystem: &fsys, fail: &fail}, 4096))
+
+	c, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	send := func(tag uint16, msg any) any {
+		t.Helper()
+
+		err := p9.Proto().Send(c, tag, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp, _, err := p9.Proto().Receive(c, 4096)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rsp
+	}
+
+	send(p9.NoTag, &p9.Tversion{Msize: 4096, Version: p9.Version})
+	send(1, &p9.Tattach{FID: 0, AFID: p9.NoFID, Uname: "test", Aname: "/"})
+	send(2, &p9.Twalk{FID: 0, NewFID: 1})
+	if rsp := send(3, &p9.Tcreate{FID: 1, Name: "file", Perm: 0644, Mode: p9.OWRITE}); !isType[*p9.Rcreate](rsp) {
+		t.Fatalf("Expected Rcreate but got %#v", rsp)
+	}
+	send(4, &p9.Tclunk{FID: 1})
+	send(5, &p9.Twalk{FID: 0, NewFID: 1, Wname: []string{"file"}})
+
+	fail.Store(true)
+	if rsp := send(6, &p9.Topen{FID: 1, Mode: p9.OREAD | p9.ORCLOSE}); !isType[*p9.Rerror](rsp) {
+		t.Fatalf("Expected Rerror but got %#v", rsp)
+	}
+	fail.Store(false)
+
+	// The failed open must not have left the FID open.
+	if rsp := send(7, &p9.Tread{FID: 1, Count: 10}); !isType[*p9.Rerror](rsp) {
+		t.Errorf("Expected read from unopened FID to fail but got %#v", rsp)
+	}
+	send(8, &p9.Tclunk{FID: 1})
+	if rsp := send(9, &p9.Twalk{FID: 0, NewFID: 1, Wname: []string{"file"}}); !isType[*p9.Rwalk](rsp) {
+		t.Errorf("Expected file to still exist but got %#v", rsp)
+	}
+}
+
+func TestOpenModes(t *testing.T) {
+	var fsys p9.MemFS
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go proto.Serve(lis, p9.Proto(), p9.FSConnHandler(&fsys, 4096))
+
+	attach := func() (*p9.Client, *p9.Remote) {
+		t.Helper()
+
+		c, err := p9.Dial("tcp", lis.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = c.Handshake(4096)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, err := c.Attach(nil, "test", "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c, root
+	}
+
+	c, root := attach()
+	defer c.Close()
+
+	file, err := root.Create("tmp", 0644, p9.ORDWR|p9.ORCLOSE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = root.Stat("tmp")
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected os.ErrNotExist after clunk but got %v", err)
+	}
+
+	file, err = root.Create("file", 0644, p9.OWRITE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	_, err = root.Open("file", p9.OEXEC)
+	if !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Expected os.ErrPermission for OEXEC but got %v", err)
+	}
+	for _, mode := range []uint8{p9.OWRITE, p9.ORDWR, p9.OREAD | p9.OTRUNC} {
+		_, err = root.Open("", mode)
+		if err == nil {
+			t.Errorf("Opening a directory with mode %#x succeeded", mode)
+		}
+	}
+
+	c2, root2 := attach()
+	_, err = root2.Open("file", p9.OREAD|p9.ORCLOSE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2.Close()
+
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		_, err = root.Stat("file")
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("File not removed after disconnect: %v", err)
+		}
+	}
+}
@@ -4,4 +4,4 @@ go 1.24.0
 
 require bazil.org/fuse v0.0.0-20230120002735-62a210ff1fd5
 
-require golang.org/x/sys v0.37.0 // indirect
+require golang.org/x/sys v0.37.0
@@ -0,0 +1,429 @@
+package p9
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// IDMapper maps between the names of users and groups used by 9P and
+// the numeric IDs used by the local system.
+type IDMapper interface {
+	// User returns the name of the user with the given ID.
+	User(uid uint32) (string, error)
+
+	// Group returns the name of the group with the given ID.
+	Group(gid uint32) (string, error)
+
+	// UID returns the ID of the user with the given name.
+	UID(name string) (uint32, error)
+
+	// GID returns the ID of the group with the given name.
+	GID(name string) (uint32, error)
+}
+
+// SystemIDs is an IDMapper that uses the local system's user and group
+// databases. It is what Dir uses.
+var SystemIDs IDMapper = systemIDs{}
+
+type systemIDs struct{}
+
+func (systemIDs) User(uid uint32) (string, error) {
+	u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10))
+	if err != nil {
+		return "", err
+	}
+	return u.Username, nil
+}
+
+func (systemIDs) Group(gid uint32) (string, error) {
+	g, err := user.LookupGroupId(strconv.FormatUint(uint64(gid), 10))
+	if err != nil {
+		return "", err
+	}
+	return g.Name, nil
+}
+
+func (systemIDs) UID(name string) (uint32, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("user %q has non-numeric ID %q", name, u.Uid)
+	}
+	return uint32(uid), nil
+}
+
+func (systemIDs) GID(name string) (uint32, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, err
+	}
+	gid, err := strconv.ParseUint(g.Gid, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("group %q has non-numeric ID %q", name, g.Gid)
+	}
+	return uint32(gid), nil
+}
+
+// IDTable is an IDMapper that maps names using fixed tables. Names and
+// IDs that aren't in the tables are mapped using Fallback, if it isn't
+// nil.
+type IDTable struct {
+	Users    map[string]uint32
+	Groups   map[string]uint32
+	Fallback IDMapper
+}
+
+// errNoID is returned by IDTable for names and IDs that it can't map.
+var errNoID = errors.New("no such user or group")
+
+func (t IDTable) User(uid uint32) (string, error) {
+	for name, id := range t.Users {
+		if id == uid {
+			return name, nil
+		}
+	}
+	if t.Fallback != nil {
+		return t.Fallback.User(uid)
+	}
+	return "", errNoID
+}
+
+func (t IDTable) Group(gid uint32) (string, error) {
+	for name, id := range t.Groups {
+		if id == gid {
+			return name, nil
+		}
+	}
+	if t.Fallback != nil {
+		return t.Fallback.Group(gid)
+	}
+	return "", errNoID
+}
+
+func (t IDTable) UID(name string) (uint32, error) {
+	if id, ok := t.Users[name]; ok {
+		return id, nil
+	}
+	if t.Fallback != nil {
+		return t.Fallback.UID(name)
+	}
+	return 0, errNoID
+}
+
+func (t IDTable) GID(name string) (uint32, error) {
+	if id, ok := t.Groups[name]; ok {
+		return id, nil
+	}
+	if t.Fallback != nil {
+		return t.Fallback.GID(name)
+	}
+	return 0, errNoID
+}
+
+// Squash determines which users are treated as an anonymous user by a
+// MappedDir, similarly to the options of the same names in NFS.
+type Squash int
+
+const (
+	// NoSquash treats every user as themselves.
+	NoSquash Squash = iota
+
+	// RootSquash treats users that map to ID 0 as anonymous.
+	RootSquash
+
+	// AllSquash treats every user as anonymous.
+	AllSquash
+)
+
+// nobody is the ID conventionally used for the anonymous user and
+// group.
+const nobody = 65534
+
+// MappedDir is a variant of Dir that maps between the names of users
+// and groups used by clients and the IDs used by the local system in a
+// configurable way, such as for serving files from a container or to
+// other hosts with different user databases.
+//
+// Files and directories are reported as being owned by the users and
+// groups that their IDs map to. Changes to the owner or group of a file
+// are mapped to IDs and applied, which usually requires the server to
+// be running with elevated privileges. If the server is running as
+// root, files created by a client are also changed to be owned by the
+// user that it attached as and, if there is a group with the same name
+// as that user, that group.
+//
+// Users that are squashed are treated as the anonymous user identified
+// by AnonUID and AnonGID, as are users that can't be mapped to an ID.
+// Squashed users can not change the owner or group of files. Like Dir,
+// a MappedDir does not check permissions itself, so every other
+// operation is performed with the privileges of the server. To enforce
+// permissions, wrap it in a PermFS, which checks them as the user that
+// each client is squashed to.
+//
+// Numeric IDs, such as those used by 9P2000.L, are not mapped, as they
+// are assumed to already be local IDs.
+type MappedDir struct {
+	// Dir is the directory to serve files from.
+	Dir Dir
+
+	// Confine, if true, confines clients to Dir in the same way as a
+	// ConfinedDir.
+	Confine bool
+
+	// IDs maps between names and IDs. If it is nil, SystemIDs is used.
+	IDs IDMapper
+
+	// Squash determines which users are squashed.
+	Squash Squash
+
+	// AnonUID and AnonGID are the IDs used for the anonymous user. If
+	// they are zero, 65534 is used, as is conventional for the user
+	// nobody.
+	AnonUID, AnonGID uint32
+}
+
+// fs returns the FileSystem that d serves files from.
+func (d MappedDir) fs() FileSystem {
+	if d.Confine {
+		return ConfinedDir(d.Dir)
+	}
+	return d.Dir
+}
+
+func (d MappedDir) ids() IDMapper {
+	if d.IDs == nil {
+		return SystemIDs
+	}
+	return d.IDs
+}
+
+func (d MappedDir) anon() (uid, gid int) {
+	uid, gid = nobody, nobody
+	if d.AnonUID != 0 {
+		uid = int(d.AnonUID)
+	}
+	if d.AnonGID != 0 {
+		gid = int(d.AnonGID)
+	}
+	return uid, gid
+}
+
+// Auth implements FileSystem.Auth.
+func (d MappedDir) Auth(user, aname string) (File, error) {
+	return d.fs().Auth(user, aname)
+}
+
+// Attach implements FileSystem.Attach.
+func (d MappedDir) Attach(afile File, user, aname string) (Attachment, error) {
+	base, err := d.fs().Attach(afile, user, aname)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &mappedAttachment{AttachmentDotL: base.(AttachmentDotL), d: d, user: user, gid: -1}
+	uid, err := d.ids().UID(user)
+	switch {
+	case (err != nil) || (d.Squash == AllSquash) || ((d.Squash == RootSquash) && (uid == 0)):
+		a.uid, a.gid = d.anon()
+		a.squashed = true
+
+		a.user, err = d.ids().User(uint32(a.uid))
+		if err != nil {
+			a.user = "nobody"
+		}
+	default:
+		a.uid = int(uid)
+		if gid, err := d.ids().GID(user); err == nil {
+			a.gid = int(gid)
+		}
+	}
+
+	return a, nil
+}
+
+// mappedAttachment is an attachment to a MappedDir. user is the name
+// of the user that the client is treated as, and uid and gid are the
+// IDs that it maps to, with -1 indicating that no ID is known.
+type mappedAttachment struct {
+	AttachmentDotL
+	d        MappedDir
+	user     string
+	uid, gid int
+	squashed bool
+}
+
+// User implements UserFS.
+func (a *mappedAttachment) User() string {
+	return a.user
+}
+
+// mapEntry replaces the names of the owner and group of e with those
+// given by the attachment's IDMapper.
+func (a *mappedAttachment) mapEntry(e *DirEntry) {
+	if e.NUID != NoUID {
+		e.UID, _ = a.d.ids().User(e.NUID)
+	}
+	if e.NGID != NoUID {
+		e.GID, _ = a.d.ids().Group(e.NGID)
+	}
+}
+
+// chown changes the owner of the newly created file at p to the
+// attached user if the server is running as root.
+func (a *mappedAttachment) chown(p string) error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+
+	if a.d.Confine {
+		r, err := ConfinedDir(a.d.Dir).resolve(p, false)
+		if err != nil {
+			return err
+		}
+		p = r
+	}
+	return os.Lchown(a.d.Dir.path(p), a.uid, a.gid)
+}
+
+func (a *mappedAttachment) Stat(p string) (DirEntry, error) {
+	e, err := a.AttachmentDotL.Stat(p)
+	if err != nil {
+		return e, err
+	}
+	a.mapEntry(&e)
+	return e, nil
+}
+
+func (a *mappedAttachment) WriteStat(p string, changes StatChanges) error {
+	uid, chuid := changes.UID()
+	gid, chgid := changes.GID()
+	_, chnuid := changes.NUID()
+	_, chngid := changes.NGID()
+	if a.squashed && (chuid || chgid || chnuid || chngid) {
+		return &fs.PathError{Op: "wstat", Path: p, Err: fs.ErrPermission}
+	}
+
+	// Names are resolved here so that Dir doesn't resolve them using
+	// the system's user database instead.
+	changes.DirEntry.UID, changes.DirEntry.GID = "", ""
+	if chuid {
+		id, err := a.d.ids().UID(uid)
+		if err != nil {
+			return &fs.PathError{Op: "wstat", Path: p, Err: err}
+		}
+		changes.DirEntry.NUID = id
+	}
+	if chgid {
+		id, err := a.d.ids().GID(gid)
+		if err != nil {
+			return &fs.PathError{Op: "wstat", Path: p, Err: err}
+		}
+		changes.DirEntry.NGID = id
+	}
+
+	return a.AttachmentDotL.WriteStat(p, changes)
+}
+
+func (a *mappedAttachment) Open(p string, mode uint8) (File, error) {
+	file, err := a.AttachmentDotL.Open(p, mode)
+	if err != nil {
+		return nil, err
+	}
+	return &mappedFile{File: file, a: a}, nil
+}
+
+func (a *mappedAttachment) Create(p string, perm FileMode, mode uint8) (File, error) {
+	file, err := a.AttachmentDotL.Create(p, perm, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.chown(p)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &mappedFile{File: file, a: a}, nil
+}
+
+func (a *mappedAttachment) Symlink(target, p string) error {
+	err := a.AttachmentDotL.Symlink(target, p)
+	if err != nil {
+		return err
+	}
+	return a.chown(p)
+}
+
+func (a *mappedAttachment) Mknod(p string, mode os.FileMode, major, minor uint32) error {
+	err := a.AttachmentDotL.Mknod(p, mode, major, minor)
+	if err != nil {
+		return err
+	}
+	return a.chown(p)
+}
+
+func (a *mappedAttachment) GetQID(p string) (QID, error) {
+	if q, ok := a.AttachmentDotL.(QIDFS); ok {
+		return q.GetQID(p)
+	}
+
+	stat, err := a.AttachmentDotL.Stat(p)
+	if err != nil {
+		return QID{}, err
+	}
+	return pathQID(p, stat), nil
+}
+
+func (a *mappedAttachment) StatFS(p string) (FSStat, error) {
+	if s, ok := a.AttachmentDotL.(StatFSFS); ok {
+		return s.StatFS(p)
+	}
+	return defaultFSStat, nil
+}
+
+// mappedFile is a file opened via a MappedDir.
+type mappedFile struct {
+	File
+	a *mappedAttachment
+}
+
+func (f *mappedFile) Readdir() ([]DirEntry, error) {
+	entries, err := f.File.Readdir()
+	for i := range entries {
+		f.a.mapEntry(&entries[i])
+	}
+	return entries, err
+}
+
+// ReadDirN implements DirReader. Files opened by a Dir or a
+// ConfinedDir always implement DirReader.
+func (f *mappedFile) ReadDirN(n int) ([]DirEntry, error) {
+	entries, err := f.File.(DirReader).ReadDirN(n)
+	for i := range entries {
+		f.a.mapEntry(&entries[i])
+	}
+	return entries, err
+}
+
+// Seek implements io.Seeker so that directories can be reread.
+func (f *mappedFile) Seek(offset int64, whence int) (int64, error) {
+	return f.File.(io.Seeker).Seek(offset, whence)
+}
+
+var (
+	_ FileSystem     = MappedDir{}
+	_ AttachmentDotL = (*mappedAttachment)(nil)
+	_ QIDFS          = (*mappedAttachment)(nil)
+	_ StatFSFS       = (*mappedAttachment)(nil)
+	_ UserFS         = (*mappedAttachment)(nil)
+	_ IDMapper       = IDTable{}
+)
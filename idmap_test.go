@@ -0,0 +1,137 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package p9_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/DeedleFake/p9"
+)
+
+func TestMappedDir(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing owners requires root")
+	}
+
+	dir := t.TempDir()
+	ids := p9.IDTable{
+		Users:  map[string]uint32{"alice": 1001, "root": 0, "nobody": 65534},
+		Groups: map[string]uint32{"alice": 1001, "staff": 2000},
+	}
+
+	attach := func(squash p9.Squash, user string) p9.Attachment {
+		t.Helper()
+
+		a, err := p9.MappedDir{Dir: p9.Dir(dir), Confine: true, IDs: ids, Squash: squash}.Attach(nil, user, "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	create := func(a p9.Attachment, name string) p9.DirEntry {
+		t.Helper()
+
+		file, err := a.Create(name, 0644, p9.OWRITE)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+
+		stat, err := a.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stat
+	}
+	owner := func(name string) (uint32, uint32) {
+		t.Helper()
+
+		fi, err := os.Lstat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sys := fi.Sys().(*syscall.Stat_t)
+		return sys.Uid, sys.Gid
+	}
+
+	alice := attach(p9.NoSquash, "alice")
+	stat := create(alice, "a")
+	if (stat.UID != "alice") || (stat.GID != "alice") {
+		t.Errorf("Expected alice:alice but got %v:%v", stat.UID, stat.GID)
+	}
+	if uid, gid := owner("a"); (uid != 1001) || (gid != 1001) {
+		t.Errorf("Expected 1001:1001 but got %v:%v", uid, gid)
+	}
+
+	changes := p9.StatChanges{DirEntry: p9.DirEntry{
+		FileMode: 0xFFFFFFFF,
+		ATime:    unsetTime,
+		MTime:    unsetTime,
+		Length:   0xFFFFFFFFFFFFFFFF,
+		GID:      "staff",
+		NUID:     p9.NoUID,
+		NGID:     p9.NoUID,
+		NMUID:    p9.NoUID,
+	}}
+	err := alice.WriteStat("a", changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, gid := owner("a"); gid != 2000 {
+		t.Errorf("Expected group 2000 but got %v", gid)
+	}
+
+	root := attach(p9.RootSquash, "root")
+	create(root, "b")
+	if uid, gid := owner("b"); (uid != 65534) || (gid != 65534) {
+		t.Errorf("Expected 65534:65534 but got %v:%v", uid, gid)
+	}
+	err = root.WriteStat("a", changes)
+	if !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("Expected fs.ErrPermission but got %v", err)
+	}
+
+	squashed := attach(p9.AllSquash, "alice")
+	create(squashed, "c")
+	if uid, _ := owner("c"); uid != 65534 {
+		t.Errorf("Expected owner 65534 but got %v", uid)
+	}
+
+	if user := squashed.(p9.UserFS).User(); user != "nobody" {
+		t.Errorf("Expected squashed user to be nobody but got %q", user)
+	}
+
+	err = os.Symlink("/", filepath.Join(dir, "escape"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = alice.Open("escape/etc", p9.OREAD)
+	if err == nil {
+		t.Error("Expected opening through an escaping symlink to fail")
+	}
+
+	err = os.Chmod(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	perms, err := p9.PermFS{FileSystem: p9.MappedDir{Dir: p9.Dir(dir), IDs: ids, Squash: p9.RootSquash}}.Attach(nil, "root", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := perms.Open("/b", p9.OWRITE)
+	if err != nil {
+		t.Errorf("Expected squashed root to be able to write its own file but got %v", err)
+	} else {
+		file.Close()
+	}
+	_, err = perms.Open("/a", p9.OWRITE)
+	if !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("Expected fs.ErrPermission but got %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+// msggen generates reflection-free encoding and decoding methods for
+// the message types of package p9, as well as P9Sequence methods for
+// the ones that operate on a FID. It is run via go generate from the
+// root of the repository.
+//
+// The message types are found by inspecting the protocols exported by
+// package p9 at runtime, so if the generated file fails to compile it
+// must be deleted before msggen can be run again.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/DeedleFake/p9"
+	"github.com/DeedleFake/p9/proto"
+)
+
+const pkgPath = "github.com/DeedleFake/p9"
+
+var (
+	encoderType = reflect.TypeOf((*proto.Encoder)(nil)).Elem()
+	decoderType = reflect.TypeOf((*proto.Decoder)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// messageTypes returns every message type in the given protocols,
+// sorted by name.
+func messageTypes(protos ...proto.Proto) []reflect.Type {
+	seen := make(map[reflect.Type]struct{})
+	var types []reflect.Type
+	for _, p := range protos {
+		for id := 0; id < 256; id++ {
+			t := p.TypeFromID(uint8(id))
+			if t == nil {
+				continue
+			}
+			if _, ok := seen[t]; ok {
+				continue
+			}
+
+			seen[t] = struct{}{}
+			types = append(types, t)
+		}
+	}
+
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].Name() < types[j].Name()
+	})
+	return types
+}
+
+// custom reports whether t encodes itself via proto.Encoder and
+// proto.Decoder.
+func custom(t reflect.Type) bool {
+	pt := reflect.PointerTo(t)
+	return pt.Implements(encoderType) || pt.Implements(decoderType)
+}
+
+func typeName(t reflect.Type) string {
+	if t.PkgPath() == pkgPath {
+		return t.Name()
+	}
+	if (t.Name() == "") && (t.Kind() == reflect.Slice) {
+		return "[]" + typeName(t.Elem())
+	}
+	return t.String()
+}
+
+// convert wraps expr in a conversion to t if t is a named type.
+func convert(t reflect.Type, expr string) string {
+	if (t.PkgPath() == "") && (t.Name() != "") {
+		return expr
+	}
+	return fmt.Sprintf("%v(%v)", typeName(t), expr)
+}
+
+type generator struct {
+	buf   bytes.Buffer
+	depth int
+	time  bool
+}
+
+func (g *generator) printf(str string, args ...any) {
+	fmt.Fprintf(&g.buf, str, args...)
+}
+
+func (g *generator) variable(prefix string) string {
+	g.depth++
+	return fmt.Sprintf("%v%v", prefix, g.depth)
+}
+
+func (g *generator) appendValue(expr string, t reflect.Type) {
+	if t == timeType {
+		g.printf("buf = binary.LittleEndian.AppendUint32(buf, uint32(%v.Unix()))\n", expr)
+		return
+	}
+	if custom(t) {
+		log.Fatalf("field %v of type %v encodes itself", expr, t)
+	}
+
+	switch t.Kind() {
+	case reflect.Uint8, reflect.Int8:
+		g.printf("buf = append(buf, uint8(%v))\n", expr)
+	case reflect.Uint16, reflect.Int16:
+		g.printf("buf = binary.LittleEndian.AppendUint16(buf, uint16(%v))\n", expr)
+	case reflect.Uint32, reflect.Int32:
+		g.printf("buf = binary.LittleEndian.AppendUint32(buf, uint32(%v))\n", expr)
+	case reflect.Uint64, reflect.Int64:
+		g.printf("buf = binary.LittleEndian.AppendUint64(buf, uint64(%v))\n", expr)
+
+	case reflect.String:
+		g.printf("buf = binary.LittleEndian.AppendUint16(buf, uint16(len(%v)))\n", expr)
+		g.printf("buf = append(buf, %v...)\n", expr)
+
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			g.printf("buf = binary.LittleEndian.AppendUint32(buf, uint32(len(%v)))\n", expr)
+			g.printf("buf = append(buf, %v...)\n", expr)
+			return
+		}
+
+		v := g.variable("v")
+		g.printf("buf = binary.LittleEndian.AppendUint16(buf, uint16(len(%v)))\n", expr)
+		g.printf("for _, %v := range %v {\n", v, expr)
+		g.appendValue(v, t.Elem())
+		g.printf("}\n")
+
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				log.Fatalf("field %v.%v is not exported", expr, f.Name)
+			}
+			g.appendValue(expr+"."+f.Name, f.Type)
+		}
+
+	default:
+		log.Fatalf("field %v has unsupported type %v", expr, t)
+	}
+}
+
+func (g *generator) parseValue(expr string, t reflect.Type) {
+	if t == timeType {
+		g.time = true
+		g.printf("%v = time.Unix(int64(p.uint32()), 0)\n", expr)
+		return
+	}
+	if custom(t) {
+		log.Fatalf("field %v of type %v decodes itself", expr, t)
+	}
+
+	switch t.Kind() {
+	case reflect.Uint8:
+		g.printf("%v = %v\n", expr, convert(t, "p.uint8()"))
+	case reflect.Uint16:
+		g.printf("%v = %v\n", expr, convert(t, "p.uint16()"))
+	case reflect.Uint32:
+		g.printf("%v = %v\n", expr, convert(t, "p.uint32()"))
+	case reflect.Uint64:
+		g.printf("%v = %v\n", expr, convert(t, "p.uint64()"))
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		g.printf("%v = %v(p.uint%v())\n", expr, typeName(t), t.Bits())
+
+	case reflect.String:
+		g.printf("%v = %v\n", expr, convert(t, "p.string()"))
+
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			g.printf("%v = %v\n", expr, convert(t, "p.bytes()"))
+			return
+		}
+
+		i := g.variable("i")
+		g.printf("%v = make(%v, p.uint16())\n", expr, typeName(t))
+		g.printf("for %v := range %v {\n", i, expr)
+		g.parseValue(fmt.Sprintf("%v[%v]", expr, i), t.Elem())
+		g.printf("}\n")
+
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			g.parseValue(expr+"."+f.Name, f.Type)
+		}
+
+	default:
+		log.Fatalf("field %v has unsupported type %v", expr, t)
+	}
+}
+
+func (g *generator) message(t reflect.Type) {
+	g.depth = 0
+	g.printf("// P9Append implements proto.Appender.\n")
+	g.printf("func (m *%v) P9Append(buf []byte) ([]byte, error) {\n", t.Name())
+	g.appendValue("m", t)
+	g.printf("return buf, nil\n}\n\n")
+
+	g.depth = 0
+	g.printf("// P9Parse implements proto.Parser.\n")
+	g.printf("func (m *%v) P9Parse(data []byte) error {\n", t.Name())
+	if t.NumField() == 0 {
+		g.printf("return nil\n}\n\n")
+		return
+	}
+	g.printf("p := parser{data: data}\n")
+	g.parseValue("m", t)
+	g.printf("return p.err\n}\n\n")
+}
+
+// sequence generates a P9Sequence method for messages that operate
+// on a FID.
+func (g *generator) sequence(t reflect.Type) {
+	f, ok := t.FieldByName("FID")
+	if !ok || (f.Type.Kind() != reflect.Uint32) {
+		return
+	}
+
+	g.printf("// P9Sequence implements proto.Sequencer.\n")
+	g.printf("func (m *%v) P9Sequence() uint32 {\nreturn m.FID\n}\n\n", t.Name())
+}
+
+func generate(w io.Writer) error {
+	g := &generator{}
+	for _, t := range messageTypes(p9.Proto(), p9.ProtoDotU(), p9.ProtoDotL()) {
+		g.sequence(t)
+		if custom(t) {
+			continue
+		}
+		g.message(t)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by msggen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package p9\n\n")
+	fmt.Fprintf(&buf, "import (\n\"encoding/binary\"\n")
+	if g.time {
+		fmt.Fprintf(&buf, "\"time\"\n")
+	}
+	fmt.Fprintf(&buf, ")\n\n")
+	g.buf.WriteTo(&buf)
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("format: %w\n%s", err, buf.Bytes())
+	}
+
+	_, err = w.Write(src)
+	return err
+}
+
+func main() {
+	out := flag.String("o", "msg_gen.go", "output file")
+	flag.Parse()
+
+	var buf bytes.Buffer
+	err := generate(&buf)
+	if err != nil {
+		log.Fatalf("generate: %v", err)
+	}
+
+	err = os.WriteFile(*out, buf.Bytes(), 0644)
+	if err != nil {
+		log.Fatalf("write: %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package p9
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+// IOFS returns a read-only FileSystem that serves the files in fsys.
+// Like Dir, it accepts attachments of either "" or "/", but rejects
+// all others, and does not support authentication.
+//
+// Directories are read using fs.ReadDir, so fsys may implement
+// fs.ReadDirFS to speed that up. Files that implement io.ReaderAt are
+// read using it. Other files are read sequentially, using io.Seeker
+// to jump to the requested offset if they implement it, and otherwise
+// skipping forwards or reopening the file as necessary.
+//
+// QIDs are derived from the path of each file, with the version
+// derived from the file's modification time.
+func IOFS(fsys fs.FS) FileSystem {
+	return ioFS{fsys: fsys}
+}
+
+type ioFS struct {
+	fsys fs.FS
+}
+
+// name converts a path passed to an Attachment into a name for use
+// with fsys.
+func (fsys ioFS) name(p string) string {
+	p = strings.TrimPrefix(path.Clean(p), "/")
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+func (fsys ioFS) Auth(user, aname string) (File, error) {
+	return nil, errors.New("auth not supported")
+}
+
+func (fsys ioFS) Attach(afile File, user, aname string) (Attachment, error) {
+	switch aname {
+	case "", "/":
+		return fsys, nil
+	}
+
+	return nil, errors.New("unknown attachment")
+}
+
+func (fsys ioFS) Stat(p string) (DirEntry, error) {
+	fi, err := fs.Stat(fsys.fsys, fsys.name(p))
+	if err != nil {
+		return DirEntry{}, err
+	}
+
+	e := infoToEntry(fi)
+	if e.EntryName == "." {
+		e.EntryName = ""
+	}
+
+	return e, nil
+}
+
+func (fsys ioFS) GetQID(p string) (QID, error) {
+	stat, err := fsys.Stat(p)
+	if err != nil {
+		return QID{}, err
+	}
+
+	return pathQID(p, stat), nil
+}
+
+func (fsys ioFS) WriteStat(p string, changes StatChanges) error {
+	return errors.New("read-only filesystem")
+}
+
+func (fsys ioFS) Open(p string, mode uint8) (File, error) {
+	if mode&(OWRITE|ORDWR|OTRUNC|ORCLOSE) != 0 {
+		return nil, errors.New("read-only filesystem")
+	}
+
+	name := fsys.name(p)
+	file, err := fsys.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ioFile{
+		fsys: fsys.fsys,
+		name: name,
+		file: file,
+	}, nil
+}
+
+func (fsys ioFS) Create(p string, perm FileMode, mode uint8) (File, error) {
+	return nil, errors.New("read-only filesystem")
+}
+
+func (fsys ioFS) Remove(p string) error {
+	return errors.New("read-only filesystem")
+}
+
+// ioFile is a File that wraps an fs.File.
+type ioFile struct {
+	fsys fs.FS
+	name string
+
+	m    sync.Mutex
+	file fs.File
+	off  int64
+}
+
+func (f *ioFile) ReadAt(buf []byte, off int64) (int, error) {
+	if r, ok := f.file.(io.ReaderAt); ok {
+		return r.ReadAt(buf, off)
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	err := f.seek(off)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := f.file.Read(buf)
+	f.off += int64(n)
+	return n, err
+}
+
+// seek moves the position of the underlying file to off.
+func (f *ioFile) seek(off int64) error {
+	if off == f.off {
+		return nil
+	}
+
+	if s, ok := f.file.(io.Seeker); ok {
+		_, err := s.Seek(off, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		f.off = off
+		return nil
+	}
+
+	if off < f.off {
+		file, err := f.fsys.Open(f.name)
+		if err != nil {
+			return err
+		}
+		f.file.Close()
+		f.file = file
+		f.off = 0
+	}
+
+	n, err := io.CopyN(io.Discard, f.file, off-f.off)
+	f.off += n
+	if err == io.EOF {
+		// Reading past the end is not an error. The next read will
+		// simply return io.EOF.
+		return nil
+	}
+	return err
+}
+
+func (f *ioFile) WriteAt(data []byte, off int64) (int, error) {
+	return 0, errors.New("read-only filesystem")
+}
+
+func (f *ioFile) Close() error {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	return f.file.Close()
+}
+
+func (f *ioFile) Readdir() ([]DirEntry, error) {
+	dir, err := fs.ReadDir(f.fsys, f.name)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]DirEntry, 0, len(dir))
+	for _, d := range dir {
+		fi, err := d.Info()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, infoToEntry(fi))
+	}
+	return entries, nil
+}
@@ -0,0 +1,81 @@
+package p9_test
+
+import (
+	"io/fs"
+	"net"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DeedleFake/p9"
+	"github.com/DeedleFake/p9/proto"
+)
+
+// sequentialFS hides the io.ReaderAt and io.Seeker implementations of
+// the files in an fs.FS.
+type sequentialFS struct {
+	fs.FS
+}
+
+func (fsys sequentialFS) Open(name string) (fs.File, error) {
+	file, err := fsys.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := file.(fs.ReadDirFile); ok {
+		return file, nil
+	}
+	return struct{ fs.File }{file}, nil
+}
+
+func TestIOFS(t *testing.T) {
+	mapfs := fstest.MapFS{
+		"a":         {Data: []byte("This is a test.")},
+		"dir/b":     {Data: []byte("This is also a test.")},
+		"dir/sub/c": {Data: []byte("And so is this.")},
+	}
+
+	tests := []struct {
+		name string
+		fsys fs.FS
+	}{
+		{name: "ReaderAt", fsys: mapfs},
+		{name: "Sequential", fsys: sequentialFS{mapfs}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer lis.Close()
+			go proto.Serve(lis, p9.Proto(), p9.FSConnHandler(p9.IOFS(test.fsys), 8192))
+
+			c, err := p9.Dial("tcp", lis.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			_, err = c.Handshake(8192)
+			if err != nil {
+				t.Fatal(err)
+			}
+			root, err := c.Attach(nil, "test", "/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer root.Close()
+
+			err = fstest.TestFS(p9.RemoteFS(root), "a", "dir/b", "dir/sub/c")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = root.Create("new", 0644, p9.OWRITE)
+			if err == nil {
+				t.Fatal("Created file in read-only filesystem")
+			}
+		})
+	}
+}
@@ -0,0 +1,475 @@
+package p9
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemFS is an implementation of FileSystem that keeps its files in
+// memory. Like Dir, it accepts attachments of either "" or "/", but
+// rejects all others, and does not support authentication. Files and
+// directories created by a client are owned by the user that the
+// client attached as.
+//
+// The zero value of MemFS is an empty filesystem ready for use. A
+// MemFS must not be copied after first use. It is safe for concurrent
+// use.
+//
+// Files created with ModeAppend set are always written to at the end,
+// regardless of the offset requested. Files created with
+// ModeExclusive set can only be open once at a time. Permissions are
+// not checked.
+//
+// Files can not grow beyond MaxFileSize. Attempts to write beyond it,
+// or to truncate a file to a larger length, fail.
+type MemFS struct {
+	// MaxFileSize is the maximum size of a file in bytes. If it is
+	// zero, files are limited to 1 GiB.
+	MaxFileSize int64
+
+	m        sync.RWMutex
+	root     *memNode
+	nextPath uint64
+}
+
+// errFileTooLarge is returned when a file in a MemFS would grow
+// beyond its MaxFileSize.
+var errFileTooLarge = errors.New("file too large")
+
+// maxFileSize returns the maximum size of a file.
+func (fsys *MemFS) maxFileSize() int64 {
+	if fsys.MaxFileSize <= 0 {
+		return 1 << 30
+	}
+	return fsys.MaxFileSize
+}
+
+// memNode is a file or directory in a MemFS.
+type memNode struct {
+	entry    DirEntry
+	data     []byte
+	children map[string]*memNode
+
+	// open is the number of times that the file is currently open.
+	open int
+}
+
+// newNode creates a new node with a unique path. fs.m must be held.
+func (fsys *MemFS) newNode(name string, mode FileMode, user string) *memNode {
+	now := time.Now()
+	n := &memNode{
+		entry: DirEntry{
+			FileMode:  mode,
+			ATime:     now,
+			MTime:     now,
+			EntryName: name,
+			UID:       user,
+			GID:       user,
+			MUID:      user,
+			NUID:      NoUID,
+			NGID:      NoUID,
+			NMUID:     NoUID,
+			Path:      fsys.nextPath,
+		},
+	}
+	if mode&ModeDir != 0 {
+		n.children = make(map[string]*memNode)
+	}
+
+	fsys.nextPath++
+	return n
+}
+
+// init initializes the root directory if necessary. fs.m must be held
+// for writing.
+func (fsys *MemFS) init() {
+	if fsys.root == nil {
+		fsys.root = fsys.newNode("/", ModeDir|0777, "")
+	}
+}
+
+// lookup finds the node at p. fs.m must be held.
+func (fsys *MemFS) lookup(p string) (*memNode, error) {
+	n := fsys.root
+	if n == nil {
+		return nil, errors.New("memfs not initialized")
+	}
+
+	for _, name := range strings.Split(strings.Trim(path.Clean(p), "/"), "/") {
+		if name == "" {
+			continue
+		}
+		if n.children == nil {
+			return nil, &fs.PathError{Op: "walk", Path: p, Err: errors.New("not a directory")}
+		}
+
+		next, ok := n.children[name]
+		if !ok {
+			return nil, &fs.PathError{Op: "walk", Path: p, Err: fs.ErrNotExist}
+		}
+		n = next
+	}
+
+	return n, nil
+}
+
+// modified records a modification of n by user.
+func (n *memNode) modified(user string) {
+	n.entry.MTime = time.Now()
+	n.entry.MUID = user
+	n.entry.Version++
+}
+
+// stat returns the DirEntry for n. fs.m must be held.
+func (n *memNode) stat() DirEntry {
+	e := n.entry
+	e.Length = uint64(len(n.data))
+	if n.children != nil {
+		e.Length = 0
+	}
+	return e
+}
+
+// Auth implements FileSystem.Auth.
+func (fsys *MemFS) Auth(user, aname string) (File, error) {
+	return nil, errors.New("auth not supported")
+}
+
+// Attach implements FileSystem.Attach.
+func (fsys *MemFS) Attach(afile File, user, aname string) (Attachment, error) {
+	switch aname {
+	case "", "/":
+	default:
+		return nil, errors.New("unknown attachment")
+	}
+
+	fsys.m.Lock()
+	defer fsys.m.Unlock()
+
+	fsys.init()
+	return &memAttachment{fs: fsys, user: user}, nil
+}
+
+// memAttachment is an Attachment to a MemFS for a specific user.
+type memAttachment struct {
+	fs   *MemFS
+	user string
+}
+
+func (a *memAttachment) Stat(p string) (DirEntry, error) {
+	a.fs.m.RLock()
+	defer a.fs.m.RUnlock()
+
+	n, err := a.fs.lookup(p)
+	if err != nil {
+		return DirEntry{}, err
+	}
+	return n.stat(), nil
+}
+
+func (a *memAttachment) GetQID(p string) (QID, error) {
+	a.fs.m.RLock()
+	defer a.fs.m.RUnlock()
+
+	n, err := a.fs.lookup(p)
+	if err != nil {
+		return QID{}, err
+	}
+
+	return QID{
+		Type:    n.entry.FileMode.QIDType(),
+		Version: n.entry.Version,
+		Path:    n.entry.Path,
+	}, nil
+}
+
+// IOUnit returns 0, as writes to a MemFS are atomic regardless of
+// their size. This tells clients that any write that fits into a
+// single message is atomic.
+func (a *memAttachment) IOUnit() uint32 {
+	return 0
+}
+
+func (a *memAttachment) WriteStat(p string, changes StatChanges) error {
+	a.fs.m.Lock()
+	defer a.fs.m.Unlock()
+
+	n, err := a.fs.lookup(p)
+	if err != nil {
+		return err
+	}
+
+	// Check everything before changing anything so that a failed
+	// request has no effect.
+	name, rename := changes.Name()
+	rename = rename && (name != n.entry.EntryName)
+	var parent *memNode
+	if rename {
+		if (n == a.fs.root) || strings.Contains(name, "/") || (name == ".") || (name == "..") {
+			return &fs.PathError{Op: "wstat", Path: p, Err: fs.ErrInvalid}
+		}
+
+		parent, err = a.fs.lookup(path.Dir(path.Clean(p)))
+		if err != nil {
+			return err
+		}
+		if _, ok := parent.children[name]; ok {
+			return &fs.PathError{Op: "wstat", Path: p, Err: fs.ErrExist}
+		}
+	}
+
+	mode, chmod := changes.Mode()
+	if chmod && (mode&ModeDir != n.entry.FileMode&ModeDir) {
+		return &fs.PathError{Op: "wstat", Path: p, Err: errors.New("can't change directory bit")}
+	}
+
+	length, truncate := changes.Length()
+	if truncate && (n.children != nil) && (length != 0) {
+		return &fs.PathError{Op: "wstat", Path: p, Err: errors.New("is a directory")}
+	}
+	if truncate && (length > uint64(a.fs.maxFileSize())) {
+		return &fs.PathError{Op: "wstat", Path: p, Err: errFileTooLarge}
+	}
+
+	if rename {
+		delete(parent.children, n.entry.EntryName)
+		parent.children[name] = n
+		parent.modified(a.user)
+		n.entry.EntryName = name
+	}
+	if chmod {
+		n.entry.FileMode = mode
+	}
+	if truncate && (n.children == nil) && (length != uint64(len(n.data))) {
+		n.data = resize(n.data, int(length))
+		n.modified(a.user)
+	}
+	if atime, ok := changes.ATime(); ok {
+		n.entry.ATime = atime
+	}
+	if mtime, ok := changes.MTime(); ok {
+		n.entry.MTime = mtime
+	}
+	if uid, ok := changes.UID(); ok {
+		n.entry.UID = uid
+	}
+	if gid, ok := changes.GID(); ok {
+		n.entry.GID = gid
+	}
+	if nuid, ok := changes.NUID(); ok {
+		n.entry.NUID = nuid
+	}
+	if ngid, ok := changes.NGID(); ok {
+		n.entry.NGID = ngid
+	}
+
+	return nil
+}
+
+// resize returns data resized to length, zeroing any new bytes.
+func resize(data []byte, length int) []byte {
+	if length <= len(data) {
+		return data[:length]
+	}
+	return append(data, make([]byte, length-len(data))...)
+}
+
+func (a *memAttachment) Open(p string, mode uint8) (File, error) {
+	a.fs.m.Lock()
+	defer a.fs.m.Unlock()
+
+	n, err := a.fs.lookup(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.open(n, p, mode)
+}
+
+// open opens n. fs.m must be held for writing.
+func (a *memAttachment) open(n *memNode, p string, mode uint8) (File, error) {
+	write := (mode&3 == OWRITE) || (mode&3 == ORDWR)
+	if (n.children != nil) && (write || (mode&OTRUNC != 0)) {
+		return nil, &fs.PathError{Op: "open", Path: p, Err: errors.New("is a directory")}
+	}
+	if (n.entry.FileMode&ModeExclusive != 0) && (n.open > 0) {
+		return nil, &fs.PathError{Op: "open", Path: p, Err: errors.New("exclusive use file already open")}
+	}
+
+	if (mode&OTRUNC != 0) && (len(n.data) > 0) {
+		n.data = n.data[:0]
+		n.modified(a.user)
+	}
+	n.entry.ATime = time.Now()
+	n.open++
+
+	return &memFile{
+		fs:   a.fs,
+		node: n,
+		user: a.user,
+		mode: mode,
+	}, nil
+}
+
+func (a *memAttachment) Create(p string, perm FileMode, mode uint8) (File, error) {
+	a.fs.m.Lock()
+	defer a.fs.m.Unlock()
+
+	p = path.Clean(p)
+	dir, name := path.Split(p)
+	parent, err := a.fs.lookup(dir)
+	if err != nil {
+		return nil, err
+	}
+	if parent.children == nil {
+		return nil, &fs.PathError{Op: "create", Path: p, Err: errors.New("not a directory")}
+	}
+	if _, ok := parent.children[name]; ok {
+		return nil, &fs.PathError{Op: "create", Path: p, Err: fs.ErrExist}
+	}
+
+	// As in Plan 9, the permissions of new files are limited by those
+	// of the directory that they are created in.
+	mask := FileMode(0666)
+	if perm&ModeDir != 0 {
+		mask = 0777
+	}
+	perm &= ^mask | (parent.entry.FileMode & mask)
+
+	n := a.fs.newNode(name, perm&(ModeDir|ModeAppend|ModeExclusive|ModeTemporary|0777), a.user)
+	parent.children[name] = n
+	parent.modified(a.user)
+
+	return a.open(n, p, mode)
+}
+
+func (a *memAttachment) Remove(p string) error {
+	a.fs.m.Lock()
+	defer a.fs.m.Unlock()
+
+	n, err := a.fs.lookup(p)
+	if err != nil {
+		return err
+	}
+	if n == a.fs.root {
+		return &fs.PathError{Op: "remove", Path: p, Err: fs.ErrPermission}
+	}
+	if len(n.children) != 0 {
+		return &fs.PathError{Op: "remove", Path: p, Err: errors.New("directory not empty")}
+	}
+
+	parent, err := a.fs.lookup(path.Dir(path.Clean(p)))
+	if err != nil {
+		return err
+	}
+	delete(parent.children, n.entry.EntryName)
+	parent.modified(a.user)
+
+	return nil
+}
+
+// memFile is an open file in a MemFS.
+type memFile struct {
+	fs   *MemFS
+	node *memNode
+	user string
+	mode uint8
+
+	closed bool
+}
+
+func (f *memFile) ReadAt(buf []byte, off int64) (int, error) {
+	if f.mode&3 == OWRITE {
+		return 0, errors.New("file not open for reading")
+	}
+
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	f.fs.m.RLock()
+	defer f.fs.m.RUnlock()
+
+	if off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(buf, f.node.data[off:])
+	if n < len(buf) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) WriteAt(data []byte, off int64) (int, error) {
+	if (f.mode&3 != OWRITE) && (f.mode&3 != ORDWR) {
+		return 0, errors.New("file not open for writing")
+	}
+
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	f.fs.m.Lock()
+	defer f.fs.m.Unlock()
+
+	if f.node.entry.FileMode&ModeAppend != 0 {
+		off = int64(len(f.node.data))
+	}
+
+	if (off > f.fs.maxFileSize()) || (int64(len(data)) > f.fs.maxFileSize()-off) {
+		return 0, errFileTooLarge
+	}
+
+	end := int(off) + len(data)
+	if end > len(f.node.data) {
+		f.node.data = resize(f.node.data, end)
+	}
+	copy(f.node.data[off:], data)
+	f.node.modified(f.user)
+
+	return len(data), nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.m.Lock()
+	defer f.fs.m.Unlock()
+
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	f.node.open--
+
+	return nil
+}
+
+func (f *memFile) Readdir() ([]DirEntry, error) {
+	f.fs.m.RLock()
+	defer f.fs.m.RUnlock()
+
+	if f.node.children == nil {
+		return nil, errors.New("not a directory")
+	}
+
+	entries := make([]DirEntry, 0, len(f.node.children))
+	for _, n := range f.node.children {
+		entries = append(entries, n.stat())
+	}
+	slices.SortFunc(entries, func(e1, e2 DirEntry) int {
+		return strings.Compare(e1.EntryName, e2.EntryName)
+	})
+	return entries, nil
+}
+
+var (
+	_ FileSystem = (*MemFS)(nil)
+	_ QIDFS      = (*memAttachment)(nil)
+	_ IOUnitFS   = (*memAttachment)(nil)
+)
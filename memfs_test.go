@@ -0,0 +1,275 @@
+package p9_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DeedleFake/p9"
+	"github.com/DeedleFake/p9/proto"
+)
+
+// unsetTime is the value used in wstat requests for times that should
+// not be changed.
+var unsetTime = time.Unix(-1, 0)
+
+func TestMemFS(t *testing.T) {
+	var fsys p9.MemFS
+	a, err := fsys.Attach(nil, "test", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(t *testing.T, p string, perm p9.FileMode, data string) {
+		t.Helper()
+
+		file, err := a.Create(p, perm, p9.OWRITE)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		_, err = file.WriteAt([]byte(data), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(t *testing.T, p string) string {
+		t.Helper()
+
+		file, err := a.Open(p, p9.OREAD)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		buf := make([]byte, 64)
+		n, err := file.ReadAt(buf, 0)
+		if (err != nil) && (err != io.EOF) {
+			t.Fatal(err)
+		}
+		return string(buf[:n])
+	}
+	qid := func(t *testing.T, p string) p9.QID {
+		t.Helper()
+
+		qid, err := a.(p9.QIDFS).GetQID(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return qid
+	}
+
+	t.Run("Versions", func(t *testing.T) {
+		write(t, "/versions", 0644, "one")
+		q1 := qid(t, "/versions")
+
+		file, err := a.Open("/versions", p9.OWRITE)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = file.WriteAt([]byte("two"), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+
+		q2 := qid(t, "/versions")
+		if (q1.Path != q2.Path) || (q2.Version <= q1.Version) {
+			t.Errorf("Expected version increase but got %v then %v", q1, q2)
+		}
+	})
+
+	t.Run("Append", func(t *testing.T) {
+		write(t, "/append", p9.ModeAppend|0644, "abc")
+		file, err := a.Open("/append", p9.OWRITE)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = file.WriteAt([]byte("def"), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+
+		if data := read(t, "/append"); data != "abcdef" {
+			t.Errorf("Expected %q but got %q", "abcdef", data)
+		}
+	})
+
+	t.Run("Exclusive", func(t *testing.T) {
+		file, err := a.Create("/excl", p9.ModeExclusive|0644, p9.OREAD)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = a.Open("/excl", p9.OREAD)
+		if err == nil {
+			t.Fatal("Opened exclusive use file twice")
+		}
+		file.Close()
+		file, err = a.Open("/excl", p9.OREAD)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+	})
+
+	t.Run("WriteStat", func(t *testing.T) {
+		write(t, "/old", 0644, "some data")
+
+		changes := p9.StatChanges{DirEntry: p9.DirEntry{
+			FileMode:  0600,
+			ATime:     unsetTime,
+			MTime:     unsetTime,
+			Length:    4,
+			EntryName: "new",
+			UID:       "other",
+			NUID:      p9.NoUID,
+			NGID:      p9.NoUID,
+		}}
+		err := a.WriteStat("/old", changes)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = a.Stat("/old")
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Expected fs.ErrNotExist but got %v", err)
+		}
+		stat, err := a.Stat("/new")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (stat.FileMode != 0600) || (stat.Length != 4) || (stat.UID != "other") || (stat.GID != "test") {
+			t.Errorf("Unexpected stat: %#v", stat)
+		}
+		if data := read(t, "/new"); data != "some" {
+			t.Errorf("Expected %q but got %q", "some", data)
+		}
+
+		write(t, "/taken", 0644, "")
+		changes.DirEntry.EntryName = "taken"
+		changes.DirEntry.Length = 0
+		err = a.WriteStat("/new", changes)
+		if !errors.Is(err, fs.ErrExist) {
+			t.Errorf("Expected fs.ErrExist but got %v", err)
+		}
+		if data := read(t, "/new"); data != "some" {
+			t.Errorf("Failed rename had side effects: %q", data)
+		}
+	})
+
+	t.Run("Bounds", func(t *testing.T) {
+		file, err := a.Create("/bounds", 0644, p9.ORDWR)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		_, err = file.ReadAt(make([]byte, 1), -1<<63)
+		if err == nil {
+			t.Error("Read at a negative offset succeeded")
+		}
+		_, err = file.WriteAt([]byte("x"), 1<<62)
+		if err == nil {
+			t.Error("Write at a huge offset succeeded")
+		}
+
+		changes := p9.StatChanges{DirEntry: p9.DirEntry{
+			FileMode: 0xFFFFFFFF,
+			ATime:    unsetTime,
+			MTime:    unsetTime,
+			Length:   1 << 62,
+			NUID:     p9.NoUID,
+			NGID:     p9.NoUID,
+			NMUID:    p9.NoUID,
+		}}
+		err = a.WriteStat("/bounds", changes)
+		if err == nil {
+			t.Error("Truncate to a huge length succeeded")
+		}
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		_, err := a.Create("/dir", p9.ModeDir|0755, p9.OREAD)
+		if err != nil {
+			t.Fatal(err)
+		}
+		write(t, "/dir/file", 0644, "")
+
+		err = a.Remove("/dir")
+		if err == nil {
+			t.Fatal("Removed non-empty directory")
+		}
+		err = a.Remove("/dir/file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = a.Remove("/dir")
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestMemFSRemote(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go proto.Serve(lis, p9.Proto(), p9.FSConnHandler(new(p9.MemFS), 8192))
+
+	c, err := p9.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err = c.Handshake(8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := c.Attach(nil, "test", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	dir, err := root.Create("dir", p9.ModeDir|0755, p9.OREAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir.Close()
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"a", "b", "dir/c", "dir/d"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			file, err := root.Create(name, 0644, p9.ORDWR)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer file.Close()
+
+			_, err = file.WriteAt([]byte("This is "+name+"."), 0)
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	err = fstest.TestFS(p9.RemoteFS(root), "a", "b", "dir/c", "dir/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,6 +2,7 @@ package p9
 
 import (
 	"bytes"
+	"encoding/binary"
 	"io"
 	"reflect"
 
@@ -71,11 +72,58 @@ var protocol = proto.NewProto(map[uint8]reflect.Type{
 	RwstatType:   reflect.TypeOf(Rwstat{}),
 })
 
+var protocolDotU = proto.NewProto(map[uint8]reflect.Type{
+	TversionType: reflect.TypeOf(Tversion{}),
+	RversionType: reflect.TypeOf(Rversion{}),
+	TauthType:    reflect.TypeOf(TauthDotU{}),
+	RauthType:    reflect.TypeOf(Rauth{}),
+	TattachType:  reflect.TypeOf(TattachDotU{}),
+	RattachType:  reflect.TypeOf(Rattach{}),
+	RerrorType:   reflect.TypeOf(RerrorDotU{}),
+	TflushType:   reflect.TypeOf(Tflush{}),
+	RflushType:   reflect.TypeOf(Rflush{}),
+	TwalkType:    reflect.TypeOf(Twalk{}),
+	RwalkType:    reflect.TypeOf(Rwalk{}),
+	TopenType:    reflect.TypeOf(Topen{}),
+	RopenType:    reflect.TypeOf(Ropen{}),
+	TcreateType:  reflect.TypeOf(TcreateDotU{}),
+	RcreateType:  reflect.TypeOf(Rcreate{}),
+	TreadType:    reflect.TypeOf(Tread{}),
+	RreadType:    reflect.TypeOf(Rread{}),
+	TwriteType:   reflect.TypeOf(Twrite{}),
+	RwriteType:   reflect.TypeOf(Rwrite{}),
+	TclunkType:   reflect.TypeOf(Tclunk{}),
+	RclunkType:   reflect.TypeOf(Rclunk{}),
+	TremoveType:  reflect.TypeOf(Tremove{}),
+	RremoveType:  reflect.TypeOf(Rremove{}),
+	TstatType:    reflect.TypeOf(Tstat{}),
+	RstatType:    reflect.TypeOf(RstatDotU{}),
+	TwstatType:   reflect.TypeOf(TwstatDotU{}),
+	RwstatType:   reflect.TypeOf(Rwstat{}),
+})
+
 // Proto returns the protocol implementation for 9P.
 func Proto() proto.Proto {
 	return protocol
 }
 
+// ProtoDotU returns the protocol implementation for 9P2000.u.
+func ProtoDotU() proto.Proto {
+	return protocolDotU
+}
+
+// Dialects returns every dialect of the protocol that this package
+// supports, namely 9P2000, 9P2000.u, and 9P2000.L. It returns a new
+// map every time that it is called, so the result can be safely
+// modified.
+func Dialects() proto.Dialects {
+	return proto.Dialects{
+		Version:     Proto(),
+		VersionDotU: ProtoDotU(),
+		VersionDotL: ProtoDotL(),
+	}
+}
+
 type Tversion struct {
 	Msize   uint32
 	Version string
@@ -123,10 +171,21 @@ func (msg *Rerror) Error() string {
 	return msg.Ename
 }
 
+// Is allows errors.Is to match the error against fs.ErrNotExist,
+// fs.ErrPermission, fs.ErrExist, and errors.ErrUnsupported based on
+// the error string.
+func (msg *Rerror) Is(target error) bool {
+	return enameIs(msg.Ename, target)
+}
+
 type Tflush struct {
 	OldTag uint16
 }
 
+func (msg *Tflush) P9Flush() uint16 {
+	return msg.OldTag
+}
+
 type Rflush struct {
 }
 
@@ -172,6 +231,31 @@ type Rread struct {
 	Data []byte
 }
 
+// P9DecodeBuffer implements proto.BufferDecoder. If the data does not
+// fit into buf, a new buffer is allocated for it.
+func (msg *Rread) P9DecodeBuffer(r io.Reader, buf []byte) error {
+	var size [4]byte
+	_, err := io.ReadFull(r, size[:])
+	if err != nil {
+		return err
+	}
+	count := binary.LittleEndian.Uint32(size[:])
+
+	if uint64(count) > uint64(len(buf)) {
+		// Don't trust count for the allocation, as it could be much
+		// larger than the actual message.
+		msg.Data, err = io.ReadAll(io.LimitReader(r, int64(count)))
+		if (err == nil) && (uint32(len(msg.Data)) < count) {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	msg.Data = buf[:count]
+	_, err = io.ReadFull(r, msg.Data)
+	return err
+}
+
 type Twrite struct {
 	FID    uint32
 	Offset uint64
@@ -207,7 +291,7 @@ type Rstat struct {
 func (stat *Rstat) P9Encode() ([]byte, error) {
 	var buf bytes.Buffer
 
-	err := proto.Write(&buf, stat.Stat.size()+2)
+	err := proto.Write(&buf, stat.Stat.size(false)+2)
 	if err != nil {
 		return nil, err
 	}
@@ -245,7 +329,7 @@ func (stat *Twstat) P9Encode() ([]byte, error) {
 		return nil, err
 	}
 
-	err = proto.Write(&buf, stat.Stat.size()+2)
+	err = proto.Write(&buf, stat.Stat.size(false)+2)
 	if err != nil {
 		return nil, err
 	}
@@ -277,3 +361,119 @@ func (stat *Twstat) P9Decode(r io.Reader) error {
 
 type Rwstat struct {
 }
+
+// TauthDotU is the 9P2000.u variant of Tauth.
+type TauthDotU struct {
+	Tauth
+	NUname uint32
+}
+
+// TattachDotU is the 9P2000.u variant of Tattach.
+type TattachDotU struct {
+	Tattach
+	NUname uint32
+}
+
+// RerrorDotU is the 9P2000.u variant of Rerror. Like Rerror, it
+// implements error.
+type RerrorDotU struct {
+	Rerror
+	Errno uint32
+}
+
+// Is is like Rerror's Is method, but uses the error number if there
+// is one.
+func (msg *RerrorDotU) Is(target error) bool {
+	if msg.Errno != 0 {
+		return errnoIs(msg.Errno, target)
+	}
+	return msg.Rerror.Is(target)
+}
+
+// TcreateDotU is the 9P2000.u variant of Tcreate. Extension is used
+// to provide extra information when creating special files:
+//
+//   - The target of the link for symlinks.
+//   - The FID of the file to link to, in decimal, for hard links.
+//   - "b major minor" or "c major minor" for devices.
+type TcreateDotU struct {
+	Tcreate
+	Extension string
+}
+
+// RstatDotU is the 9P2000.u variant of Rstat.
+type RstatDotU struct {
+	Stat Stat
+}
+
+func (stat *RstatDotU) P9Encode() ([]byte, error) {
+	var buf bytes.Buffer
+
+	err := proto.Write(&buf, stat.Stat.size(true)+2)
+	if err != nil {
+		return nil, err
+	}
+
+	err = proto.Write(&buf, statDotU{&stat.Stat})
+	return buf.Bytes(), err
+}
+
+func (stat *RstatDotU) P9Decode(r io.Reader) error {
+	var size uint16
+	err := proto.Read(r, &size)
+	if err != nil {
+		return err
+	}
+
+	r = &util.LimitedReader{
+		R: r,
+		N: uint32(size),
+		E: ErrLargeStat,
+	}
+
+	return statDotU{&stat.Stat}.P9Decode(r)
+}
+
+// TwstatDotU is the 9P2000.u variant of Twstat.
+type TwstatDotU struct {
+	FID  uint32
+	Stat Stat
+}
+
+func (stat *TwstatDotU) P9Encode() ([]byte, error) {
+	var buf bytes.Buffer
+
+	err := proto.Write(&buf, stat.FID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = proto.Write(&buf, stat.Stat.size(true)+2)
+	if err != nil {
+		return nil, err
+	}
+
+	err = proto.Write(&buf, statDotU{&stat.Stat})
+	return buf.Bytes(), err
+}
+
+func (stat *TwstatDotU) P9Decode(r io.Reader) error {
+	err := proto.Read(r, &stat.FID)
+	if err != nil {
+		return err
+	}
+
+	var size uint16
+	err = proto.Read(r, &size)
+	if err != nil {
+		return err
+	}
+
+	r = &util.LimitedReader{
+		R: r,
+		N: uint32(size),
+		E: ErrLargeStat,
+	}
+
+	return statDotU{&stat.Stat}.P9Decode(r)
+}
@@ -0,0 +1,369 @@
+package p9
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/DeedleFake/p9/proto"
+)
+
+// Message type identifiers specific to 9P2000.L.
+const (
+	RlerrorType      uint8 = 7
+	TstatfsType      uint8 = 8
+	RstatfsType      uint8 = 9
+	TlopenType       uint8 = 12
+	RlopenType       uint8 = 13
+	TlcreateType     uint8 = 14
+	RlcreateType     uint8 = 15
+	TsymlinkType     uint8 = 16
+	RsymlinkType     uint8 = 17
+	TmknodType       uint8 = 18
+	RmknodType       uint8 = 19
+	TrenameType      uint8 = 20
+	RrenameType      uint8 = 21
+	TreadlinkType    uint8 = 22
+	RreadlinkType    uint8 = 23
+	TgetattrType     uint8 = 24
+	RgetattrType     uint8 = 25
+	TsetattrType     uint8 = 26
+	RsetattrType     uint8 = 27
+	TxattrwalkType   uint8 = 30
+	RxattrwalkType   uint8 = 31
+	TxattrcreateType uint8 = 32
+	RxattrcreateType uint8 = 33
+	TreaddirType     uint8 = 40
+	RreaddirType     uint8 = 41
+	TfsyncType       uint8 = 50
+	RfsyncType       uint8 = 51
+	TlockType        uint8 = 52
+	RlockType        uint8 = 53
+	TgetlockType     uint8 = 54
+	RgetlockType     uint8 = 55
+	TlinkType        uint8 = 70
+	RlinkType        uint8 = 71
+	TmkdirType       uint8 = 72
+	RmkdirType       uint8 = 73
+	TrenameatType    uint8 = 74
+	RrenameatType    uint8 = 75
+	TunlinkatType    uint8 = 76
+	RunlinkatType    uint8 = 77
+)
+
+var protocolDotL = proto.NewProto(map[uint8]reflect.Type{
+	TversionType:     reflect.TypeOf(Tversion{}),
+	RversionType:     reflect.TypeOf(Rversion{}),
+	TauthType:        reflect.TypeOf(TauthDotU{}),
+	RauthType:        reflect.TypeOf(Rauth{}),
+	TattachType:      reflect.TypeOf(TattachDotU{}),
+	RattachType:      reflect.TypeOf(Rattach{}),
+	TflushType:       reflect.TypeOf(Tflush{}),
+	RflushType:       reflect.TypeOf(Rflush{}),
+	TwalkType:        reflect.TypeOf(Twalk{}),
+	RwalkType:        reflect.TypeOf(Rwalk{}),
+	TreadType:        reflect.TypeOf(Tread{}),
+	RreadType:        reflect.TypeOf(Rread{}),
+	TwriteType:       reflect.TypeOf(Twrite{}),
+	RwriteType:       reflect.TypeOf(Rwrite{}),
+	TclunkType:       reflect.TypeOf(Tclunk{}),
+	RclunkType:       reflect.TypeOf(Rclunk{}),
+	TremoveType:      reflect.TypeOf(Tremove{}),
+	RremoveType:      reflect.TypeOf(Rremove{}),
+	RlerrorType:      reflect.TypeOf(Rlerror{}),
+	TstatfsType:      reflect.TypeOf(Tstatfs{}),
+	RstatfsType:      reflect.TypeOf(Rstatfs{}),
+	TlopenType:       reflect.TypeOf(Tlopen{}),
+	RlopenType:       reflect.TypeOf(Rlopen{}),
+	TlcreateType:     reflect.TypeOf(Tlcreate{}),
+	RlcreateType:     reflect.TypeOf(Rlcreate{}),
+	TsymlinkType:     reflect.TypeOf(Tsymlink{}),
+	RsymlinkType:     reflect.TypeOf(Rsymlink{}),
+	TmknodType:       reflect.TypeOf(Tmknod{}),
+	RmknodType:       reflect.TypeOf(Rmknod{}),
+	TrenameType:      reflect.TypeOf(Trename{}),
+	RrenameType:      reflect.TypeOf(Rrename{}),
+	TreadlinkType:    reflect.TypeOf(Treadlink{}),
+	RreadlinkType:    reflect.TypeOf(Rreadlink{}),
+	TgetattrType:     reflect.TypeOf(Tgetattr{}),
+	RgetattrType:     reflect.TypeOf(Rgetattr{}),
+	TsetattrType:     reflect.TypeOf(Tsetattr{}),
+	RsetattrType:     reflect.TypeOf(Rsetattr{}),
+	TxattrwalkType:   reflect.TypeOf(Txattrwalk{}),
+	RxattrwalkType:   reflect.TypeOf(Rxattrwalk{}),
+	TxattrcreateType: reflect.TypeOf(Txattrcreate{}),
+	RxattrcreateType: reflect.TypeOf(Rxattrcreate{}),
+	TreaddirType:     reflect.TypeOf(Treaddir{}),
+	RreaddirType:     reflect.TypeOf(Rreaddir{}),
+	TfsyncType:       reflect.TypeOf(Tfsync{}),
+	RfsyncType:       reflect.TypeOf(Rfsync{}),
+	TlockType:        reflect.TypeOf(Tlock{}),
+	RlockType:        reflect.TypeOf(Rlock{}),
+	TgetlockType:     reflect.TypeOf(Tgetlock{}),
+	RgetlockType:     reflect.TypeOf(Rgetlock{}),
+	TlinkType:        reflect.TypeOf(Tlink{}),
+	RlinkType:        reflect.TypeOf(Rlink{}),
+	TmkdirType:       reflect.TypeOf(Tmkdir{}),
+	RmkdirType:       reflect.TypeOf(Rmkdir{}),
+	TrenameatType:    reflect.TypeOf(Trenameat{}),
+	RrenameatType:    reflect.TypeOf(Rrenameat{}),
+	TunlinkatType:    reflect.TypeOf(Tunlinkat{}),
+	RunlinkatType:    reflect.TypeOf(Runlinkat{}),
+})
+
+// ProtoDotL returns the protocol implementation for 9P2000.L. Note
+// that 9P2000.L uses the 9P2000.u variants of Tauth and Tattach, and
+// Rlerror instead of Rerror.
+func ProtoDotL() proto.Proto {
+	return protocolDotL
+}
+
+// Rlerror is the 9P2000.L replacement for Rerror. Ecode is a Linux
+// error number. Like Rerror, it implements error.
+type Rlerror struct {
+	Ecode uint32
+}
+
+func (msg *Rlerror) Error() string {
+	return fmt.Sprintf("remote error: errno %v", msg.Ecode)
+}
+
+// Is allows errors.Is to match the error against standard errors
+// based on the error number, in the same way as Rerror.
+func (msg *Rlerror) Is(target error) bool {
+	return errnoIs(msg.Ecode, target)
+}
+
+type Tstatfs struct {
+	FID uint32
+}
+
+type Rstatfs struct {
+	Type    uint32
+	BSize   uint32
+	Blocks  uint64
+	BFree   uint64
+	BAvail  uint64
+	Files   uint64
+	FFree   uint64
+	FSID    uint64
+	NameLen uint32
+}
+
+type Tlopen struct {
+	FID   uint32
+	Flags uint32
+}
+
+type Rlopen struct {
+	QID    QID
+	IOUnit uint32
+}
+
+type Tlcreate struct {
+	FID   uint32
+	Name  string
+	Flags uint32
+	Mode  uint32
+	GID   uint32
+}
+
+type Rlcreate struct {
+	QID    QID
+	IOUnit uint32
+}
+
+type Tsymlink struct {
+	FID    uint32
+	Name   string
+	Target string
+	GID    uint32
+}
+
+type Rsymlink struct {
+	QID QID
+}
+
+type Tmknod struct {
+	DFID  uint32
+	Name  string
+	Mode  uint32
+	Major uint32
+	Minor uint32
+	GID   uint32
+}
+
+type Rmknod struct {
+	QID QID
+}
+
+type Trename struct {
+	FID  uint32
+	DFID uint32
+	Name string
+}
+
+type Rrename struct {
+}
+
+type Treadlink struct {
+	FID uint32
+}
+
+type Rreadlink struct {
+	Target string
+}
+
+type Tgetattr struct {
+	FID         uint32
+	RequestMask uint64
+}
+
+type Rgetattr struct {
+	Valid       uint64
+	QID         QID
+	Mode        uint32
+	UID         uint32
+	GID         uint32
+	NLink       uint64
+	RDev        uint64
+	Size        uint64
+	BlkSize     uint64
+	Blocks      uint64
+	ATimeSec    uint64
+	ATimeNSec   uint64
+	MTimeSec    uint64
+	MTimeNSec   uint64
+	CTimeSec    uint64
+	CTimeNSec   uint64
+	BTimeSec    uint64
+	BTimeNSec   uint64
+	Gen         uint64
+	DataVersion uint64
+}
+
+type Tsetattr struct {
+	FID       uint32
+	Valid     uint32
+	Mode      uint32
+	UID       uint32
+	GID       uint32
+	Size      uint64
+	ATimeSec  uint64
+	ATimeNSec uint64
+	MTimeSec  uint64
+	MTimeNSec uint64
+}
+
+type Rsetattr struct {
+}
+
+type Txattrwalk struct {
+	FID    uint32
+	NewFID uint32
+	Name   string
+}
+
+type Rxattrwalk struct {
+	Size uint64
+}
+
+type Txattrcreate struct {
+	FID      uint32
+	Name     string
+	AttrSize uint64
+	Flags    uint32
+}
+
+type Rxattrcreate struct {
+}
+
+type Treaddir struct {
+	FID    uint32
+	Offset uint64
+	Count  uint32
+}
+
+// Rreaddir is the response to a Treaddir. Data holds a series of
+// encoded directory entries, each of which consists of a QID, the
+// offset of the next entry, a Linux directory entry type, and a name.
+type Rreaddir struct {
+	Data []byte
+}
+
+type Tfsync struct {
+	FID      uint32
+	DataSync uint32
+}
+
+type Rfsync struct {
+}
+
+type Tlock struct {
+	FID      uint32
+	Type     uint8
+	Flags    uint32
+	Start    uint64
+	Length   uint64
+	ProcID   uint32
+	ClientID string
+}
+
+type Rlock struct {
+	Status uint8
+}
+
+type Tgetlock struct {
+	FID      uint32
+	Type     uint8
+	Start    uint64
+	Length   uint64
+	ProcID   uint32
+	ClientID string
+}
+
+type Rgetlock struct {
+	Type     uint8
+	Start    uint64
+	Length   uint64
+	ProcID   uint32
+	ClientID string
+}
+
+type Tlink struct {
+	DFID uint32
+	FID  uint32
+	Name string
+}
+
+type Rlink struct {
+}
+
+type Tmkdir struct {
+	DFID uint32
+	Name string
+	Mode uint32
+	GID  uint32
+}
+
+type Rmkdir struct {
+	QID QID
+}
+
+type Trenameat struct {
+	OldDirFID uint32
+	OldName   string
+	NewDirFID uint32
+	NewName   string
+}
+
+type Rrenameat struct {
+}
+
+type Tunlinkat struct {
+	DirFID uint32
+	Name   string
+	Flags  uint32
+}
+
+type Runlinkat struct {
+}
@@ -0,0 +1,1325 @@
+// Code generated by msggen. DO NOT EDIT.
+
+package p9
+
+import (
+	"encoding/binary"
+)
+
+// P9Append implements proto.Appender.
+func (m *Rattach) P9Append(buf []byte) ([]byte, error) {
+	buf = append(buf, uint8(m.QID.Type))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.QID.Version))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.QID.Path))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rattach) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.QID.Type = QIDType(p.uint8())
+	m.QID.Version = p.uint32()
+	m.QID.Path = p.uint64()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Rauth) P9Append(buf []byte) ([]byte, error) {
+	buf = append(buf, uint8(m.AQID.Type))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.AQID.Version))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.AQID.Path))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rauth) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.AQID.Type = QIDType(p.uint8())
+	m.AQID.Version = p.uint32()
+	m.AQID.Path = p.uint64()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Rclunk) P9Append(buf []byte) ([]byte, error) {
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rclunk) P9Parse(data []byte) error {
+	return nil
+}
+
+// P9Append implements proto.Appender.
+func (m *Rcreate) P9Append(buf []byte) ([]byte, error) {
+	buf = append(buf, uint8(m.QID.Type))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.QID.Version))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.QID.Path))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.IOUnit))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rcreate) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.QID.Type = QIDType(p.uint8())
+	m.QID.Version = p.uint32()
+	m.QID.Path = p.uint64()
+	m.IOUnit = p.uint32()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Rerror) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Ename)))
+	buf = append(buf, m.Ename...)
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rerror) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.Ename = p.string()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *RerrorDotU) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Rerror.Ename)))
+	buf = append(buf, m.Rerror.Ename...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Errno))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *RerrorDotU) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.Rerror.Ename = p.string()
+	m.Errno = p.uint32()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Rflush) P9Append(buf []byte) ([]byte, error) {
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rflush) P9Parse(data []byte) error {
+	return nil
+}
+
+// P9Append implements proto.Appender.
+func (m *Rfsync) P9Append(buf []byte) ([]byte, error) {
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rfsync) P9Parse(data []byte) error {
+	return nil
+}
+
+// P9Append implements proto.Appender.
+func (m *Rgetattr) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.Valid))
+	buf = append(buf, uint8(m.QID.Type))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.QID.Version))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.QID.Path))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Mode))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.UID))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.GID))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.NLink))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.RDev))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.Size))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.BlkSize))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.Blocks))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.ATimeSec))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.ATimeNSec))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.MTimeSec))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.MTimeNSec))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.CTimeSec))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.CTimeNSec))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.BTimeSec))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.BTimeNSec))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.Gen))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.DataVersion))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rgetattr) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.Valid = p.uint64()
+	m.QID.Type = QIDType(p.uint8())
+	m.QID.Version = p.uint32()
+	m.QID.Path = p.uint64()
+	m.Mode = p.uint32()
+	m.UID = p.uint32()
+	m.GID = p.uint32()
+	m.NLink = p.uint64()
+	m.RDev = p.uint64()
+	m.Size = p.uint64()
+	m.BlkSize = p.uint64()
+	m.Blocks = p.uint64()
+	m.ATimeSec = p.uint64()
+	m.ATimeNSec = p.uint64()
+	m.MTimeSec = p.uint64()
+	m.MTimeNSec = p.uint64()
+	m.CTimeSec = p.uint64()
+	m.CTimeNSec = p.uint64()
+	m.BTimeSec = p.uint64()
+	m.BTimeNSec = p.uint64()
+	m.Gen = p.uint64()
+	m.DataVersion = p.uint64()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Rgetlock) P9Append(buf []byte) ([]byte, error) {
+	buf = append(buf, uint8(m.Type))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.Start))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.Length))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.ProcID))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.ClientID)))
+	buf = append(buf, m.ClientID...)
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rgetlock) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.Type = p.uint8()
+	m.Start = p.uint64()
+	m.Length = p.uint64()
+	m.ProcID = p.uint32()
+	m.ClientID = p.string()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Rlcreate) P9Append(buf []byte) ([]byte, error) {
+	buf = append(buf, uint8(m.QID.Type))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.QID.Version))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.QID.Path))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.IOUnit))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rlcreate) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.QID.Type = QIDType(p.uint8())
+	m.QID.Version = p.uint32()
+	m.QID.Path = p.uint64()
+	m.IOUnit = p.uint32()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Rlerror) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Ecode))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rlerror) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.Ecode = p.uint32()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Rlink) P9Append(buf []byte) ([]byte, error) {
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rlink) P9Parse(data []byte) error {
+	return nil
+}
+
+// P9Append implements proto.Appender.
+func (m *Rlock) P9Append(buf []byte) ([]byte, error) {
+	buf = append(buf, uint8(m.Status))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rlock) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.Status = p.uint8()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Rlopen) P9Append(buf []byte) ([]byte, error) {
+	buf = append(buf, uint8(m.QID.Type))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.QID.Version))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.QID.Path))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.IOUnit))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rlopen) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.QID.Type = QIDType(p.uint8())
+	m.QID.Version = p.uint32()
+	m.QID.Path = p.uint64()
+	m.IOUnit = p.uint32()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Rmkdir) P9Append(buf []byte) ([]byte, error) {
+	buf = append(buf, uint8(m.QID.Type))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.QID.Version))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.QID.Path))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rmkdir) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.QID.Type = QIDType(p.uint8())
+	m.QID.Version = p.uint32()
+	m.QID.Path = p.uint64()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Rmknod) P9Append(buf []byte) ([]byte, error) {
+	buf = append(buf, uint8(m.QID.Type))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.QID.Version))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.QID.Path))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rmknod) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.QID.Type = QIDType(p.uint8())
+	m.QID.Version = p.uint32()
+	m.QID.Path = p.uint64()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Ropen) P9Append(buf []byte) ([]byte, error) {
+	buf = append(buf, uint8(m.QID.Type))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.QID.Version))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.QID.Path))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.IOUnit))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Ropen) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.QID.Type = QIDType(p.uint8())
+	m.QID.Version = p.uint32()
+	m.QID.Path = p.uint64()
+	m.IOUnit = p.uint32()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Rread) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(m.Data)))
+	buf = append(buf, m.Data...)
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rread) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.Data = []uint8(p.bytes())
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Rreaddir) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(m.Data)))
+	buf = append(buf, m.Data...)
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rreaddir) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.Data = []uint8(p.bytes())
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Rreadlink) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Target)))
+	buf = append(buf, m.Target...)
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rreadlink) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.Target = p.string()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Rremove) P9Append(buf []byte) ([]byte, error) {
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rremove) P9Parse(data []byte) error {
+	return nil
+}
+
+// P9Append implements proto.Appender.
+func (m *Rrename) P9Append(buf []byte) ([]byte, error) {
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rrename) P9Parse(data []byte) error {
+	return nil
+}
+
+// P9Append implements proto.Appender.
+func (m *Rrenameat) P9Append(buf []byte) ([]byte, error) {
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rrenameat) P9Parse(data []byte) error {
+	return nil
+}
+
+// P9Append implements proto.Appender.
+func (m *Rsetattr) P9Append(buf []byte) ([]byte, error) {
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rsetattr) P9Parse(data []byte) error {
+	return nil
+}
+
+// P9Append implements proto.Appender.
+func (m *Rstatfs) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Type))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.BSize))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.Blocks))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.BFree))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.BAvail))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.Files))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.FFree))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.FSID))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.NameLen))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rstatfs) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.Type = p.uint32()
+	m.BSize = p.uint32()
+	m.Blocks = p.uint64()
+	m.BFree = p.uint64()
+	m.BAvail = p.uint64()
+	m.Files = p.uint64()
+	m.FFree = p.uint64()
+	m.FSID = p.uint64()
+	m.NameLen = p.uint32()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Rsymlink) P9Append(buf []byte) ([]byte, error) {
+	buf = append(buf, uint8(m.QID.Type))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.QID.Version))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.QID.Path))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rsymlink) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.QID.Type = QIDType(p.uint8())
+	m.QID.Version = p.uint32()
+	m.QID.Path = p.uint64()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Runlinkat) P9Append(buf []byte) ([]byte, error) {
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Runlinkat) P9Parse(data []byte) error {
+	return nil
+}
+
+// P9Append implements proto.Appender.
+func (m *Rversion) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Msize))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Version)))
+	buf = append(buf, m.Version...)
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rversion) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.Msize = p.uint32()
+	m.Version = p.string()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Rwalk) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.WQID)))
+	for _, v1 := range m.WQID {
+		buf = append(buf, uint8(v1.Type))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(v1.Version))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(v1.Path))
+	}
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rwalk) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.WQID = make([]QID, p.uint16())
+	for i1 := range m.WQID {
+		m.WQID[i1].Type = QIDType(p.uint8())
+		m.WQID[i1].Version = p.uint32()
+		m.WQID[i1].Path = p.uint64()
+	}
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Rwrite) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Count))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rwrite) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.Count = p.uint32()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Rwstat) P9Append(buf []byte) ([]byte, error) {
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rwstat) P9Parse(data []byte) error {
+	return nil
+}
+
+// P9Append implements proto.Appender.
+func (m *Rxattrcreate) P9Append(buf []byte) ([]byte, error) {
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rxattrcreate) P9Parse(data []byte) error {
+	return nil
+}
+
+// P9Append implements proto.Appender.
+func (m *Rxattrwalk) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.Size))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Rxattrwalk) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.Size = p.uint64()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Tattach) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Tattach) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.AFID))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Uname)))
+	buf = append(buf, m.Uname...)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Aname)))
+	buf = append(buf, m.Aname...)
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Tattach) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	m.AFID = p.uint32()
+	m.Uname = p.string()
+	m.Aname = p.string()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *TattachDotU) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *TattachDotU) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Tattach.FID))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Tattach.AFID))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Tattach.Uname)))
+	buf = append(buf, m.Tattach.Uname...)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Tattach.Aname)))
+	buf = append(buf, m.Tattach.Aname...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.NUname))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *TattachDotU) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.Tattach.FID = p.uint32()
+	m.Tattach.AFID = p.uint32()
+	m.Tattach.Uname = p.string()
+	m.Tattach.Aname = p.string()
+	m.NUname = p.uint32()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Tauth) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.AFID))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Uname)))
+	buf = append(buf, m.Uname...)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Aname)))
+	buf = append(buf, m.Aname...)
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Tauth) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.AFID = p.uint32()
+	m.Uname = p.string()
+	m.Aname = p.string()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *TauthDotU) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Tauth.AFID))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Tauth.Uname)))
+	buf = append(buf, m.Tauth.Uname...)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Tauth.Aname)))
+	buf = append(buf, m.Tauth.Aname...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.NUname))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *TauthDotU) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.Tauth.AFID = p.uint32()
+	m.Tauth.Uname = p.string()
+	m.Tauth.Aname = p.string()
+	m.NUname = p.uint32()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Tclunk) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Tclunk) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Tclunk) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Tcreate) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Tcreate) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Name)))
+	buf = append(buf, m.Name...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Perm))
+	buf = append(buf, uint8(m.Mode))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Tcreate) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	m.Name = p.string()
+	m.Perm = FileMode(p.uint32())
+	m.Mode = p.uint8()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *TcreateDotU) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *TcreateDotU) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Tcreate.FID))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Tcreate.Name)))
+	buf = append(buf, m.Tcreate.Name...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Tcreate.Perm))
+	buf = append(buf, uint8(m.Tcreate.Mode))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Extension)))
+	buf = append(buf, m.Extension...)
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *TcreateDotU) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.Tcreate.FID = p.uint32()
+	m.Tcreate.Name = p.string()
+	m.Tcreate.Perm = FileMode(p.uint32())
+	m.Tcreate.Mode = p.uint8()
+	m.Extension = p.string()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Tflush) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(m.OldTag))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Tflush) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.OldTag = p.uint16()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Tfsync) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Tfsync) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.DataSync))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Tfsync) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	m.DataSync = p.uint32()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Tgetattr) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Tgetattr) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.RequestMask))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Tgetattr) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	m.RequestMask = p.uint64()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Tgetlock) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Tgetlock) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	buf = append(buf, uint8(m.Type))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.Start))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.Length))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.ProcID))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.ClientID)))
+	buf = append(buf, m.ClientID...)
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Tgetlock) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	m.Type = p.uint8()
+	m.Start = p.uint64()
+	m.Length = p.uint64()
+	m.ProcID = p.uint32()
+	m.ClientID = p.string()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Tlcreate) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Tlcreate) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Name)))
+	buf = append(buf, m.Name...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Flags))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Mode))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.GID))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Tlcreate) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	m.Name = p.string()
+	m.Flags = p.uint32()
+	m.Mode = p.uint32()
+	m.GID = p.uint32()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Tlink) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Tlink) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.DFID))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Name)))
+	buf = append(buf, m.Name...)
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Tlink) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.DFID = p.uint32()
+	m.FID = p.uint32()
+	m.Name = p.string()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Tlock) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Tlock) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	buf = append(buf, uint8(m.Type))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Flags))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.Start))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.Length))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.ProcID))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.ClientID)))
+	buf = append(buf, m.ClientID...)
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Tlock) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	m.Type = p.uint8()
+	m.Flags = p.uint32()
+	m.Start = p.uint64()
+	m.Length = p.uint64()
+	m.ProcID = p.uint32()
+	m.ClientID = p.string()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Tlopen) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Tlopen) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Flags))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Tlopen) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	m.Flags = p.uint32()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Tmkdir) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.DFID))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Name)))
+	buf = append(buf, m.Name...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Mode))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.GID))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Tmkdir) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.DFID = p.uint32()
+	m.Name = p.string()
+	m.Mode = p.uint32()
+	m.GID = p.uint32()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Tmknod) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.DFID))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Name)))
+	buf = append(buf, m.Name...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Mode))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Major))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Minor))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.GID))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Tmknod) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.DFID = p.uint32()
+	m.Name = p.string()
+	m.Mode = p.uint32()
+	m.Major = p.uint32()
+	m.Minor = p.uint32()
+	m.GID = p.uint32()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Topen) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Topen) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	buf = append(buf, uint8(m.Mode))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Topen) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	m.Mode = p.uint8()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Tread) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Tread) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.Offset))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Count))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Tread) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	m.Offset = p.uint64()
+	m.Count = p.uint32()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Treaddir) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Treaddir) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.Offset))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Count))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Treaddir) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	m.Offset = p.uint64()
+	m.Count = p.uint32()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Treadlink) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Treadlink) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Treadlink) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Tremove) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Tremove) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Tremove) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Trename) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Trename) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.DFID))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Name)))
+	buf = append(buf, m.Name...)
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Trename) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	m.DFID = p.uint32()
+	m.Name = p.string()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Trenameat) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.OldDirFID))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.OldName)))
+	buf = append(buf, m.OldName...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.NewDirFID))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.NewName)))
+	buf = append(buf, m.NewName...)
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Trenameat) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.OldDirFID = p.uint32()
+	m.OldName = p.string()
+	m.NewDirFID = p.uint32()
+	m.NewName = p.string()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Tsetattr) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Tsetattr) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Valid))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Mode))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.UID))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.GID))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.Size))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.ATimeSec))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.ATimeNSec))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.MTimeSec))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.MTimeNSec))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Tsetattr) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	m.Valid = p.uint32()
+	m.Mode = p.uint32()
+	m.UID = p.uint32()
+	m.GID = p.uint32()
+	m.Size = p.uint64()
+	m.ATimeSec = p.uint64()
+	m.ATimeNSec = p.uint64()
+	m.MTimeSec = p.uint64()
+	m.MTimeNSec = p.uint64()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Tstat) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Tstat) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Tstat) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Tstatfs) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Tstatfs) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Tstatfs) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Tsymlink) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Tsymlink) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Name)))
+	buf = append(buf, m.Name...)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Target)))
+	buf = append(buf, m.Target...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.GID))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Tsymlink) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	m.Name = p.string()
+	m.Target = p.string()
+	m.GID = p.uint32()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Tunlinkat) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.DirFID))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Name)))
+	buf = append(buf, m.Name...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Flags))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Tunlinkat) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.DirFID = p.uint32()
+	m.Name = p.string()
+	m.Flags = p.uint32()
+	return p.err
+}
+
+// P9Append implements proto.Appender.
+func (m *Tversion) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Msize))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Version)))
+	buf = append(buf, m.Version...)
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Tversion) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.Msize = p.uint32()
+	m.Version = p.string()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Twalk) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Twalk) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.NewFID))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Wname)))
+	for _, v1 := range m.Wname {
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(len(v1)))
+		buf = append(buf, v1...)
+	}
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Twalk) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	m.NewFID = p.uint32()
+	m.Wname = make([]string, p.uint16())
+	for i1 := range m.Wname {
+		m.Wname[i1] = p.string()
+	}
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Twrite) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Twrite) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.Offset))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(m.Data)))
+	buf = append(buf, m.Data...)
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Twrite) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	m.Offset = p.uint64()
+	m.Data = []uint8(p.bytes())
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Twstat) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *TwstatDotU) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Txattrcreate) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Txattrcreate) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Name)))
+	buf = append(buf, m.Name...)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(m.AttrSize))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.Flags))
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Txattrcreate) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	m.Name = p.string()
+	m.AttrSize = p.uint64()
+	m.Flags = p.uint32()
+	return p.err
+}
+
+// P9Sequence implements proto.Sequencer.
+func (m *Txattrwalk) P9Sequence() uint32 {
+	return m.FID
+}
+
+// P9Append implements proto.Appender.
+func (m *Txattrwalk) P9Append(buf []byte) ([]byte, error) {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.FID))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(m.NewFID))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(m.Name)))
+	buf = append(buf, m.Name...)
+	return buf, nil
+}
+
+// P9Parse implements proto.Parser.
+func (m *Txattrwalk) P9Parse(data []byte) error {
+	p := parser{data: data}
+	m.FID = p.uint32()
+	m.NewFID = p.uint32()
+	m.Name = p.string()
+	return p.err
+}
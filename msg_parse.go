@@ -0,0 +1,73 @@
+package p9
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+//go:generate go run ./internal/cmd/msggen -o msg_gen.go
+
+// parser decodes the fields of a message from a buffer. It is used by
+// the generated P9Parse methods. Once an error has occurred, all
+// further reads return zero values.
+type parser struct {
+	data []byte
+	err  error
+}
+
+func (p *parser) next(n int) []byte {
+	if p.err != nil {
+		return nil
+	}
+
+	if len(p.data) < n {
+		p.data = nil
+		p.err = io.ErrUnexpectedEOF
+		return nil
+	}
+
+	buf := p.data[:n:n]
+	p.data = p.data[n:]
+	return buf
+}
+
+func (p *parser) uint8() uint8 {
+	buf := p.next(1)
+	if buf == nil {
+		return 0
+	}
+	return buf[0]
+}
+
+func (p *parser) uint16() uint16 {
+	buf := p.next(2)
+	if buf == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(buf)
+}
+
+func (p *parser) uint32() uint32 {
+	buf := p.next(4)
+	if buf == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(buf)
+}
+
+func (p *parser) uint64() uint64 {
+	buf := p.next(8)
+	if buf == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(buf)
+}
+
+func (p *parser) string() string {
+	return string(p.next(int(p.uint16())))
+}
+
+// bytes returns a slice of the underlying buffer, not a copy.
+func (p *parser) bytes() []byte {
+	return p.next(int(p.uint32()))
+}
@@ -2,9 +2,14 @@ package p9_test
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"reflect"
 	"testing"
 
 	"github.com/DeedleFake/p9"
+	"github.com/DeedleFake/p9/proto"
 )
 
 func TestWriteMessage(t *testing.T) {
@@ -26,3 +31,93 @@ func TestWriteMessage(t *testing.T) {
 	t.Logf("%#v", msg)
 	t.Log(tag)
 }
+
+// fill sets every field of v to a non-zero value derived from n.
+func fill(v reflect.Value, n int) {
+	switch v.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(n*31 + 7))
+	case reflect.String:
+		v.SetString(fmt.Sprintf("string %v", n))
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 3, 3))
+		for i := 0; i < v.Len(); i++ {
+			fill(v.Index(i), n+i)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			fill(v.Field(i), n+i)
+		}
+	}
+}
+
+func TestGeneratedEncoding(t *testing.T) {
+	for _, p := range []proto.Proto{p9.Proto(), p9.ProtoDotU(), p9.ProtoDotL()} {
+		for id := 0; id < 256; id++ {
+			typ := p.TypeFromID(uint8(id))
+			if typ == nil {
+				continue
+			}
+
+			msg := reflect.New(typ)
+			a, ok := msg.Interface().(proto.Appender)
+			if !ok {
+				continue
+			}
+			fill(msg.Elem(), id)
+
+			var expected bytes.Buffer
+			err := proto.Write(&expected, msg.Interface())
+			if err != nil {
+				t.Fatalf("%v: %v", typ, err)
+			}
+
+			buf, err := a.P9Append(nil)
+			if err != nil {
+				t.Fatalf("%v: %v", typ, err)
+			}
+			if !bytes.Equal(buf, expected.Bytes()) {
+				t.Errorf("%v: encoded as %x, expected %x", typ, buf, expected.Bytes())
+			}
+
+			parsed := reflect.New(typ)
+			err = parsed.Interface().(proto.Parser).P9Parse(buf)
+			if err != nil {
+				t.Fatalf("%v: %v", typ, err)
+			}
+			if !reflect.DeepEqual(parsed.Interface(), msg.Interface()) {
+				t.Errorf("%v: parsed as %#v, expected %#v", typ, parsed.Interface(), msg.Interface())
+			}
+
+			if len(buf) > 0 {
+				err = parsed.Interface().(proto.Parser).P9Parse(buf[:len(buf)-1])
+				if err == nil {
+					t.Errorf("%v: no error for short message", typ)
+				}
+			}
+		}
+	}
+}
+
+func TestRerrorIs(t *testing.T) {
+	tests := []struct {
+		err    error
+		target error
+		is     bool
+	}{
+		{&p9.Rerror{Ename: "file does not exist"}, fs.ErrNotExist, true},
+		{&p9.Rerror{Ename: "open /a/b: no such file or directory"}, fs.ErrNotExist, true},
+		{&p9.Rerror{Ename: "permission denied"}, fs.ErrNotExist, false},
+		{&p9.Rerror{Ename: "backup file exists"}, fs.ErrExist, false},
+		{&p9.Rerror{Ename: "file exists: not really"}, fs.ErrExist, false},
+		{&p9.RerrorDotU{Rerror: p9.Rerror{Ename: "whatever"}, Errno: 13}, fs.ErrPermission, true},
+		{&p9.RerrorDotU{Rerror: p9.Rerror{Ename: "file exists"}, Errno: 2}, fs.ErrExist, false},
+		{&p9.Rlerror{Ecode: 95}, errors.ErrUnsupported, true},
+	}
+
+	for _, test := range tests {
+		if is := errors.Is(test.err, test.target); is != test.is {
+			t.Errorf("errors.Is(%#v, %v) = %v, expected %v", test.err, test.target, is, test.is)
+		}
+	}
+}
@@ -0,0 +1,532 @@
+package p9
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Node is a synthetic file or directory served by a Mux. Nodes that
+// implement DirNode are directories. All others are files.
+//
+// Nodes may also implement a Mode method returning a FileMode to
+// control the mode reported for them. Only the permission bits and
+// ModeAppend and ModeExclusive are used. If a Node does not implement
+// it, files are reported as readable by everyone and directories as
+// readable and searchable by everyone.
+type Node interface {
+	// Open is called each time that a client opens the file. The
+	// returned File is only used for that open, so per-open state,
+	// such as a snapshot of generated contents, can be kept in it.
+	//
+	// Open is not called for DirNodes.
+	Open(mode uint8) (File, error)
+}
+
+// DirNode is implemented by Nodes that are directories whose entries
+// are computed dynamically.
+type DirNode interface {
+	Node
+
+	// Entries returns the names of the entries in the directory.
+	Entries() ([]string, error)
+
+	// Lookup returns the entry in the directory with the given name.
+	// If there is no such entry, it should return an error wrapping
+	// fs.ErrNotExist.
+	Lookup(name string) (Node, error)
+}
+
+// RefNode is implemented by DirNodes that want to know when FIDs
+// refer to their entries or to files inside of them, such as to
+// remove an entry once it is no longer in use. See RefFS for details.
+type RefNode interface {
+	DirNode
+
+	// Ref is called when a FID begins referring to the entry with the
+	// given name or to a file inside of it.
+	Ref(name string)
+
+	// Unref is called when a FID stops referring to the entry with the
+	// given name or to a file inside of it.
+	Unref(name string)
+}
+
+// nodeMode returns the mode of n.
+func nodeMode(n Node) FileMode {
+	var mode FileMode = 0444
+	if m, ok := n.(interface{ Mode() FileMode }); ok {
+		mode = m.Mode() & (ModeAppend | ModeExclusive | 0777)
+	}
+
+	if _, ok := n.(DirNode); ok {
+		if mode == 0444 {
+			mode = 0555
+		}
+		mode |= ModeDir
+	}
+	return mode
+}
+
+// SynthFile is a Node whose contents are generated by functions.
+type SynthFile struct {
+	// Perm holds the permission bits of the file. If it is zero, the
+	// file is readable if Read is not nil and writable if Write is not
+	// nil.
+	Perm FileMode
+
+	// Read is called each time that the file is opened for reading. The
+	// data that it returns is the contents of the file for that open.
+	// If Read is nil, the file can't be opened for reading.
+	Read func() ([]byte, error)
+
+	// Write is called for each line written to the file, without the
+	// trailing newline. Each write is split into lines separately, and
+	// a line at the end of a write without a trailing newline is
+	// treated as complete. If Write returns an error, the write fails
+	// with that error and the remaining lines are not processed. If
+	// Write is nil, the file can't be opened for writing.
+	Write func(line string) error
+}
+
+// StaticFile returns a SynthFile with fixed, read-only contents.
+func StaticFile(data []byte) *SynthFile {
+	return &SynthFile{
+		Read: func() ([]byte, error) { return data, nil },
+	}
+}
+
+// Mode returns the mode of the file.
+func (f *SynthFile) Mode() FileMode {
+	if f.Perm != 0 {
+		return f.Perm
+	}
+
+	var mode FileMode
+	if f.Read != nil {
+		mode |= 0444
+	}
+	if f.Write != nil {
+		mode |= 0222
+	}
+	return mode
+}
+
+// Open implements Node.Open.
+func (f *SynthFile) Open(mode uint8) (File, error) {
+	read := mode&3 != OWRITE
+	write := (mode&3 == OWRITE) || (mode&3 == ORDWR)
+	if (read && (f.Read == nil)) || (write && (f.Write == nil)) {
+		return nil, fs.ErrPermission
+	}
+
+	file := &synthFile{write: f.Write}
+	if read {
+		data, err := f.Read()
+		if err != nil {
+			return nil, err
+		}
+		file.data = data
+	}
+	return file, nil
+}
+
+type synthFile struct {
+	data  []byte
+	write func(line string) error
+}
+
+func (f *synthFile) ReadAt(buf []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	return copy(buf, f.data[off:]), nil
+}
+
+func (f *synthFile) WriteAt(data []byte, off int64) (int, error) {
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+
+		err := f.write(strings.TrimSuffix(line, "\n"))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (f *synthFile) Close() error {
+	return nil
+}
+
+func (f *synthFile) Readdir() ([]DirEntry, error) {
+	return nil, errors.New("not a directory")
+}
+
+// SynthDir is a DirNode whose entries are provided by functions.
+type SynthDir struct {
+	// Perm holds the permission bits of the directory. If it is zero,
+	// the directory is readable and searchable by everyone.
+	Perm FileMode
+
+	// EntriesFunc returns the names of the entries in the directory.
+	EntriesFunc func() ([]string, error)
+
+	// LookupFunc returns the entry with the given name. If it is nil,
+	// the entry is looked up by calling EntriesFunc and then
+	// returning an empty SynthFile if the name is found.
+	LookupFunc func(name string) (Node, error)
+}
+
+// Mode returns the mode of the directory.
+func (d *SynthDir) Mode() FileMode {
+	if d.Perm != 0 {
+		return d.Perm
+	}
+	return 0555
+}
+
+// Open implements Node.Open. It always returns an error, as Mux
+// handles the opening of directories itself.
+func (d *SynthDir) Open(mode uint8) (File, error) {
+	return nil, errors.New("is a directory")
+}
+
+// Entries implements DirNode.Entries.
+func (d *SynthDir) Entries() ([]string, error) {
+	return d.EntriesFunc()
+}
+
+// Lookup implements DirNode.Lookup.
+func (d *SynthDir) Lookup(name string) (Node, error) {
+	if d.LookupFunc != nil {
+		return d.LookupFunc(name)
+	}
+
+	entries, err := d.EntriesFunc()
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(entries, name) {
+		return nil, fs.ErrNotExist
+	}
+	return &SynthFile{}, nil
+}
+
+// Mux is a FileSystem that serves a tree of synthetic files, such as
+// the control and status files commonly provided by Plan 9 services.
+// It is analogous to http.ServeMux: Nodes are registered at paths
+// using Handle and the related methods, and the directories
+// containing them are created automatically.
+//
+// Like Dir, a Mux accepts attachments of either "" or "/", but
+// rejects all others, and does not support authentication. Files are
+// reported as being owned by the user that the client attached as.
+// Files can not be created, removed, or modified with wstat by
+// clients.
+//
+// The zero value of Mux is an empty tree ready for use. A Mux must
+// not be copied after first use. It is safe to register Nodes while
+// the Mux is being served.
+type Mux struct {
+	m     sync.RWMutex
+	root  *muxDir
+	start time.Time
+}
+
+// init initializes the root directory if necessary. m.m must be held
+// for writing.
+func (m *Mux) init() {
+	if m.root == nil {
+		m.root = &muxDir{m: &m.m, entries: make(map[string]Node)}
+		m.start = time.Now()
+	}
+}
+
+// Handle registers n at path p. It panics if something is already
+// registered at p or if a parent of p is not a directory created by
+// the Mux.
+func (m *Mux) Handle(p string, n Node) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.init()
+
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if p == "" {
+		panic("p9: invalid path for Mux.Handle")
+	}
+
+	dir := m.root
+	names := strings.Split(p, "/")
+	for _, name := range names[:len(names)-1] {
+		next, ok := dir.entries[name]
+		if !ok {
+			next = &muxDir{m: &m.m, entries: make(map[string]Node)}
+			dir.entries[name] = next
+		}
+
+		nextDir, ok := next.(*muxDir)
+		if !ok {
+			panic("p9: parent of " + p + " is already registered")
+		}
+		dir = nextDir
+	}
+
+	name := names[len(names)-1]
+	if _, ok := dir.entries[name]; ok {
+		panic("p9: multiple registrations for " + p)
+	}
+	dir.entries[name] = n
+}
+
+// HandleRead registers a read-only SynthFile at p whose contents are
+// generated by calling read each time that it is opened.
+func (m *Mux) HandleRead(p string, read func() ([]byte, error)) {
+	m.Handle(p, &SynthFile{Read: read})
+}
+
+// HandleWrite registers a write-only SynthFile at p that calls write
+// for each line written to it.
+func (m *Mux) HandleWrite(p string, write func(line string) error) {
+	m.Handle(p, &SynthFile{Write: write})
+}
+
+// HandleDir registers a SynthDir at p with entries determined by
+// calling entries and lookup.
+func (m *Mux) HandleDir(p string, entries func() ([]string, error), lookup func(name string) (Node, error)) {
+	m.Handle(p, &SynthDir{EntriesFunc: entries, LookupFunc: lookup})
+}
+
+// muxDir is a directory created by a Mux. Its entries are protected
+// by the Mux's lock, which m points to.
+type muxDir struct {
+	m       *sync.RWMutex
+	entries map[string]Node
+}
+
+func (d *muxDir) Open(mode uint8) (File, error) {
+	return nil, errors.New("is a directory")
+}
+
+func (d *muxDir) Entries() ([]string, error) {
+	d.m.RLock()
+	defer d.m.RUnlock()
+
+	names := make([]string, 0, len(d.entries))
+	for name := range d.entries {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (d *muxDir) Lookup(name string) (Node, error) {
+	d.m.RLock()
+	defer d.m.RUnlock()
+
+	n, ok := d.entries[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return n, nil
+}
+
+// lookup finds the Node at p.
+func (m *Mux) lookup(p string) (Node, error) {
+	m.m.RLock()
+	var n Node = m.root
+	m.m.RUnlock()
+
+	for _, name := range strings.Split(strings.Trim(path.Clean(p), "/"), "/") {
+		if name == "" {
+			continue
+		}
+
+		dir, ok := n.(DirNode)
+		if !ok {
+			return nil, &fs.PathError{Op: "walk", Path: p, Err: errors.New("not a directory")}
+		}
+
+		next, err := dir.Lookup(name)
+		if err != nil {
+			return nil, &fs.PathError{Op: "walk", Path: p, Err: err}
+		}
+		n = next
+	}
+
+	return n, nil
+}
+
+// ref calls f for every RefNode along p with the name of the next
+// element of p.
+func (m *Mux) ref(p string, f func(r RefNode, name string)) {
+	m.m.RLock()
+	var n Node = m.root
+	m.m.RUnlock()
+
+	for _, name := range strings.Split(strings.Trim(path.Clean(p), "/"), "/") {
+		if name == "" {
+			continue
+		}
+
+		dir, ok := n.(DirNode)
+		if !ok {
+			return
+		}
+		if r, ok := dir.(RefNode); ok {
+			f(r, name)
+		}
+
+		next, err := dir.Lookup(name)
+		if err != nil {
+			return
+		}
+		n = next
+	}
+}
+
+// Auth implements FileSystem.Auth.
+func (m *Mux) Auth(user, aname string) (File, error) {
+	return nil, errors.New("auth not supported")
+}
+
+// Attach implements FileSystem.Attach.
+func (m *Mux) Attach(afile File, user, aname string) (Attachment, error) {
+	switch aname {
+	case "", "/":
+	default:
+		return nil, errors.New("unknown attachment")
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.init()
+	return &muxAttachment{mux: m, user: user}, nil
+}
+
+type muxAttachment struct {
+	mux  *Mux
+	user string
+}
+
+func (a *muxAttachment) entry(name string, n Node) DirEntry {
+	return DirEntry{
+		FileMode:  nodeMode(n),
+		ATime:     a.mux.start,
+		MTime:     a.mux.start,
+		EntryName: name,
+		UID:       a.user,
+		GID:       a.user,
+		MUID:      a.user,
+		NUID:      NoUID,
+		NGID:      NoUID,
+		NMUID:     NoUID,
+	}
+}
+
+func (a *muxAttachment) Stat(p string) (DirEntry, error) {
+	n, err := a.mux.lookup(p)
+	if err != nil {
+		return DirEntry{}, err
+	}
+	return a.entry(path.Base(p), n), nil
+}
+
+func (a *muxAttachment) GetQID(p string) (QID, error) {
+	stat, err := a.Stat(p)
+	if err != nil {
+		return QID{}, err
+	}
+	return pathQID(p, stat), nil
+}
+
+func (a *muxAttachment) Ref(p string) {
+	a.mux.ref(p, RefNode.Ref)
+}
+
+func (a *muxAttachment) Unref(p string) {
+	a.mux.ref(p, RefNode.Unref)
+}
+
+func (a *muxAttachment) WriteStat(p string, changes StatChanges) error {
+	return fs.ErrPermission
+}
+
+func (a *muxAttachment) Open(p string, mode uint8) (File, error) {
+	n, err := a.mux.lookup(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if dir, ok := n.(DirNode); ok {
+		if mode&3 != OREAD {
+			return nil, errors.New("is a directory")
+		}
+		return &muxDirFile{a: a, dir: dir}, nil
+	}
+
+	return n.Open(mode)
+}
+
+func (a *muxAttachment) Create(p string, perm FileMode, mode uint8) (File, error) {
+	return nil, fs.ErrPermission
+}
+
+func (a *muxAttachment) Remove(p string) error {
+	return fs.ErrPermission
+}
+
+// muxDirFile is an open DirNode.
+type muxDirFile struct {
+	a   *muxAttachment
+	dir DirNode
+}
+
+func (f *muxDirFile) ReadAt(buf []byte, off int64) (int, error) {
+	return 0, errors.New("is a directory")
+}
+
+func (f *muxDirFile) WriteAt(data []byte, off int64) (int, error) {
+	return 0, errors.New("is a directory")
+}
+
+func (f *muxDirFile) Close() error {
+	return nil
+}
+
+func (f *muxDirFile) Readdir() ([]DirEntry, error) {
+	names, err := f.dir.Entries()
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(names)
+
+	entries := make([]DirEntry, 0, len(names))
+	for _, name := range names {
+		n, err := f.dir.Lookup(name)
+		if err != nil {
+			// The entry may have gone away in the meantime.
+			continue
+		}
+		entries = append(entries, f.a.entry(name, n))
+	}
+	return entries, nil
+}
+
+var (
+	_ FileSystem = (*Mux)(nil)
+	_ QIDFS      = (*muxAttachment)(nil)
+	_ RefFS      = (*muxAttachment)(nil)
+	_ DirNode    = (*SynthDir)(nil)
+)
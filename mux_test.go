@@ -0,0 +1,157 @@
+package p9_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/DeedleFake/p9"
+	"github.com/DeedleFake/p9/proto"
+)
+
+func TestMux(t *testing.T) {
+	var m sync.Mutex
+	var counter int
+	var procs []string
+
+	var mux p9.Mux
+	mux.Handle("version", p9.StaticFile([]byte("1.0\n")))
+	mux.HandleRead("status", func() ([]byte, error) {
+		m.Lock()
+		defer m.Unlock()
+		return []byte(strconv.Itoa(counter)), nil
+	})
+	mux.HandleWrite("ctl", func(line string) error {
+		m.Lock()
+		defer m.Unlock()
+
+		switch line {
+		case "incr":
+			counter++
+		case "spawn":
+			procs = append(procs, strconv.Itoa(len(procs)))
+		default:
+			return fmt.Errorf("unknown command: %q", line)
+		}
+		return nil
+	})
+	mux.HandleDir("proc", func() ([]string, error) {
+		m.Lock()
+		defer m.Unlock()
+		return slices.Clone(procs), nil
+	}, nil)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go proto.Serve(lis, p9.Proto(), p9.FSConnHandler(&mux, 8192))
+
+	c, err := p9.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err = c.Handshake(8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := c.Attach(nil, "test", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	read := func(p string) string {
+		t.Helper()
+
+		file, err := root.Open(p, p9.OREAD)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	if v := read("version"); v != "1.0\n" {
+		t.Errorf("Expected version %q but got %q", "1.0\n", v)
+	}
+
+	version, err := root.Open("version", p9.OREAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer version.Close()
+	_, err = version.ReadAt(make([]byte, 4), -1)
+	if err == nil {
+		t.Error("Read at a negative offset succeeded")
+	}
+	_, err = version.ReadAt(make([]byte, 4), 100)
+	if err != io.EOF {
+		t.Errorf("Expected io.EOF past the end but got %v", err)
+	}
+
+	ctl, err := root.Open("ctl", p9.OWRITE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctl.Close()
+
+	_, err = ctl.Write([]byte("incr\nincr\nspawn\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ctl.Write([]byte("spawn"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ctl.Write([]byte("explode\n"))
+	if err == nil {
+		t.Error("Invalid command succeeded")
+	}
+
+	if s := read("status"); s != "2" {
+		t.Errorf("Expected status %q but got %q", "2", s)
+	}
+
+	_, err = root.Open("ctl", p9.OREAD)
+	if !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("Expected fs.ErrPermission but got %v", err)
+	}
+
+	dir, err := root.Open("proc", p9.OREAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dir.Close()
+
+	entries, err := dir.Readdir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if !slices.Equal(names, []string{"0", "1"}) {
+		t.Errorf("Unexpected proc entries: %v", names)
+	}
+
+	_, err = root.Stat("proc/2")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist but got %v", err)
+	}
+}
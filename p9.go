@@ -8,6 +8,15 @@ const (
 	// Version is the 9P version implemented by this package, both for
 	// server and client.
 	Version = "9P2000"
+
+	// VersionDotU is the version string of the 9P2000.u dialect, which
+	// adds support for numeric IDs, error numbers, and special files.
+	VersionDotU = "9P2000.u"
+
+	// VersionDotL is the version string of the 9P2000.L dialect, which
+	// replaces many of the standard messages with ones that map more
+	// directly to Linux system calls.
+	VersionDotL = "9P2000.L"
 )
 
 const (
@@ -16,26 +25,36 @@ const (
 
 	// NoFID is a special FID that is used to signal a lack of an FID.
 	NoFID uint32 = math.MaxUint32
+
+	// NoUID is a special numeric user or group ID that is used in
+	// 9P2000.u to signal a lack of an ID.
+	NoUID uint32 = math.MaxUint32
 )
 
 // File open modes and flags. Note that not all flags are supported
 // where you might expect them to be. If you get an error saying that
 // a flag won't fit into uint8, the flag you're trying to use probably
 // isn't supported there.
+//
+// The flags have the values used on the wire by Plan 9 and 9P2000.u.
+// Earlier versions of this package used different values for OTRUNC
+// and every flag after it, starting with 0x20 for OTRUNC, so any code
+// that stored or hard-coded those numbers needs to be updated.
 const (
 	OREAD uint8 = iota
 	OWRITE
 	ORDWR
 	OEXEC
 
-	OTRUNC = 1 << (iota + 1)
+	OTRUNC = 1 << iota
 	OCEXEC
 	ORCLOSE
 	ODIRECT
 	ONONBLOCK
-	OEXCL
-	OLOCK
-	OAPPEND
+
+	OEXCL   = 0x1000
+	OLOCK   = 0x2000
+	OAPPEND = 0x4000
 )
 
 // QID represents a QID value.
@@ -58,6 +77,7 @@ const (
 	QTAuth
 	QTTmp
 	QTSymlink
+	QTLink
 )
 
 // FileMode converts the QIDType to a FileMode.
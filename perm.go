@@ -0,0 +1,443 @@
+package p9
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/DeedleFake/p9/proto"
+)
+
+// PermFS wraps a FileSystem with an implementation that enforces the
+// permission bits of files for the user that each client attaches as.
+// It is useful for FileSystems, such as Dir, that would otherwise give
+// every user the same access.
+//
+// Permissions are checked in the same way as on Unix-like systems.
+// The owner bits are used if the user owns the file, the group bits if
+// the user is a member of the file's group, and the other bits
+// otherwise. Every directory above a file must be searchable in order
+// to access the file, creating and removing files requires write
+// permission in their directory, and opening a file requires the
+// permissions corresponding to the mode that it is opened in. Only the
+// owner of a file may change its mode, times, or group, and the group
+// may only be changed to one that the owner is a member of. The owner
+// of a file can not be changed. If the Attachment that a client
+// attaches to implements UserFS, permissions are checked for the user
+// that it returns instead of the one that attached.
+//
+// Failed checks return errors that wrap fs.ErrPermission. Note that
+// PermFS does not authenticate users. It should usually be combined
+// with an AuthFS or a FileSystem that handles authentication itself.
+type PermFS struct {
+	FileSystem
+
+	// InGroup reports whether or not user is a member of group. If it
+	// is nil, users are only considered to be members of the group
+	// with the same name as them, as is common on Plan 9.
+	InGroup func(user, group string) bool
+}
+
+// Dialects implements DialectFS.
+func (p PermFS) Dialects() proto.Dialects {
+	if d, ok := p.FileSystem.(DialectFS); ok {
+		return d.Dialects()
+	}
+	return Dialects()
+}
+
+// AuthContext implements FileSystemContext.AuthContext.
+func (p PermFS) AuthContext(ctx context.Context, user, aname string) (File, error) {
+	return fsWithContext(p.FileSystem).AuthContext(ctx, user, aname)
+}
+
+// Attach implements FileSystem.Attach.
+func (p PermFS) Attach(afile File, user, aname string) (Attachment, error) {
+	return p.AttachContext(context.Background(), afile, user, aname)
+}
+
+// AttachContext implements FileSystemContext.AttachContext.
+func (p PermFS) AttachContext(ctx context.Context, afile File, user, aname string) (Attachment, error) {
+	a, err := fsWithContext(p.FileSystem).AttachContext(ctx, afile, user, aname)
+	if err != nil {
+		return nil, err
+	}
+	if u, ok := a.(UserFS); ok {
+		user = u.User()
+	}
+
+	return &permAttachment{
+		a:       a,
+		ac:      attachmentWithContext(a),
+		user:    user,
+		aname:   aname,
+		inGroup: p.InGroup,
+	}, nil
+}
+
+// permAttachment is an Attachment that checks permissions before
+// passing requests on to the Attachment that it wraps.
+type permAttachment struct {
+	a       Attachment
+	ac      AttachmentContext
+	user    string
+	aname   string
+	inGroup func(user, group string) bool
+}
+
+// member reports whether or not the user is a member of group.
+func (a *permAttachment) member(group string) bool {
+	if a.inGroup == nil {
+		return a.user == group
+	}
+	return a.inGroup(a.user, group)
+}
+
+// allowed reports whether or not the user has all of the permissions
+// in want, which is given using the other bits, for the file
+// described by stat.
+func (a *permAttachment) allowed(stat DirEntry, want FileMode) bool {
+	perm := stat.FileMode.Perm()
+	switch {
+	case stat.UID == a.user:
+		perm >>= 6
+	case a.member(stat.GID):
+		perm >>= 3
+	}
+	return perm&want == want
+}
+
+// dir returns the path of the directory containing p. It returns
+// false if p is the root of the attachment.
+func (a *permAttachment) dir(p string) (string, bool) {
+	root := path.Clean(a.aname)
+	if path.Clean(p) == root {
+		return "", false
+	}
+
+	dir := path.Dir(p)
+	if dir == root {
+		// Use the root's path exactly as the client gave it.
+		return a.aname, true
+	}
+	return dir, true
+}
+
+// search checks that the user can search every directory above p.
+func (a *permAttachment) search(ctx context.Context, p string) error {
+	for dir, ok := a.dir(p); ok; dir, ok = a.dir(dir) {
+		err := a.check(ctx, dir, 01)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check checks that the user has the permissions in want for the file
+// at p. It does not check that the directories above p are
+// searchable.
+func (a *permAttachment) check(ctx context.Context, p string, want FileMode) error {
+	stat, err := a.ac.StatContext(ctx, p)
+	if err != nil {
+		return err
+	}
+	if !a.allowed(stat, want) {
+		return fs.ErrPermission
+	}
+	return nil
+}
+
+// checkDir checks that the user can modify the directory containing p.
+func (a *permAttachment) checkDir(ctx context.Context, p string) error {
+	err := a.search(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	dir, ok := a.dir(p)
+	if !ok {
+		return fs.ErrPermission
+	}
+	return a.check(ctx, dir, 02)
+}
+
+func (a *permAttachment) Stat(p string) (DirEntry, error) {
+	return a.StatContext(context.Background(), p)
+}
+
+func (a *permAttachment) StatContext(ctx context.Context, p string) (DirEntry, error) {
+	err := a.search(ctx, p)
+	if err != nil {
+		return DirEntry{}, err
+	}
+	return a.ac.StatContext(ctx, p)
+}
+
+func (a *permAttachment) WriteStat(p string, changes StatChanges) error {
+	return a.WriteStatContext(context.Background(), p, changes)
+}
+
+func (a *permAttachment) WriteStatContext(ctx context.Context, p string, changes StatChanges) error {
+	stat, err := a.StatContext(ctx, p)
+	if err != nil {
+		return err
+	}
+	owner := stat.UID == a.user
+
+	if name, ok := changes.Name(); ok && (name != stat.EntryName) {
+		err := a.checkDir(ctx, p)
+		if err != nil {
+			return err
+		}
+	}
+	if _, ok := changes.Length(); ok && !a.allowed(stat, 02) {
+		return fs.ErrPermission
+	}
+
+	if _, ok := changes.Mode(); ok && !owner {
+		return fs.ErrPermission
+	}
+	_, atime := changes.ATime()
+	_, mtime := changes.MTime()
+	if (atime || mtime) && !owner {
+		return fs.ErrPermission
+	}
+	if gid, ok := changes.GID(); ok && (gid != stat.GID) && (!owner || !a.member(gid)) {
+		return fs.ErrPermission
+	}
+	if _, ok := changes.NGID(); ok && !owner {
+		return fs.ErrPermission
+	}
+	if uid, ok := changes.UID(); ok && (uid != stat.UID) {
+		return fs.ErrPermission
+	}
+	if nuid, ok := changes.NUID(); ok && (nuid != stat.NUID) {
+		return fs.ErrPermission
+	}
+
+	return a.ac.WriteStatContext(ctx, p, changes)
+}
+
+// openPerm returns the permissions needed to open a file in mode.
+func openPerm(mode uint8) FileMode {
+	var want FileMode
+	switch mode & 3 {
+	case OREAD:
+		want = 04
+	case OWRITE:
+		want = 02
+	case ORDWR:
+		want = 06
+	case OEXEC:
+		want = 01
+	}
+	if mode&OTRUNC != 0 {
+		want |= 02
+	}
+	return want
+}
+
+func (a *permAttachment) Open(p string, mode uint8) (File, error) {
+	return a.OpenContext(context.Background(), p, mode)
+}
+
+func (a *permAttachment) OpenContext(ctx context.Context, p string, mode uint8) (File, error) {
+	stat, err := a.StatContext(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if !a.allowed(stat, openPerm(mode)) {
+		return nil, fs.ErrPermission
+	}
+	if mode&ORCLOSE != 0 {
+		err := a.checkDir(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return a.ac.OpenContext(ctx, p, mode)
+}
+
+func (a *permAttachment) Create(p string, perm FileMode, mode uint8) (File, error) {
+	return a.CreateContext(context.Background(), p, perm, mode)
+}
+
+func (a *permAttachment) CreateContext(ctx context.Context, p string, perm FileMode, mode uint8) (File, error) {
+	err := a.checkDir(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return a.ac.CreateContext(ctx, p, perm, mode)
+}
+
+func (a *permAttachment) Remove(p string) error {
+	return a.RemoveContext(context.Background(), p)
+}
+
+func (a *permAttachment) RemoveContext(ctx context.Context, p string) error {
+	err := a.checkDir(ctx, p)
+	if err != nil {
+		return err
+	}
+	return a.ac.RemoveContext(ctx, p)
+}
+
+func (a *permAttachment) GetQID(p string) (QID, error) {
+	err := a.search(context.Background(), p)
+	if err != nil {
+		return QID{}, err
+	}
+
+	if q, ok := a.a.(QIDFS); ok {
+		return q.GetQID(p)
+	}
+
+	stat, err := a.a.Stat(p)
+	if err != nil {
+		return QID{}, err
+	}
+	return pathQID(p, stat), nil
+}
+
+func (a *permAttachment) IOUnit() uint32 {
+	if u, ok := a.a.(IOUnitFS); ok {
+		return u.IOUnit()
+	}
+	return 0
+}
+
+func (a *permAttachment) Ref(p string) {
+	if r, ok := a.a.(RefFS); ok {
+		r.Ref(p)
+	}
+}
+
+func (a *permAttachment) Unref(p string) {
+	if r, ok := a.a.(RefFS); ok {
+		r.Unref(p)
+	}
+}
+
+func (a *permAttachment) GetAttr(p string) (Attr, error) {
+	err := a.search(context.Background(), p)
+	if err != nil {
+		return Attr{}, err
+	}
+
+	if af, ok := a.a.(AttrFS); ok {
+		return af.GetAttr(p)
+	}
+
+	stat, err := a.a.Stat(p)
+	if err != nil {
+		return Attr{}, err
+	}
+	return attrFromEntry(stat), nil
+}
+
+func (a *permAttachment) Readlink(p string) (string, error) {
+	err := a.search(context.Background(), p)
+	if err != nil {
+		return "", err
+	}
+
+	if r, ok := a.a.(ReadlinkFS); ok {
+		return r.Readlink(p)
+	}
+	return "", errors.ErrUnsupported
+}
+
+func (a *permAttachment) Rename(oldpath, newpath string) error {
+	ctx := context.Background()
+	err := a.checkDir(ctx, oldpath)
+	if err != nil {
+		return err
+	}
+	err = a.checkDir(ctx, newpath)
+	if err != nil {
+		return err
+	}
+
+	if r, ok := a.a.(RenameFS); ok {
+		return r.Rename(oldpath, newpath)
+	}
+
+	if path.Dir(oldpath) != path.Dir(newpath) {
+		return errors.ErrUnsupported
+	}
+
+	changes := noChanges()
+	changes.EntryName = path.Base(newpath)
+	return a.ac.WriteStatContext(ctx, oldpath, StatChanges{DirEntry: changes})
+}
+
+func (a *permAttachment) StatFS(p string) (FSStat, error) {
+	err := a.search(context.Background(), p)
+	if err != nil {
+		return FSStat{}, err
+	}
+
+	if s, ok := a.a.(StatFSFS); ok {
+		return s.StatFS(p)
+	}
+	return defaultFSStat, nil
+}
+
+// special returns the Attachment's SpecialFS after checking that the
+// user can create a file at p.
+func (a *permAttachment) special(p string) (SpecialFS, error) {
+	err := a.checkDir(context.Background(), p)
+	if err != nil {
+		return nil, err
+	}
+
+	s, ok := a.a.(SpecialFS)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	return s, nil
+}
+
+func (a *permAttachment) Symlink(target, p string) error {
+	s, err := a.special(p)
+	if err != nil {
+		return err
+	}
+	return s.Symlink(target, p)
+}
+
+func (a *permAttachment) Link(target, p string) error {
+	err := a.search(context.Background(), target)
+	if err != nil {
+		return err
+	}
+
+	s, err := a.special(p)
+	if err != nil {
+		return err
+	}
+	return s.Link(target, p)
+}
+
+func (a *permAttachment) Mknod(p string, mode os.FileMode, major, minor uint32) error {
+	s, err := a.special(p)
+	if err != nil {
+		return err
+	}
+	return s.Mknod(p, mode, major, minor)
+}
+
+var (
+	_ FileSystemContext = PermFS{}
+	_ DialectFS         = PermFS{}
+	_ AttachmentContext = (*permAttachment)(nil)
+	_ AttachmentDotL    = (*permAttachment)(nil)
+	_ QIDFS             = (*permAttachment)(nil)
+	_ IOUnitFS          = (*permAttachment)(nil)
+	_ RefFS             = (*permAttachment)(nil)
+	_ StatFSFS          = (*permAttachment)(nil)
+)
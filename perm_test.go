@@ -0,0 +1,99 @@
+package p9_test
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/DeedleFake/p9"
+)
+
+func TestPermFS(t *testing.T) {
+	fsys := p9.PermFS{
+		FileSystem: new(p9.MemFS),
+		InGroup: func(user, group string) bool {
+			return (user == group) || ((group == "staff") && (user != "carol"))
+		},
+	}
+
+	attach := func(user string) p9.Attachment {
+		t.Helper()
+
+		a, err := fsys.Attach(nil, user, "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	create := func(a p9.Attachment, p string, perm p9.FileMode) {
+		t.Helper()
+
+		file, err := a.Create(p, perm, p9.OREAD)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+	}
+	denied := func(err error) {
+		t.Helper()
+
+		if !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("Expected fs.ErrPermission but got %v", err)
+		}
+	}
+
+	alice := attach("alice")
+	bob := attach("bob")
+	carol := attach("carol")
+
+	create(alice, "/private", p9.ModeDir|0700)
+	create(alice, "/private/file", 0666)
+	create(alice, "/shared", 0640)
+	create(alice, "/tmp", 0600)
+
+	_, err := alice.Stat("/private/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = bob.Stat("/private/file")
+	denied(err)
+	_, err = bob.Create("/private/new", 0644, p9.OREAD)
+	denied(err)
+	err = bob.Remove("/tmp")
+	if err != nil {
+		t.Fatalf("Removing from a writable directory failed: %v", err)
+	}
+
+	_, err = bob.Open("/shared", p9.OREAD)
+	denied(err)
+
+	changes := p9.StatChanges{DirEntry: p9.DirEntry{
+		FileMode: 0xFFFFFFFF,
+		ATime:    unsetTime,
+		MTime:    unsetTime,
+		Length:   0xFFFFFFFFFFFFFFFF,
+		GID:      "staff",
+		NUID:     p9.NoUID,
+		NGID:     p9.NoUID,
+		NMUID:    p9.NoUID,
+	}}
+	denied(bob.WriteStat("/shared", changes))
+	err = alice.WriteStat("/shared", changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := bob.Open("/shared", p9.OREAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	_, err = bob.Open("/shared", p9.OWRITE)
+	denied(err)
+	_, err = carol.Open("/shared", p9.OREAD)
+	denied(err)
+
+	changes.DirEntry.GID = ""
+	changes.DirEntry.UID = "carol"
+	denied(alice.WriteStat("/shared", changes))
+}
@@ -0,0 +1,26 @@
+package proto
+
+import "sync"
+
+// buffers holds byte slices that are used for encoding and decoding
+// messages so that bulk transfers don't need to allocate a new buffer
+// for every message.
+var buffers sync.Pool
+
+// getBuffer returns a buffer of length n from the pool, allocating a
+// new one if the pooled one is too small.
+func getBuffer(n int) *[]byte {
+	if bp, ok := buffers.Get().(*[]byte); ok && (cap(*bp) >= n) {
+		*bp = (*bp)[:n]
+		return bp
+	}
+
+	buf := make([]byte, n, max(n, 512))
+	return &buf
+}
+
+// putBuffer returns a buffer to the pool. The buffer must not be used
+// afterwards.
+func putBuffer(bp *[]byte) {
+	buffers.Put(bp)
+}
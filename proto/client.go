@@ -1,12 +1,12 @@
 package proto
 
 import (
+	"bufio"
 	"context"
-	"io"
-	"log"
+	"fmt"
 	"net"
+	"sync"
 	"sync/atomic"
-	"time"
 
 	"github.com/DeedleFake/p9/internal/debug"
 )
@@ -15,19 +15,30 @@ import (
 // responses from a server for a given protocol. It automatically
 // handles message tags, properly blocking until a matching tag
 // response has been received.
+//
+// If the connection to the server fails, all pending and future
+// requests fail with an error wrapping both ErrConnectionLost and the
+// cause of the failure.
 type Client struct {
-	done   chan struct{}
-	cancel func()
+	done    chan struct{}
+	cancel  func()
+	errOnce sync.Once
+	err     error
 
-	p Proto
+	p atomic.Pointer[Proto]
 	c net.Conn
 
+	bufs sync.Map // map[uint16]*[]byte
+
 	nextTag   chan uint16
 	sentMsg   chan clientMsg
 	recvMsg   chan clientMsg
 	cancelMsg chan uint16
+	flushMsg  chan clientMsg
 
-	msize uint32
+	msize      uint32
+	flush      atomic.Pointer[func(tag uint16) any]
+	disconnect atomic.Pointer[func(err error)]
 }
 
 // NewClient initializes a client that communicates using c. The
@@ -39,16 +50,17 @@ func NewClient(p Proto, c net.Conn) *Client {
 		done:   make(chan struct{}),
 		cancel: cancel,
 
-		p: p,
 		c: c,
 
 		nextTag:   make(chan uint16),
 		sentMsg:   make(chan clientMsg),
 		recvMsg:   make(chan clientMsg),
 		cancelMsg: make(chan uint16),
+		flushMsg:  make(chan clientMsg),
 
 		msize: 1024,
 	}
+	client.p.Store(&p)
 	go client.reader(ctx)
 	go client.coord(ctx)
 
@@ -69,31 +81,77 @@ func Dial(p Proto, network, addr string) (*Client, error) {
 // Close cleans up resources created by the client as well as closing
 // the underlying connection.
 func (c *Client) Close() error {
-	c.cancel()
+	c.errOnce.Do(func() {
+		c.err = ErrClientClosed
+		c.cancel()
+	})
 	return c.c.Close()
 }
 
+// fail shuts the client down due to a failure of the connection. If
+// the client has already been closed, it does nothing.
+func (c *Client) fail(err error) {
+	c.errOnce.Do(func() {
+		c.err = fmt.Errorf("%w: %w", ErrConnectionLost, err)
+		c.cancel()
+		c.c.Close()
+
+		if f := c.disconnect.Load(); (f != nil) && (*f != nil) {
+			go (*f)(c.err)
+		}
+	})
+}
+
+// Done returns a channel that is closed when the client stops
+// working, either because it was closed or because its connection
+// failed.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns nil if the client is still working. Otherwise, it
+// returns ErrClientClosed if the client was closed, or an error
+// wrapping ErrConnectionLost if its connection failed.
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// SetDisconnectHandler sets a function to be called in a new
+// goroutine if the client's connection fails. It is passed the same
+// error that is returned by Err. It is not called if the client is
+// closed with Close.
+func (c *Client) SetDisconnectHandler(f func(err error)) {
+	c.disconnect.Store(&f)
+}
+
 // reader reads messages from the connection, sending them to the
 // coordinator to be sent to waiting Send calls.
+//
+// Any error while reading is fatal, as the boundaries between
+// messages can't be trusted afterwards.
 func (c *Client) reader(ctx context.Context) {
+	br := bufio.NewReader(c.c)
 	for {
-		err := c.c.SetReadDeadline(time.Now().Add(10 * time.Second))
+		// Wait for the next message to begin arriving before getting the
+		// protocol and msize so that changes made in response to the
+		// previous message, such as during a handshake, are respected.
+		_, err := br.Peek(4)
 		if err != nil {
-			if ctx.Err() != nil {
-				return
-			}
-
-			log.Printf("Failed to set conn deadline: %v", err)
+			c.fail(err)
 			return
 		}
 
-		msg, tag, err := c.p.Receive(c.c, c.Msize())
+		msg, tag, _, err := c.Proto().receive(br, c.Msize(), receiveOptions{
+			dst: c.dst,
+		})
 		if err != nil {
-			if (ctx.Err() != nil) || (err == io.EOF) {
-				return
-			}
-
-			continue
+			c.fail(err)
+			return
 		}
 
 		select {
@@ -108,6 +166,16 @@ func (c *Client) reader(ctx context.Context) {
 	}
 }
 
+// dst returns the buffer, if any, that was provided for the response
+// to the request with the given tag.
+func (c *Client) dst(tag uint16) []byte {
+	bp, ok := c.bufs.LoadAndDelete(tag)
+	if !ok {
+		return nil
+	}
+	return *bp.(*[]byte)
+}
+
 // coord coordinates between Send calls and the reader.
 func (c *Client) coord(ctx context.Context) {
 	defer close(c.done)
@@ -115,6 +183,11 @@ func (c *Client) coord(ctx context.Context) {
 	var nextTag uint16
 	tags := make(map[uint16]chan any)
 
+	// flushed holds the tags of requests that have been flushed but
+	// whose Rflush has not yet arrived. Their tags remain in use until
+	// then, but responses to them are discarded.
+	flushed := make(map[uint16]struct{})
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -128,12 +201,23 @@ func (c *Client) coord(ctx context.Context) {
 			if !ok {
 				continue
 			}
+			if _, ok := flushed[cm.tag]; ok {
+				continue
+			}
 
 			rcm <- cm.recv
 			delete(tags, cm.tag)
 
+		case cm := <-c.flushMsg:
+			_, ok := tags[cm.tag]
+			if ok {
+				flushed[cm.tag] = struct{}{}
+			}
+			cm.ret <- ok
+
 		case tag := <-c.cancelMsg:
 			delete(tags, tag)
+			delete(flushed, tag)
 
 		case c.nextTag <- nextTag:
 			for {
@@ -158,26 +242,90 @@ func (c *Client) SetMsize(size uint32) {
 	atomic.StoreUint32(&c.msize, size)
 }
 
+// Proto returns the protocol that the client is currently using.
+func (c *Client) Proto() Proto {
+	return *c.p.Load()
+}
+
+// SetProto changes the protocol used by the client. This is intended
+// for use when a different dialect of a protocol has been negotiated
+// with the server. It does not perform any communication with the
+// server.
+func (c *Client) SetProto(p Proto) {
+	c.p.Store(&p)
+}
+
+// SetFlush sets the function used to build the message that is sent
+// to flush the request with the given tag when the context passed to
+// SendContext is cancelled. If it is not set, cancelled requests are
+// abandoned without informing the server.
+func (c *Client) SetFlush(flush func(tag uint16) any) {
+	c.flush.Store(&flush)
+}
+
 // Send sends a message to the server, blocking until a response has
 // been received. It is safe to place multiple Send calls
 // concurrently, and each will return when the response to that
 // request has been received.
 func (c *Client) Send(msg any) (any, error) {
+	return c.send(context.Background(), msg, nil)
+}
+
+// SendContext is like Send, but returns ctx.Err() early if ctx is
+// cancelled before a response is received. If the request has
+// already been sent, it is flushed using the message built by the
+// function given to SetFlush. The flush happens in the background,
+// and the request's tag is not reused until the server has
+// acknowledged it.
+//
+// Note that a request can complete on the server before the flush
+// arrives. In that case, its response is discarded, so requests with
+// side effects, such as walks and creates, should only be cancelled
+// if the client is prepared to deal with not knowing whether or not
+// they succeeded.
+func (c *Client) SendContext(ctx context.Context, msg any) (any, error) {
+	return c.send(ctx, msg, nil)
+}
+
+// SendBuffer is like Send, but if the response implements
+// BufferDecoder, its payload is decoded directly into buf instead of
+// into a newly allocated buffer. buf must not be used until SendBuffer
+// returns.
+func (c *Client) SendBuffer(msg any, buf []byte) (any, error) {
+	return c.send(context.Background(), msg, &buf)
+}
+
+// SendBufferContext is a combination of SendContext and SendBuffer.
+// If ctx is cancelled after the response has started being decoded
+// into buf, it waits for the response instead of returning early so
+// that buf is not in use after it returns.
+func (c *Client) SendBufferContext(ctx context.Context, msg any, buf []byte) (any, error) {
+	return c.send(ctx, msg, &buf)
+}
+
+func (c *Client) send(ctx context.Context, msg any, bp *[]byte) (any, error) {
 	debug.Log("client -> %#v\n", msg)
 
 	tag := NoTag
 	if _, ok := msg.(P9NoTag); !ok {
 		select {
 		case <-c.done:
-			return nil, ErrClientClosed
+			return nil, c.Err()
+		case <-ctx.Done():
+			return nil, ctx.Err()
 		case tag = <-c.nextTag:
 		}
 	}
 
+	if bp != nil {
+		c.bufs.Store(tag, bp)
+		defer c.bufs.CompareAndDelete(tag, bp)
+	}
+
 	ret := make(chan any, 1)
 	select {
 	case <-c.done:
-		return nil, ErrClientClosed
+		return nil, c.Err()
 
 	case c.sentMsg <- clientMsg{
 		tag: tag,
@@ -185,7 +333,7 @@ func (c *Client) Send(msg any) (any, error) {
 	}:
 	}
 
-	err := c.p.Send(c.c, tag, msg)
+	err := c.Proto().Send(c.c, tag, msg)
 	if err != nil {
 		select {
 		case <-c.done:
@@ -196,15 +344,76 @@ func (c *Client) Send(msg any) (any, error) {
 
 	select {
 	case <-c.done:
-		return nil, ErrClientClosed
+		return nil, c.Err()
 	case rsp := <-ret:
-		debug.Log("client <- %#v\n", rsp)
+		return c.response(rsp)
+	case <-ctx.Done():
+	}
 
-		if err, ok := rsp.(error); ok {
-			return nil, err
+	if (bp != nil) && !c.bufs.CompareAndDelete(tag, bp) {
+		// The response is already being decoded into the buffer.
+		select {
+		case <-c.done:
+			return nil, c.Err()
+		case rsp := <-ret:
+			return c.response(rsp)
 		}
-		return rsp, nil
 	}
+
+	c.abandon(tag)
+	return nil, ctx.Err()
+}
+
+func (c *Client) response(rsp any) (any, error) {
+	debug.Log("client <- %#v\n", rsp)
+
+	if err, ok := rsp.(error); ok {
+		return nil, err
+	}
+	return rsp, nil
+}
+
+// abandon abandons the request with the given tag, flushing it if
+// possible.
+func (c *Client) abandon(tag uint16) {
+	flush := c.flush.Load()
+	if (flush == nil) || (*flush == nil) || (tag == NoTag) {
+		select {
+		case <-c.done:
+		case c.cancelMsg <- tag:
+		}
+		return
+	}
+
+	ret := make(chan any, 1)
+	select {
+	case <-c.done:
+		return
+	case c.flushMsg <- clientMsg{
+		tag: tag,
+		ret: ret,
+	}:
+	}
+	if !(<-ret).(bool) {
+		// The response arrived first, so the tag has already been freed
+		// and may have been reused. Flushing it now could interfere with
+		// whichever request is using it.
+		return
+	}
+
+	go func() {
+		// If the flush itself fails, there's no way to tell whether or
+		// not the server is still using the tag, so it is left reserved.
+		_, err := c.Send((*flush)(tag))
+		if err != nil {
+			return
+		}
+
+		select {
+		case <-c.done:
+		case c.cancelMsg <- tag:
+		}
+	}()
 }
 
 // Sometimes I think that some type of tuples would be nice...
@@ -193,3 +193,40 @@ type Encoder interface {
 type Decoder interface {
 	P9Decode(r io.Reader) error
 }
+
+// Appender is implemented by messages that can encode themselves
+// without the use of reflection. P9Append appends the encoded message,
+// not including the size, type, and tag, to buf and returns the
+// result. Proto.Send uses it in place of Write when it is available.
+//
+// The encoding must be identical to the one produced by Write. Note
+// that methods are promoted through embedding, so a message type that
+// embeds one that implements Appender must implement it as well.
+type Appender interface {
+	P9Append(buf []byte) ([]byte, error)
+}
+
+// Parser is implemented by messages that can decode themselves
+// without the use of reflection. P9Parse decodes the message from
+// data, which contains the entirety of the message after the size,
+// type, and tag. The message may retain references to data. Proto.Receive
+// uses it in place of Read when it is available.
+//
+// As with Appender, a message type that embeds one that implements
+// Parser must implement it as well.
+type Parser interface {
+	P9Parse(data []byte) error
+}
+
+// BufferDecoder is implemented by messages that carry a bulk data
+// payload that can be decoded directly into a buffer provided by the
+// caller of Client.SendBuffer, avoiding an intermediate copy. r is
+// limited to the remainder of the message. buf is nil if no buffer
+// was provided, in which case the message should allocate its own. If
+// the payload does not fit into buf, the message should allocate one
+// that does.
+//
+// BufferDecoder takes precedence over Parser.
+type BufferDecoder interface {
+	P9DecodeBuffer(r io.Reader, buf []byte) error
+}
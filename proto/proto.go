@@ -4,8 +4,10 @@ package proto
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"io"
+	"math"
 	"reflect"
 	"sync"
 
@@ -20,6 +22,11 @@ var (
 	// ErrClientClosed is returned by attempts to send to a closed
 	// client.
 	ErrClientClosed = errors.New("client closed")
+
+	// ErrConnectionLost is returned by a client's sends after its
+	// connection to the server has failed. The error that caused the
+	// failure is wrapped along with it.
+	ErrConnectionLost = errors.New("connection lost")
 )
 
 const (
@@ -75,47 +82,107 @@ func (p Proto) IDFromType(t reflect.Type) (uint8, bool) {
 // Receive receives a message from r using the given maximum message
 // size. It returns the message, the tag that the message was sent
 // with, and an error, if any.
+//
+// An msize of 0 indicates that no size has been negotiated yet. In
+// that case, messages are limited to MaxVersionSize.
 func (p Proto) Receive(r io.Reader, msize uint32) (msg any, tag uint16, err error) {
+	msg, tag, _, err = p.receive(r, msize, receiveOptions{})
+	return msg, tag, err
+}
+
+// MaxVersionSize is the largest message that will be received before
+// a maximum message size has been negotiated. It is large enough for
+// any version request or response, as well as for any error that
+// might be sent in response to one.
+const MaxVersionSize = 4 + 1 + 2 + 4 + 2 + math.MaxUint16
+
+// receiveOptions control the buffering used by receive.
+type receiveOptions struct {
+	// pooled causes messages that implement Parser to be decoded from
+	// a pooled buffer. The buffer is returned from receive and must be
+	// put back with putBuffer once the message is no longer in use.
+	pooled bool
+
+	// dst, if not nil, is called with the tag of a message that
+	// implements BufferDecoder to get the buffer to decode it into.
+	dst func(tag uint16) []byte
+}
+
+func (p Proto) receive(r io.Reader, msize uint32, opts receiveOptions) (msg any, tag uint16, pbuf *[]byte, err error) {
 	var size uint32
 	err = Read(r, &size)
 	if err != nil {
-		return nil, NoTag, util.Errorf("receive: %w", err)
+		return nil, NoTag, nil, util.Errorf("receive: %w", err)
 	}
 
-	if (msize > 0) && (size > msize) {
-		return nil, NoTag, util.Errorf("receive: %w", ErrLargeMessage)
+	if msize == 0 {
+		msize = MaxVersionSize
+	}
+	if size > msize {
+		return nil, NoTag, nil, util.Errorf("receive: %w", ErrLargeMessage)
+	}
+
+	if size < 4+1+2 {
+		return nil, NoTag, nil, util.Errorf("receive: message too small: %v", size)
 	}
 
 	lr := &util.LimitedReader{
 		R: r,
-		N: size,
+		N: size - 4,
 		E: ErrLargeMessage,
 	}
 
 	var msgType uint8
 	err = Read(lr, &msgType)
 	if err != nil {
-		return nil, NoTag, util.Errorf("receive: failed to read message type: %w", err)
+		return nil, NoTag, nil, util.Errorf("receive: failed to read message type: %w", err)
 	}
 
 	t := p.TypeFromID(msgType)
 	if t == nil {
-		return nil, NoTag, util.Errorf("receive: invalid message type: %v", msgType)
+		return nil, NoTag, nil, util.Errorf("receive: invalid message type: %v", msgType)
 	}
 
 	tag = NoTag
 	err = Read(lr, &tag)
 	if err != nil {
-		return nil, tag, util.Errorf("receive: failed to read tag: %w", err)
+		return nil, tag, nil, util.Errorf("receive: failed to read tag: %w", err)
 	}
 
 	m := reflect.New(t)
-	err = Read(lr, m.Interface())
+	switch mi := m.Interface().(type) {
+	case BufferDecoder:
+		var buf []byte
+		if opts.dst != nil {
+			buf = opts.dst(tag)
+		}
+		err = mi.P9DecodeBuffer(lr, buf)
+
+	case Parser:
+		var buf []byte
+		if opts.pooled {
+			pbuf = getBuffer(int(lr.N))
+			buf = *pbuf
+		} else {
+			buf = make([]byte, lr.N)
+		}
+
+		_, err = io.ReadFull(lr, buf)
+		if err == nil {
+			err = mi.P9Parse(buf)
+		}
+
+	default:
+		err = Read(lr, mi)
+	}
 	if err != nil {
-		return nil, tag, util.Errorf("receive %v: %w", m.Type().Elem(), err)
+		if pbuf != nil {
+			putBuffer(pbuf)
+		}
+		return nil, tag, nil, util.Errorf("receive %v: %w", m.Type().Elem(), err)
 	}
 
-	return m.Interface(), tag, err
+	return m.Interface(), tag, pbuf, err
 }
 
 // Send writes a message to w with the given tag. It returns any
@@ -142,6 +209,10 @@ func (p Proto) Send(w io.Writer, tag uint16, msg any) (err error) {
 		return util.Errorf("send: invalid message type: %T", msg)
 	}
 
+	if a, ok := msg.(Appender); ok {
+		return sendAppender(w, msgType, tag, a)
+	}
+
 	write := func(v any) {
 		if err != nil {
 			return
@@ -165,3 +236,28 @@ func (p Proto) Send(w io.Writer, tag uint16, msg any) (err error) {
 
 	return err
 }
+
+// sendAppender is the fast path of Send for messages that implement
+// Appender.
+func sendAppender(w io.Writer, msgType uint8, tag uint16, msg Appender) error {
+	bp := getBuffer(0)
+	defer putBuffer(bp)
+
+	buf := append((*bp)[:0], 0, 0, 0, 0, msgType)
+	buf = binary.LittleEndian.AppendUint16(buf, tag)
+	buf, err := msg.P9Append(buf)
+	*bp = buf
+	if err != nil {
+		return util.Errorf("send %T: %w", msg, err)
+	}
+	if uint64(len(buf)) > math.MaxUint32 {
+		return util.Errorf("send %T: %w", msg, ErrLargeMessage)
+	}
+	binary.LittleEndian.PutUint32(buf, uint32(len(buf)))
+
+	_, err = w.Write(buf)
+	if err != nil {
+		return util.Errorf("send: %w", err)
+	}
+	return nil
+}
@@ -2,9 +2,17 @@ package proto_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/DeedleFake/p9"
+	"github.com/DeedleFake/p9/proto"
 )
 
 func TestReadWrite(t *testing.T) {
@@ -26,3 +34,475 @@ func TestReadWrite(t *testing.T) {
 	t.Logf("%#v", msg)
 	t.Log(tag)
 }
+
+func TestReceiveUnnegotiatedSize(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write([]byte{0xFF, 0xFF, 0xFF, 0xFF, 100, 0, 0})
+
+	_, _, err := p9.Proto().Receive(&buf, 0)
+	if !errors.Is(err, proto.ErrLargeMessage) {
+		t.Errorf("Expected ErrLargeMessage but got %v", err)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	dialects := proto.Dialects{
+		p9.Version:     p9.Proto(),
+		p9.VersionDotU: p9.ProtoDotU(),
+	}
+
+	tests := []struct {
+		req    string
+		expect string
+		ok     bool
+	}{
+		{req: "9P2000", expect: "9P2000", ok: true},
+		{req: "9P2000.u", expect: "9P2000.u", ok: true},
+		{req: "9P2000.L", expect: "9P2000", ok: true},
+		{req: "9P2000.foo", expect: "9P2000", ok: true},
+		{req: "9P3000", expect: proto.VersionUnknown},
+		{req: "something", expect: proto.VersionUnknown},
+	}
+
+	for _, test := range tests {
+		version, _, ok := dialects.Negotiate(test.req)
+		if (version != test.expect) || (ok != test.ok) {
+			t.Errorf("%q: expected (%q, %v) but got (%q, %v)", test.req, test.expect, test.ok, version, ok)
+		}
+	}
+}
+
+func slowHandler(delay time.Duration) proto.ConnHandler {
+	return proto.ConnHandlerFunc(func() proto.MessageHandler {
+		return proto.MessageHandlerFunc(func(msg any) any {
+			switch msg := msg.(type) {
+			case *p9.Tversion:
+				return &p9.Rversion{Msize: msg.Msize, Version: msg.Version}
+			case *p9.Tread:
+				time.Sleep(delay)
+				return &p9.Rread{Data: []byte("done")}
+			default:
+				return &p9.Rerror{Ename: "unexpected message"}
+			}
+		})
+	})
+}
+
+func TestServerShutdown(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m sync.Mutex
+	var states []proto.ConnState
+	srv := &proto.Server{
+		Proto:       p9.Proto(),
+		ConnHandler: slowHandler(100 * time.Millisecond),
+		ConnState: func(c net.Conn, state proto.ConnState) {
+			m.Lock()
+			defer m.Unlock()
+			states = append(states, state)
+		},
+	}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(lis) }()
+
+	c, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	err = p9.Proto().Send(c, p9.NoTag, &p9.Tversion{Msize: 1024, Version: p9.Version})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = p9.Proto().Receive(c, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p9.Proto().Send(c, 1, &p9.Tread{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	err = srv.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-serveErr; err != proto.ErrServerClosed {
+		t.Errorf("Expected ErrServerClosed from Serve but got %v", err)
+	}
+
+	msg, tag, err := p9.Proto().Receive(c, 1024)
+	if err != nil {
+		t.Fatalf("In-flight request was not answered: %v", err)
+	}
+	if read, ok := msg.(*p9.Rread); !ok || (tag != 1) || (string(read.Data) != "done") {
+		t.Errorf("Unexpected response: %#v with tag %v", msg, tag)
+	}
+
+	_, _, err = p9.Proto().Receive(c, 1024)
+	if err != io.EOF {
+		t.Errorf("Expected connection to be closed but got %v", err)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if (len(states) == 0) || (states[0] != proto.StateNew) || (states[len(states)-1] != proto.StateClosed) {
+		t.Errorf("Unexpected state transitions: %v", states)
+	}
+}
+
+func TestServerDisconnect(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closed := make(chan struct{})
+	srv := &proto.Server{
+		Proto: p9.Proto(),
+		ConnHandler: proto.ConnHandlerFunc(func() proto.MessageHandler {
+			return blockHandler{}
+		}),
+		ConnState: func(c net.Conn, state proto.ConnState) {
+			if state == proto.StateClosed {
+				close(closed)
+			}
+		},
+	}
+	go srv.Serve(lis)
+
+	c, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p9.Proto().Send(c, p9.NoTag, &p9.Tversion{Msize: 1024, Version: p9.Version})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = p9.Proto().Receive(c, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p9.Proto().Send(c, 1, &p9.Tread{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	c.Close()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Connection with a blocked request was not closed after the client disconnected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = srv.Shutdown(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// blockHandler blocks reads until they are cancelled.
+type blockHandler struct{}
+
+func (blockHandler) HandleMessage(msg any) any {
+	return blockHandler{}.HandleMessageContext(context.Background(), msg)
+}
+
+func (blockHandler) HandleMessageContext(ctx context.Context, msg any) any {
+	switch msg := msg.(type) {
+	case *p9.Tversion:
+		return &p9.Rversion{Msize: msg.Msize, Version: msg.Version}
+	case *p9.Tread:
+		<-ctx.Done()
+		return &p9.Rerror{Ename: ctx.Err().Error()}
+	default:
+		return &p9.Rerror{Ename: "unexpected message"}
+	}
+}
+
+func TestServerIdleTimeout(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &proto.Server{
+		Proto:       p9.Proto(),
+		ConnHandler: slowHandler(0),
+		IdleTimeout: 50 * time.Millisecond,
+	}
+	go srv.Serve(lis)
+	defer srv.Close()
+
+	c, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = p9.Proto().Receive(c, 1024)
+	if err != io.EOF {
+		t.Errorf("Expected idle connection to be closed but got %v", err)
+	}
+}
+
+// concurrencyHandler handles Treads by waiting for a duration given
+// by the offset, in milliseconds, or until the request is cancelled.
+type concurrencyHandler struct {
+	m       sync.Mutex
+	current int
+	max     int
+}
+
+func (h *concurrencyHandler) HandleMessage(msg any) any {
+	return h.HandleMessageContext(context.Background(), msg)
+}
+
+func (h *concurrencyHandler) HandleMessageContext(ctx context.Context, msg any) any {
+	switch msg := msg.(type) {
+	case *p9.Tversion:
+		return &p9.Rversion{Msize: msg.Msize, Version: msg.Version}
+	case *p9.Tflush:
+		return &p9.Rflush{}
+	case *p9.Tread:
+		h.m.Lock()
+		h.current++
+		h.max = max(h.max, h.current)
+		h.m.Unlock()
+		defer func() {
+			h.m.Lock()
+			h.current--
+			h.m.Unlock()
+		}()
+
+		select {
+		case <-time.After(time.Duration(msg.Offset) * time.Millisecond):
+		case <-ctx.Done():
+		}
+		return &p9.Rread{}
+	default:
+		return &p9.Rerror{Ename: "unexpected message"}
+	}
+}
+
+func serveConcurrency(t *testing.T, srv *proto.Server) net.Conn {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(func() { srv.Close() })
+
+	c, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	err = p9.Proto().Send(c, p9.NoTag, &p9.Tversion{Msize: 1024, Version: p9.Version})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = p9.Proto().Receive(c, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestServerMaxConnRequests(t *testing.T) {
+	h := &concurrencyHandler{}
+	c := serveConcurrency(t, &proto.Server{
+		Proto:           p9.Proto(),
+		ConnHandler:     proto.ConnHandlerFunc(func() proto.MessageHandler { return h }),
+		MaxConnRequests: 2,
+	})
+
+	for i := 0; i < 6; i++ {
+		err := p9.Proto().Send(c, uint16(i), &p9.Tread{FID: uint32(i), Offset: 20})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 6; i++ {
+		_, _, err := p9.Proto().Receive(c, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if h.max > 2 {
+		t.Errorf("Expected at most 2 concurrent requests but got %v", h.max)
+	}
+
+	// Flushes must get through even if the limit has been reached.
+	for i := 0; i < 2; i++ {
+		err := p9.Proto().Send(c, uint16(i), &p9.Tread{FID: uint32(i), Offset: 60000})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		err := p9.Proto().Send(c, uint16(10+i), &p9.Tflush{OldTag: uint16(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < 2; i++ {
+		msg, _, err := p9.Proto().Receive(c, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := msg.(*p9.Rflush); !ok {
+			t.Errorf("Expected Rflush but got %#v", msg)
+		}
+	}
+}
+
+func TestServerOrderRequests(t *testing.T) {
+	c := serveConcurrency(t, &proto.Server{
+		Proto:         p9.Proto(),
+		ConnHandler:   proto.ConnHandlerFunc(func() proto.MessageHandler { return &concurrencyHandler{} }),
+		OrderRequests: true,
+	})
+
+	// The first request to FID 1 takes longer, but must still be
+	// answered first. The request to FID 2 is not held up by it.
+	send := []struct {
+		tag   uint16
+		fid   uint32
+		delay uint64
+	}{
+		{tag: 1, fid: 1, delay: 100},
+		{tag: 2, fid: 1, delay: 0},
+		{tag: 3, fid: 2, delay: 0},
+	}
+	for _, s := range send {
+		err := p9.Proto().Send(c, s.tag, &p9.Tread{FID: s.fid, Offset: s.delay})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var order []uint16
+	for range send {
+		_, tag, err := p9.Proto().Receive(c, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		order = append(order, tag)
+	}
+
+	if !slices.Equal(order, []uint16{3, 1, 2}) {
+		t.Errorf("Unexpected response order: %v", order)
+	}
+}
+
+func TestClientConnectionLost(t *testing.T) {
+	cc, sc := net.Pipe()
+	client := proto.NewClient(p9.Proto(), cc)
+	defer client.Close()
+
+	disconnected := make(chan error, 1)
+	client.SetDisconnectHandler(func(err error) { disconnected <- err })
+
+	// Close the server side of the connection once the request has
+	// arrived, without responding.
+	go func() {
+		p9.Proto().Receive(sc, 1024)
+		sc.Close()
+	}()
+
+	_, err := client.Send(&p9.Tstat{FID: 1})
+	if !errors.Is(err, proto.ErrConnectionLost) || !errors.Is(err, io.EOF) {
+		t.Fatalf("Expected lost connection due to EOF but got %v", err)
+	}
+
+	select {
+	case <-client.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done channel not closed")
+	}
+	if err := client.Err(); !errors.Is(err, proto.ErrConnectionLost) {
+		t.Errorf("Expected Err to return lost connection but got %v", err)
+	}
+	if err := <-disconnected; !errors.Is(err, proto.ErrConnectionLost) {
+		t.Errorf("Expected disconnect handler to get lost connection but got %v", err)
+	}
+
+	_, err = client.Send(&p9.Tstat{FID: 1})
+	if !errors.Is(err, proto.ErrConnectionLost) {
+		t.Errorf("Expected lost connection for later send but got %v", err)
+	}
+}
+
+func TestClientFlush(t *testing.T) {
+	cc, sc := net.Pipe()
+	defer sc.Close()
+	client := proto.NewClient(p9.Proto(), cc)
+	defer client.Close()
+	client.SetMsize(1024)
+	client.SetFlush(func(tag uint16) any { return &p9.Tflush{OldTag: tag} })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error, 1)
+	go func() {
+		_, err := client.SendContext(ctx, &p9.Tstat{FID: 1})
+		errC <- err
+	}()
+
+	_, tag, err := p9.Proto().Receive(sc, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := <-errC; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled but got %v", err)
+	}
+
+	msg, ftag, err := p9.Proto().Receive(sc, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flush, ok := msg.(*p9.Tflush); !ok || (flush.OldTag != tag) {
+		t.Fatalf("Expected flush of tag %v but got %#v", tag, msg)
+	}
+
+	// Respond to the flushed request before acknowledging the flush, as
+	// a server that had already finished it would.
+	err = p9.Proto().Send(sc, tag, &p9.Rerror{Ename: "late"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p9.Proto().Send(sc, ftag, &p9.Rflush{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		_, tag, err := p9.Proto().Receive(sc, 1024)
+		if err == nil {
+			p9.Proto().Send(sc, tag, &p9.Rclunk{})
+		}
+	}()
+	rsp, err := client.Send(&p9.Tclunk{FID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rsp.(*p9.Rclunk); !ok {
+		t.Errorf("Expected Rclunk but got %#v", rsp)
+	}
+}
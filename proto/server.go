@@ -1,12 +1,21 @@
 package proto
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"io"
 	"log"
 	"net"
+	"os"
 	"sync"
+	"time"
 )
 
+// ErrServerClosed is returned by the Serve method of a Server after a
+// call to Shutdown or Close.
+var ErrServerClosed = errors.New("server closed")
+
 // Serve serves a server for the given Proto, listening for new
 // connection on lis and handling them using the provided handler.
 //
@@ -14,31 +23,32 @@ import (
 // handled entirely sequentially until an msize has been established,
 // at which point they will be handled concurrently. An msize is
 // established when a handler returns a Msizer.
+//
+// Serve is a convenience function for using a Server with default
+// options.
 func Serve(lis net.Listener, p Proto, connHandler ConnHandler) (err error) {
-	for {
-		c, err := lis.Accept()
-		if err != nil {
-			return err
-		}
-
-		go func() {
-			defer c.Close()
+	return ServeContext(context.Background(), lis, p, connHandler)
+}
 
-			if h, ok := connHandler.(handleConn); ok {
-				h.HandleConn(c)
-			}
-			if h, ok := connHandler.(handleDisconnect); ok {
-				defer h.HandleDisconnect(c)
-			}
+// ServeContext is like Serve, but stops serving when ctx is
+// cancelled. When that happens, lis is closed, the contexts of all
+// pending requests are cancelled, and ServeContext returns ctx.Err().
+//
+// The contexts passed to ContextHandlers are derived from ctx.
+func ServeContext(ctx context.Context, lis net.Listener, p Proto, connHandler ConnHandler) (err error) {
+	srv := &Server{
+		Proto:       p,
+		ConnHandler: connHandler,
+	}
 
-			mh := connHandler.MessageHandler()
-			if c, ok := mh.(io.Closer); ok {
-				defer c.Close()
-			}
+	stop := context.AfterFunc(ctx, func() { srv.Close() })
+	defer stop()
 
-			handleMessages(c, p, mh)
-		}()
+	err = srv.serve(ctx, lis)
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
+	return err
 }
 
 // ListenAndServe is a convenience function that establishes a
@@ -58,32 +68,604 @@ func ListenAndServe(network, addr string, p Proto, connHandler ConnHandler) (rer
 	return Serve(lis, p, connHandler)
 }
 
-func handleMessages(c net.Conn, p Proto, handler MessageHandler) {
+// ConnState represents the state of a connection to a Server. It is
+// used by the Server's ConnState hook.
+type ConnState int
+
+const (
+	// StateNew is the state of a connection that has just been
+	// accepted and has not yet sent a message.
+	StateNew ConnState = iota
+
+	// StateActive is the state of a connection that is in the middle of
+	// sending a message or that has requests in flight.
+	StateActive
+
+	// StateIdle is the state of a connection that has no requests in
+	// flight and is waiting for the next one.
+	StateIdle
+
+	// StateClosed is the state of a connection that has been closed.
+	// It is the final state.
+	StateClosed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateNew:
+		return "new"
+	case StateActive:
+		return "active"
+	case StateIdle:
+		return "idle"
+	case StateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// Server serves a protocol to clients. Its fields configure the
+// server and should not be modified once it has started serving. The
+// zero value is not usable, as Proto and ConnHandler must be set.
+type Server struct {
+	// Proto is the protocol used by new connections. It can be changed
+	// for a single connection by a MessageHandler that implements
+	// Protoer.
+	Proto Proto
+
+	// ConnHandler provides the MessageHandlers for new connections.
+	ConnHandler ConnHandler
+
+	// ConnState, if not nil, is called whenever a connection changes
+	// state. Calls for a single connection are made in order, but it
+	// may be called concurrently for different connections.
+	ConnState func(net.Conn, ConnState)
+
+	// ErrorLog is used to log errors that occur while handling
+	// connections. If it is nil, the log package's standard logger is
+	// used.
+	ErrorLog *log.Logger
+
+	// ReadTimeout is the maximum amount of time that reading a single
+	// message may take once it has started arriving. If it is zero,
+	// there is no limit.
+	ReadTimeout time.Duration
+
+	// IdleTimeout is the maximum amount of time to wait for the next
+	// message from a connection that has no requests in flight. If it
+	// is zero, there is no limit.
+	IdleTimeout time.Duration
+
+	// MaxConnRequests is the maximum number of requests from a single
+	// connection that may be handled at the same time. Once it has been
+	// reached, no further messages are read from the connection until
+	// one of the requests finishes. If it is zero, there is no limit.
+	//
+	// Requests that implement Flusher are exempt so that clients can
+	// always flush requests that are blocking.
+	MaxConnRequests int
+
+	// MaxRequests is like MaxConnRequests, but limits the number of
+	// requests being handled across all connections.
+	MaxRequests int
+
+	// OrderRequests, if true, causes requests from a single connection
+	// that implement Sequencer and that return the same value from
+	// P9Sequence to be handled one at a time in the order that they
+	// were received. Other requests are still handled concurrently.
+	OrderRequests bool
+
+	semOnce sync.Once
+	sem     chan struct{}
+
+	m         sync.Mutex
+	shutdown  bool
+	listeners map[*net.Listener]struct{}
+	conns     map[*conn]struct{}
+	wg        sync.WaitGroup
+}
+
+// Serve accepts connections from lis and serves them until lis
+// returns an error or the server is shut down, in which case it
+// returns ErrServerClosed. lis is closed when Serve returns.
+func (srv *Server) Serve(lis net.Listener) error {
+	return srv.serve(context.Background(), lis)
+}
+
+// ListenAndServe establishes a listener via net.Listen and then calls
+// Serve.
+func (srv *Server) ListenAndServe(network, addr string) error {
+	lis, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+
+	return srv.Serve(lis)
+}
+
+func (srv *Server) serve(ctx context.Context, lis net.Listener) error {
+	defer lis.Close()
+
+	if !srv.trackListener(&lis, true) {
+		return ErrServerClosed
+	}
+	defer srv.trackListener(&lis, false)
+
+	for {
+		c, err := lis.Accept()
+		if err != nil {
+			if srv.shuttingDown() {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		sc := srv.newConn(ctx, c)
+		if sc == nil {
+			c.Close()
+			return ErrServerClosed
+		}
+		go sc.serve()
+	}
+}
+
+// Shutdown gracefully shuts down the server. It closes all listeners,
+// stops reading new requests from connections, waits for the requests
+// that are in flight to finish, and then closes the connections. If
+// ctx is cancelled before that has happened, Shutdown returns
+// ctx.Err() and leaves the remaining connections to finish on their
+// own. Close can be used to force them closed.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	srv.m.Lock()
+	srv.shutdown = true
+	err := srv.closeListeners()
+	for c := range srv.conns {
+		c.interrupt()
+	}
+	srv.m.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		srv.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close immediately closes all listeners and connections. The
+// contexts of requests that are in flight are cancelled.
+func (srv *Server) Close() error {
+	srv.m.Lock()
+	defer srv.m.Unlock()
+
+	srv.shutdown = true
+	err := srv.closeListeners()
+	for c := range srv.conns {
+		c.cancel()
+		c.rwc.Close()
+	}
+	return err
+}
+
+func (srv *Server) closeListeners() (err error) {
+	for lis := range srv.listeners {
+		cerr := (*lis).Close()
+		if (cerr != nil) && (err == nil) {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (srv *Server) shuttingDown() bool {
+	srv.m.Lock()
+	defer srv.m.Unlock()
+
+	return srv.shutdown
+}
+
+func (srv *Server) trackListener(lis *net.Listener, add bool) bool {
+	srv.m.Lock()
+	defer srv.m.Unlock()
+
+	if !add {
+		delete(srv.listeners, lis)
+		return true
+	}
+
+	if srv.shutdown {
+		return false
+	}
+	if srv.listeners == nil {
+		srv.listeners = make(map[*net.Listener]struct{})
+	}
+	srv.listeners[lis] = struct{}{}
+	return true
+}
+
+func (srv *Server) newConn(ctx context.Context, c net.Conn) *conn {
+	srv.m.Lock()
+	defer srv.m.Unlock()
+
+	if srv.shutdown {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	sc := &conn{
+		srv:    srv,
+		rwc:    c,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if srv.MaxConnRequests > 0 {
+		sc.sem = make(chan struct{}, srv.MaxConnRequests)
+	}
+
+	if srv.conns == nil {
+		srv.conns = make(map[*conn]struct{})
+	}
+	srv.conns[sc] = struct{}{}
+	srv.wg.Add(1)
+
+	return sc
+}
+
+// semaphore returns the channel used to enforce MaxRequests, or nil
+// if there is no limit.
+func (srv *Server) semaphore() chan struct{} {
+	srv.semOnce.Do(func() {
+		if srv.MaxRequests > 0 {
+			srv.sem = make(chan struct{}, srv.MaxRequests)
+		}
+	})
+	return srv.sem
+}
+
+func (srv *Server) logf(format string, args ...any) {
+	if srv.ErrorLog != nil {
+		srv.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// conn is a single connection to a Server.
+type conn struct {
+	srv    *Server
+	rwc    net.Conn
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	m        sync.Mutex
+	state    ConnState
+	inflight int
+	waiting  bool
+	closing  bool
+	reqs     sync.WaitGroup
+
+	sem chan struct{}
+
+	orderM sync.Mutex
+	order  map[uint32]chan struct{}
+}
+
+func (c *conn) serve() {
+	defer func() {
+		c.cancel()
+		c.rwc.Close()
+
+		c.srv.m.Lock()
+		delete(c.srv.conns, c)
+		c.srv.m.Unlock()
+
+		c.m.Lock()
+		c.setState(StateClosed)
+		c.m.Unlock()
+
+		c.srv.wg.Done()
+	}()
+
+	c.m.Lock()
+	c.setState(StateNew)
+	c.m.Unlock()
+
+	connHandler := c.srv.ConnHandler
+	if h, ok := connHandler.(handleConn); ok {
+		h.HandleConn(c.rwc)
+	}
+	if h, ok := connHandler.(handleDisconnect); ok {
+		defer h.HandleDisconnect(c.rwc)
+	}
+
+	mh := connHandler.MessageHandler()
+	if c, ok := mh.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	c.handleMessages(mh)
+}
+
+// setState changes the state of the connection. c.m must be held.
+func (c *conn) setState(state ConnState) {
+	if (c.state == state) && (state != StateNew) {
+		return
+	}
+
+	c.state = state
+	if c.srv.ConnState != nil {
+		c.srv.ConnState(c.rwc, state)
+	}
+}
+
+// setDeadline sets the read deadline for d from now, or clears it if
+// d is zero. c.m must be held.
+func (c *conn) setDeadline(d time.Duration) {
+	var t time.Time
+	if d > 0 {
+		t = time.Now().Add(d)
+	}
+	c.rwc.SetReadDeadline(t)
+}
+
+// wait is called before waiting for the next message to arrive.
+func (c *conn) wait() {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.waiting = true
+	if c.closing {
+		c.rwc.SetReadDeadline(time.Now())
+		return
+	}
+	if c.inflight > 0 {
+		c.setDeadline(0)
+		return
+	}
+
+	if c.state == StateActive {
+		c.setState(StateIdle)
+	}
+	c.setDeadline(c.srv.IdleTimeout)
+}
+
+// arrived is called when a message has started arriving. It returns
+// false if the connection is being shut down and the message should
+// not be read.
+func (c *conn) arrived() bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.waiting = false
+	if c.closing {
+		return false
+	}
+
+	c.setState(StateActive)
+	c.setDeadline(c.srv.ReadTimeout)
+	return true
+}
+
+// isClosing returns true if the connection is being shut down.
+func (c *conn) isClosing() bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.closing
+}
+
+// interrupt stops the connection from waiting for further messages.
+// It is used when the server is shutting down.
+func (c *conn) interrupt() {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.closing = true
+	if c.waiting {
+		c.rwc.SetReadDeadline(time.Now())
+	}
+}
+
+// acquire waits until the limits on concurrent requests allow for
+// another one to be handled. It returns a function that must be
+// called once the request is done, or nil if the connection was
+// closed while waiting.
+func (c *conn) acquire(msg any) func() {
+	if _, ok := msg.(Flusher); ok {
+		return func() {}
+	}
+
+	if c.sem != nil {
+		select {
+		case c.sem <- struct{}{}:
+		case <-c.ctx.Done():
+			return nil
+		}
+	}
+
+	sem := c.srv.semaphore()
+	if sem != nil {
+		select {
+		case sem <- struct{}{}:
+		case <-c.ctx.Done():
+			if c.sem != nil {
+				<-c.sem
+			}
+			return nil
+		}
+	}
+
+	return func() {
+		if sem != nil {
+			<-sem
+		}
+		if c.sem != nil {
+			<-c.sem
+		}
+	}
+}
+
+// sequence orders msg after the previously received requests with the
+// same sequence key, if ordering is enabled. It returns a channel that
+// is closed when msg may be handled, or nil if msg does not need to
+// wait, and a function that must be called once msg is done.
+func (c *conn) sequence(msg any) (<-chan struct{}, func()) {
+	seq, ok := msg.(Sequencer)
+	if !c.srv.OrderRequests || !ok {
+		return nil, func() {}
+	}
+	key := seq.P9Sequence()
+
+	c.orderM.Lock()
+	defer c.orderM.Unlock()
+
+	if c.order == nil {
+		c.order = make(map[uint32]chan struct{})
+	}
+
+	prev := c.order[key]
+	done := make(chan struct{})
+	c.order[key] = done
+
+	return prev, func() {
+		c.orderM.Lock()
+		if c.order[key] == done {
+			delete(c.order, key)
+		}
+		c.orderM.Unlock()
+
+		close(done)
+	}
+}
+
+func (c *conn) startRequest() {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.inflight++
+	c.reqs.Add(1)
+}
+
+func (c *conn) finishRequest() {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.inflight--
+	if (c.inflight == 0) && c.waiting {
+		c.setState(StateIdle)
+		c.setDeadline(c.srv.IdleTimeout)
+	}
+	c.reqs.Done()
+}
+
+func (c *conn) handleMessages(handler MessageHandler) {
 	var setter sync.Once
 
+	ctx := c.ctx
+	s := newSession(ctx)
+	defer func() {
+		// If the server is shutting down, requests that are in flight
+		// are allowed to finish. Otherwise, the client is gone or the
+		// connection failed, so nothing is waiting for their responses
+		// and they are cancelled so that blocked requests don't keep
+		// the connection open.
+		if !c.isClosing() {
+			s.close()
+		}
+		c.reqs.Wait()
+		s.close()
+	}()
+
+	p := c.srv.Proto
 	var msize uint32
 	mode := func(f func()) {
 		f()
 	}
 
+	releaser, _ := handler.(Releaser)
+
+	br := bufio.NewReader(c.rwc)
 	for {
-		tmsg, tag, err := p.Receive(c, msize)
+		c.wait()
+		_, err := br.Peek(1)
 		if err != nil {
-			if err == io.EOF {
-				return
+			if !c.expectedError(err, true) {
+				c.srv.logf("Error reading message: %v", err)
+			}
+			return
+		}
+		if !c.arrived() {
+			return
+		}
+
+		// Request messages are decoded from pooled buffers. Once the
+		// request has been handled the buffer is returned to the pool, so
+		// handlers must not retain data from them.
+		tmsg, tag, buf, err := p.receive(br, msize, receiveOptions{pooled: true})
+		if err != nil {
+			if !c.expectedError(err, false) {
+				c.srv.logf("Error reading message: %v", err)
 			}
+			return
+		}
 
-			log.Printf("Error reading message: %v", err)
+		release := c.acquire(tmsg)
+		if release == nil {
+			if buf != nil {
+				putBuffer(buf)
+			}
+			return
 		}
 
+		c.startRequest()
+		ctx, req := s.start(tag)
+		wait, next := c.sequence(tmsg)
 		mode(func() {
-			rmsg := handler.HandleMessage(tmsg)
-			if rmsg, ok := rmsg.(Msizer); ok {
+			defer c.finishRequest()
+			defer release()
+			defer s.finish(tag, req)
+			if buf != nil {
+				defer putBuffer(buf)
+			}
+
+			if wait != nil {
+				select {
+				case <-wait:
+				case <-ctx.Done():
+					// The request was flushed before it started, so it can
+					// be dropped, but requests after it still have to wait
+					// for the ones before it.
+					go func() {
+						<-wait
+						next()
+					}()
+					return
+				}
+			}
+			defer next()
+
+			if f, ok := tmsg.(Flusher); ok {
+				s.flush(tag, f.P9Flush())
+			}
+
+			rmsg := handleMessage(ctx, handler, tmsg)
+			if rmsg, ok := rmsg.(Msizer); ok && (rmsg.P9Msize() > 0) {
 				if msize > 0 {
-					log.Println("Warning: Attempted to set msize twice.")
+					c.srv.logf("Warning: Attempted to set msize twice.")
 				}
 
 				setter.Do(func() {
+					if h, ok := handler.(Protoer); ok {
+						p = h.P9Proto()
+					}
+
 					msize = rmsg.P9Msize()
 					mode = func(f func()) {
 						go f()
@@ -91,14 +673,136 @@ func handleMessages(c net.Conn, p Proto, handler MessageHandler) {
 				})
 			}
 
-			err := p.Send(c, tag, rmsg)
+			if releaser != nil {
+				defer releaser.P9Release(rmsg)
+			}
+
+			if s.flushed(req) {
+				return
+			}
+
+			err := p.Send(c.rwc, tag, rmsg)
 			if err != nil {
-				log.Printf("Error writing message: %v", err)
+				c.srv.logf("Error writing message: %v", err)
 			}
 		})
 	}
 }
 
+// expectedError returns true if err is the result of the connection
+// being closed normally, being shut down, or timing out while idle.
+func (c *conn) expectedError(err error, idle bool) bool {
+	switch {
+	case (err == io.EOF) || (c.ctx.Err() != nil) || errors.Is(err, net.ErrClosed):
+		return true
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return idle
+	default:
+		return false
+	}
+}
+
+func handleMessage(ctx context.Context, handler MessageHandler, msg any) any {
+	if h, ok := handler.(ContextHandler); ok {
+		return h.HandleMessageContext(ctx, msg)
+	}
+	return handler.HandleMessage(msg)
+}
+
+// session tracks the requests that are currently being handled for a
+// single connection so that they can be flushed.
+type session struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	m    sync.Mutex
+	reqs map[uint16]*request
+}
+
+type request struct {
+	cancel  context.CancelFunc
+	done    chan struct{}
+	flushed bool
+}
+
+func newSession(ctx context.Context) *session {
+	ctx, cancel := context.WithCancel(ctx)
+	return &session{
+		ctx:    ctx,
+		cancel: cancel,
+		reqs:   make(map[uint16]*request),
+	}
+}
+
+// close cancels the contexts of all requests that are still in
+// flight. It should be called when the connection is closed.
+func (s *session) close() {
+	s.cancel()
+}
+
+// start registers a new request with the given tag, returning a
+// context that is cancelled if the request is flushed or the session
+// is closed.
+func (s *session) start(tag uint16) (context.Context, *request) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	req := &request{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	if tag != NoTag {
+		s.m.Lock()
+		s.reqs[tag] = req
+		s.m.Unlock()
+	}
+
+	return ctx, req
+}
+
+// finish marks a request as no longer being in flight. It must be
+// called after the response, if any, has been sent.
+func (s *session) finish(tag uint16, req *request) {
+	s.m.Lock()
+	if s.reqs[tag] == req {
+		delete(s.reqs, tag)
+	}
+	s.m.Unlock()
+
+	req.cancel()
+	close(req.done)
+}
+
+// flush cancels the request with the given old tag and then waits
+// for it to either send its response or be abandoned. tag is the tag
+// of the flush request itself.
+func (s *session) flush(tag, old uint16) {
+	if tag == old {
+		return
+	}
+
+	s.m.Lock()
+	req, ok := s.reqs[old]
+	if ok {
+		req.flushed = true
+	}
+	s.m.Unlock()
+	if !ok {
+		return
+	}
+
+	req.cancel()
+	<-req.done
+}
+
+// flushed returns true if req has been flushed and its response
+// should therefore not be sent.
+func (s *session) flushed(req *request) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return req.flushed
+}
+
 // ConnHandler initializes new MessageHandlers for incoming
 // connections. Unlike HTTP, which is a connectionless protocol, 9P
 // and related protocols require that each connection be handled as a
@@ -132,12 +836,29 @@ func (h ConnHandlerFunc) MessageHandler() MessageHandler {
 //
 // If a MessageHandler also implements io.Closer, then Close will be
 // called when the connection ends. Its return value is ignored.
+//
+// Byte slices in received messages, such as the data of a write, are
+// only valid until the message has been handled and must not be
+// retained.
 type MessageHandler interface {
 	// HandleMessage is passed received messages from the client. Its
 	// return value is then sent back to the client with the same tag.
 	HandleMessage(any) any
 }
 
+// ContextHandler is implemented by MessageHandlers that want to know
+// when the requests that they are handling have been abandoned. If a
+// MessageHandler implements ContextHandler, HandleMessageContext is
+// called instead of HandleMessage.
+//
+// The context passed to HandleMessageContext is cancelled if the
+// client flushes the request, if the connection is closed, or if the
+// server is stopped. Once a request has been flushed, its
+// response is not sent to the client.
+type ContextHandler interface {
+	HandleMessageContext(ctx context.Context, msg any) any
+}
+
 // MessageHandlerFunc allows a function to be used as a MessageHandler.
 type MessageHandlerFunc func(any) any
 
@@ -145,13 +866,52 @@ func (h MessageHandlerFunc) HandleMessage(msg any) any {
 	return h(msg)
 }
 
+// Releaser is implemented by MessageHandlers that want to reuse the
+// resources held by a response, such as a pooled buffer, once it is
+// no longer needed. If a MessageHandler implements Releaser,
+// P9Release is called with every response that it returns after that
+// response has been sent or, if the request was flushed, discarded.
+type Releaser interface {
+	P9Release(msg any)
+}
+
+// Protoer is implemented by MessageHandlers that can change the
+// protocol that is used for a connection, such as when a specific
+// dialect is selected during version negotiation. If a MessageHandler
+// implements Protoer, P9Proto is called when an msize is
+// established, and the returned Proto is used for both sending the
+// response that established the msize and for all messages after it.
+type Protoer interface {
+	P9Proto() Proto
+}
+
+// Flusher is implemented by message types that request that a
+// previously sent request be flushed. P9Flush returns the tag of the
+// request to flush.
+//
+// When a Flusher is received, the request that it refers to, if it
+// is still in flight, is cancelled and the Flusher is not passed to
+// the MessageHandler until that request has finished.
+type Flusher interface {
+	P9Flush() uint16
+}
+
+// Sequencer is implemented by message types that should be handled in
+// order relative to other messages with the same sequence key when a
+// Server's OrderRequests option is set. In 9P, for example, the key is
+// the FID that a request operates on.
+type Sequencer interface {
+	P9Sequence() uint32
+}
+
 // Msizer is implemented by types that, when returned from a message
 // handler, should modify the maximum message size that the server
 // should from that point forward.
 //
 // Note that if this is returned more than once for a single
 // connection, a warning will be printed to stderr and the later
-// values will be ignored.
+// values will be ignored. An msize of 0 does not count, which allows
+// a failed version negotiation to be retried.
 type Msizer interface {
 	P9Msize() uint32
 }
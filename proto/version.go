@@ -0,0 +1,36 @@
+package proto
+
+import "strings"
+
+// VersionUnknown is the version that a server responds with if it
+// does not support any version that is acceptable for the client's
+// request.
+const VersionUnknown = "unknown"
+
+// Dialects is a set of dialects of a protocol, mapping version
+// strings, such as "9P2000", to the Proto that implements them.
+type Dialects map[string]Proto
+
+// Negotiate selects a dialect in response to the version requested
+// by a client. As described by the specification, the requested
+// version is used if it is supported. Otherwise, if the requested
+// version has a suffix starting with a period, such as "9P2000.foo",
+// it falls back to the version without the suffix. If neither is
+// supported, or if the requested version does not start with "9P",
+// it returns VersionUnknown and false.
+func (d Dialects) Negotiate(version string) (string, Proto, bool) {
+	if !strings.HasPrefix(version, "9P") {
+		return VersionUnknown, Proto{}, false
+	}
+
+	if p, ok := d[version]; ok {
+		return version, p, true
+	}
+
+	base, _, _ := strings.Cut(version, ".")
+	if p, ok := d[base]; ok {
+		return base, p, true
+	}
+
+	return VersionUnknown, Proto{}, false
+}
@@ -0,0 +1,146 @@
+package p9
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// qidVersion derives a QID version from the modification time,
+// change time, and size of a file, so that the version changes
+// whenever the contents or metadata of the file do. Zero times are
+// ignored.
+func qidVersion(mtime, ctime time.Time, size uint64) uint32 {
+	var buf [24]byte
+	if !mtime.IsZero() {
+		binary.LittleEndian.PutUint64(buf[0:], uint64(mtime.UnixNano()))
+	}
+	if !ctime.IsZero() {
+		binary.LittleEndian.PutUint64(buf[8:], uint64(ctime.UnixNano()))
+	}
+	binary.LittleEndian.PutUint64(buf[16:], size)
+
+	h := fnv.New32a()
+	h.Write(buf[:])
+	return h.Sum32()
+}
+
+// qidPath derives a QID path from the device and inode numbers of a
+// file. Different inodes on the same device always produce different
+// paths, and the device is mixed into every bit of the result so that
+// files on different devices, such as those mounted beneath an
+// exported directory, are very unlikely to collide.
+func qidPath(dev, ino uint64) uint64 {
+	// This is the finalizer of SplitMix64, which is a bijection.
+	dev ^= dev >> 30
+	dev *= 0xBF58476D1CE4E5B9
+	dev ^= dev >> 27
+	dev *= 0x94D049BB133111EB
+	dev ^= dev >> 31
+
+	return ino ^ dev
+}
+
+// QIDGen generates QIDs for Attachments that have no other way of
+// uniquely identifying their files. Each path is assigned a unique QID
+// path the first time that a QID is generated for it, and versions are
+// derived from the files' DirEntries. The zero value is ready to use.
+//
+// Paths are remembered until they are passed to Remove, so an
+// Attachment using a QIDGen should call Remove and Rename when files
+// are removed and renamed, respectively.
+type QIDGen struct {
+	m     sync.Mutex
+	paths map[string]uint64
+	next  uint64
+}
+
+// QID returns a QID for the file at p described by stat. If stat has
+// a non-zero Version, it is used as is. Otherwise, the version is
+// derived from the modification time and length of the file.
+func (g *QIDGen) QID(p string, stat DirEntry) QID {
+	p = path.Clean(p)
+
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	qpath, ok := g.paths[p]
+	if !ok {
+		if g.paths == nil {
+			g.paths = make(map[string]uint64)
+		}
+
+		qpath = g.next
+		g.next++
+		g.paths[p] = qpath
+	}
+
+	version := stat.Version
+	if version == 0 {
+		version = qidVersion(stat.MTime, time.Time{}, stat.Length)
+	}
+
+	return QID{
+		Type:    stat.FileMode.QIDType(),
+		Version: version,
+		Path:    qpath,
+	}
+}
+
+// Remove forgets the paths of the file at p and of all files beneath
+// it, so that a new file created at p is given a new QID path.
+func (g *QIDGen) Remove(p string) {
+	p = path.Clean(p)
+
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	for k := range g.paths {
+		if beneath(k, p) {
+			delete(g.paths, k)
+		}
+	}
+}
+
+// Rename moves the QID paths of the file at oldpath and all files
+// beneath it to newpath, replacing those of any files already there.
+func (g *QIDGen) Rename(oldpath, newpath string) {
+	oldpath, newpath = path.Clean(oldpath), path.Clean(newpath)
+
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	for k := range g.paths {
+		if beneath(k, newpath) {
+			delete(g.paths, k)
+		}
+	}
+
+	moved := make(map[string]uint64)
+	for k, v := range g.paths {
+		if beneath(k, oldpath) {
+			moved[newpath+k[len(oldpath):]] = v
+			delete(g.paths, k)
+		}
+	}
+	for k, v := range moved {
+		g.paths[k] = v
+	}
+}
+
+// beneath reports whether or not p is dir or a path beneath it. Both
+// must be clean.
+func beneath(p, dir string) bool {
+	switch dir {
+	case p:
+		return true
+	case "/":
+		return strings.HasPrefix(p, "/")
+	case ".":
+		return !strings.HasPrefix(p, "/")
+	}
+	return strings.HasPrefix(p, dir) && (p[len(dir)] == '/')
+}
@@ -0,0 +1,87 @@
+package p9_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DeedleFake/p9"
+)
+
+func TestDirQID(t *testing.T) {
+	dir := t.TempDir()
+	a, err := p9.Dir(dir).Attach(nil, "test", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, ok := a.(p9.QIDFS)
+	if !ok {
+		t.Skip("Dir does not implement QIDFS on this platform")
+	}
+
+	getQID := func(p string) p9.QID {
+		t.Helper()
+
+		qid, err := q.GetQID(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return qid
+	}
+
+	for _, name := range []string{"a", "b"} {
+		err := os.WriteFile(filepath.Join(dir, name), []byte("test"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a1, b := getQID("a"), getQID("b")
+	if a1.Path == b.Path {
+		t.Errorf("Different files have the same path: %v", a1.Path)
+	}
+	if a1 != getQID("a") {
+		t.Errorf("QID changed without the file changing")
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "a"), []byte("longer"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a2 := getQID("a")
+	if a2.Path != a1.Path {
+		t.Errorf("Path changed from %v to %v", a1.Path, a2.Path)
+	}
+	if a2.Version == a1.Version {
+		t.Errorf("Version didn't change after modification")
+	}
+}
+
+func TestQIDGen(t *testing.T) {
+	var gen p9.QIDGen
+	stat := p9.DirEntry{MTime: time.Unix(1000, 0), Length: 10}
+
+	a, b := gen.QID("/a", stat), gen.QID("/dir/b", stat)
+	if a.Path == b.Path {
+		t.Errorf("Different files have the same path: %v", a.Path)
+	}
+	if gen.QID("/a/", stat) != a {
+		t.Errorf("Same file has different QIDs")
+	}
+
+	stat.Length++
+	if v := gen.QID("/a", stat).Version; v == a.Version {
+		t.Errorf("Version didn't change after modification")
+	}
+
+	gen.Rename("/dir", "/other")
+	if p := gen.QID("/other/b", stat).Path; p != b.Path {
+		t.Errorf("Path changed from %v to %v after rename", b.Path, p)
+	}
+
+	gen.Remove("/a")
+	if p := gen.QID("/a", stat).Path; p == a.Path {
+		t.Errorf("Removed path %v was reused", p)
+	}
+}
@@ -0,0 +1,354 @@
+package p9
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/DeedleFake/p9/internal/util"
+	"github.com/DeedleFake/p9/proto"
+)
+
+var (
+	// ErrStale is returned by operations on a Remote that could not be
+	// restored after the client reconnected, such as an auth file or a
+	// file that no longer exists.
+	ErrStale = errors.New("stale file")
+)
+
+// DialReconnecting is like Dial, but enables reconnecting to the same
+// address. For more information, see SetRedial.
+func DialReconnecting(network, addr string) (*Client, error) {
+	c, err := Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c.SetRedial(func() (net.Conn, error) {
+		return net.Dial(network, addr)
+	})
+	return c, nil
+}
+
+// SetRedial enables reconnecting. If the client's connection to the
+// server is lost, the next request made with the client, including
+// those made via Remotes, dials a new connection using dial and
+// repeats the handshake with the original parameters.
+//
+// Remotes are restored the first time that they are used after a
+// reconnect by attaching again with the original parameters, walking
+// to the original path, and, if the file was open, opening it again
+// with the original mode minus OTRUNC. Files created by Create are
+// opened again but not created.
+//
+// Requests that are safe to repeat, such as walks, opens, stats, and
+// reads, are retried once if the connection is lost while they are
+// pending. Other requests, such as writes, creates, and removes,
+// return an error wrapping proto.ErrConnectionLost instead, as there
+// is no way to know whether or not the server performed them.
+func (c *Client) SetRedial(dial func() (net.Conn, error)) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.redial = dial
+}
+
+// conn returns the current connection and its generation, which is
+// incremented every time that the client reconnects. If the
+// connection has been lost and reconnecting is enabled, it
+// reconnects first.
+func (c *Client) conn(ctx context.Context) (*proto.Client, uint64, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	pc := c.pc
+	if c.closed || (c.redial == nil) || (c.versions == nil) || !errors.Is(pc.Err(), proto.ErrConnectionLost) {
+		return pc, c.gen, nil
+	}
+
+	conn, err := c.redial()
+	if err != nil {
+		return nil, 0, util.Errorf("reconnect: %w", err)
+	}
+
+	npc := proto.NewClient(Proto(), conn)
+	c.configure(npc)
+
+	version, err := handshake(ctx, npc, c.msize, c.versions)
+	if (err == nil) && (version != c.version) {
+		err = ErrUnsupportedVersion
+	}
+	if err != nil {
+		npc.Close()
+		return nil, 0, util.Errorf("reconnect: %w", err)
+	}
+
+	c.pc = npc
+	c.gen++
+	return npc, c.gen, nil
+}
+
+// current returns the current connection and its generation without
+// reconnecting.
+func (c *Client) current() (*proto.Client, uint64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.pc, c.gen
+}
+
+func (c *Client) reconnecting() bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return (c.redial != nil) && !c.closed
+}
+
+// send sends msg, restoring file first if it is not nil and the
+// client has reconnected since the file was last used. If retry is
+// true and the connection is lost before a response is received, it
+// reconnects and tries again once. It returns the response and the
+// generation of the connection that it was received on.
+func (c *Client) send(ctx context.Context, file *Remote, retry bool, msg any, buf []byte) (any, uint64, error) {
+	for attempt := 0; ; attempt++ {
+		pc, gen, err := c.conn(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var rsp any
+		if file != nil {
+			err = file.restore(ctx, pc, gen)
+		}
+		if err == nil {
+			if buf != nil {
+				rsp, err = pc.SendBufferContext(ctx, msg, buf)
+			} else {
+				rsp, err = pc.SendContext(ctx, msg)
+			}
+		}
+
+		if retry && (attempt == 0) && errors.Is(err, proto.ErrConnectionLost) && c.reconnecting() {
+			continue
+		}
+		return rsp, gen, err
+	}
+}
+
+// Close closes the client's current connection. If reconnecting is
+// enabled, it also disables it.
+func (c *Client) Close() error {
+	c.m.Lock()
+	c.closed = true
+	pc := c.pc
+	c.m.Unlock()
+
+	return pc.Close()
+}
+
+// Msize returns the maximum size of a message for the current
+// connection.
+func (c *Client) Msize() uint32 {
+	pc, _ := c.current()
+	return pc.Msize()
+}
+
+// Done returns a channel that is closed when the current connection
+// stops working. For more information, see proto.Client.
+func (c *Client) Done() <-chan struct{} {
+	pc, _ := c.current()
+	return pc.Done()
+}
+
+// Err returns the error that caused the current connection to stop
+// working, if any. For more information, see proto.Client.
+func (c *Client) Err() error {
+	pc, _ := c.current()
+	return pc.Err()
+}
+
+// SetMsize sets the maximum size of a message for the current
+// connection. For more information, see proto.Client. Reconnecting
+// negotiates the size again.
+func (c *Client) SetMsize(size uint32) {
+	pc, _ := c.current()
+	pc.SetMsize(size)
+}
+
+// Proto returns the protocol used by the current connection.
+func (c *Client) Proto() proto.Proto {
+	pc, _ := c.current()
+	return pc.Proto()
+}
+
+// SetProto changes the protocol used by the current connection. For
+// more information, see proto.Client. Reconnecting negotiates the
+// protocol again.
+func (c *Client) SetProto(p proto.Proto) {
+	pc, _ := c.current()
+	pc.SetProto(p)
+}
+
+// SetFlush sets the function used to build flush requests for the
+// current connection and any that replace it. For more information,
+// see proto.Client.
+func (c *Client) SetFlush(flush func(tag uint16) any) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.flush = flush
+	c.configure(c.pc)
+}
+
+// SetDisconnectHandler sets a function to be called when the current
+// connection or any that replace it fail. For more information, see
+// proto.Client.
+func (c *Client) SetDisconnectHandler(f func(err error)) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.disconnect = f
+	c.configure(c.pc)
+}
+
+// Send sends a message using the current connection, reconnecting
+// first if necessary. It is never retried. For more information, see
+// proto.Client.
+func (c *Client) Send(msg any) (any, error) {
+	return c.SendContext(context.Background(), msg)
+}
+
+// SendContext is like Send, but with a context. For more
+// information, see proto.Client.
+func (c *Client) SendContext(ctx context.Context, msg any) (any, error) {
+	rsp, _, err := c.send(ctx, nil, false, msg, nil)
+	return rsp, err
+}
+
+// SendBuffer is like Send, but decodes into a buffer if possible. For
+// more information, see proto.Client.
+func (c *Client) SendBuffer(msg any, buf []byte) (any, error) {
+	return c.SendBufferContext(context.Background(), msg, buf)
+}
+
+// SendBufferContext is a combination of SendContext and SendBuffer.
+func (c *Client) SendBufferContext(ctx context.Context, msg any, buf []byte) (any, error) {
+	rsp, _, err := c.send(ctx, nil, false, msg, buf)
+	return rsp, err
+}
+
+// attachParams holds the parameters used to attach a Remote so that
+// it can be attached again after reconnecting. The FID attached on
+// the most recent connection is shared by all Remotes restored from
+// it.
+type attachParams struct {
+	user  string
+	aname string
+
+	m   sync.Mutex
+	ok  bool
+	gen uint64
+	fid uint32
+}
+
+// root returns a FID attached using a's parameters on pc, attaching
+// if no such FID exists yet for gen.
+func (a *attachParams) root(ctx context.Context, c *Client, pc *proto.Client, gen uint64) (uint32, error) {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	if a.ok && (a.gen == gen) {
+		return a.fid, nil
+	}
+
+	fid := c.nextFID()
+	_, err := pc.SendContext(ctx, c.attachMsg(fid, NoFID, a.user, a.aname))
+	if err != nil {
+		return 0, err
+	}
+
+	a.ok, a.gen, a.fid = true, gen, fid
+	return fid, nil
+}
+
+// restore re-establishes file's FID on pc if it was established on a
+// previous connection.
+func (file *Remote) restore(ctx context.Context, pc *proto.Client, gen uint64) error {
+	file.rm.Lock()
+	defer file.rm.Unlock()
+
+	if file.gen == gen {
+		return nil
+	}
+	if file.attach == nil {
+		return util.Errorf("restore: %w", ErrStale)
+	}
+
+	root, err := file.attach.root(ctx, file.client, pc, gen)
+	if err != nil {
+		return util.Errorf("restore: %w", err)
+	}
+
+	err = file.client.restoreWalk(ctx, pc, root, file.fid, splitPath(file.path))
+	if err != nil {
+		return util.Errorf("restore %v: %w", file.path, err)
+	}
+
+	if file.opened {
+		_, err = pc.SendContext(ctx, &Topen{
+			FID:  file.fid,
+			Mode: file.mode &^ OTRUNC,
+		})
+		if err != nil {
+			pc.SendContext(ctx, &Tclunk{FID: file.fid})
+			return util.Errorf("restore %v: %w", file.path, err)
+		}
+	}
+
+	file.gen = gen
+	return nil
+}
+
+// maxWalk is the maximum number of elements that a single walk
+// request may contain, as defined by 9P's MAXWELEM.
+const maxWalk = 16
+
+// restoreWalk walks newfid from fid to the file at the path given by
+// w, splitting the walk into multiple requests if w is too long for
+// one. If the walk fails, newfid is left unused.
+func (c *Client) restoreWalk(ctx context.Context, pc *proto.Client, fid, newfid uint32, w []string) error {
+	// Longer walks go via temporary FIDs rather than walking newfid in
+	// place, as not every server supports that.
+	var tmp bool
+	for {
+		n := min(len(w), maxWalk)
+		next := newfid
+		if n < len(w) {
+			next = c.nextFID()
+		}
+
+		rsp, err := pc.SendContext(ctx, &Twalk{
+			FID:    fid,
+			NewFID: next,
+			Wname:  w[:n],
+		})
+		if (err == nil) && (len(rsp.(*Rwalk).WQID) != n) {
+			err = ErrStale
+		}
+		if tmp {
+			pc.SendContext(ctx, &Tclunk{FID: fid})
+		}
+		if err != nil {
+			if errors.Is(err, proto.ErrConnectionLost) || errors.Is(err, ErrStale) {
+				return err
+			}
+			return util.Errorf("%w: %w", ErrStale, err)
+		}
+
+		if next == newfid {
+			return nil
+		}
+		fid, w, tmp = next, w[n:], true
+	}
+}
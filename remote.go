@@ -1,21 +1,26 @@
 package p9
 
 import (
-	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
 	"errors"
 	"io"
+	"io/fs"
 	"path"
 	"strings"
 	"sync"
 
 	"github.com/DeedleFake/p9/internal/util"
+	"github.com/DeedleFake/p9/proto"
 )
 
 // Remote provides a file-like interface for performing operations on
 // files presented by a 9P server.
 //
-// Remote implements File, allowing it to be itself served using
-// FileSystem.
+// Remote implements FileContext, allowing it to be itself served
+// using FileSystem with cancellation passed through to the server it
+// is connected to.
 type Remote struct {
 	client *Client
 
@@ -24,6 +29,16 @@ type Remote struct {
 
 	m   sync.Mutex
 	pos uint64
+	dir []byte // Unparsed directory entries read by ReadDirN.
+
+	// The following are used to restore the file after the client
+	// reconnects. attach is nil if the file can't be restored.
+	rm     sync.Mutex
+	gen    uint64
+	attach *attachParams
+	path   string
+	opened bool
+	mode   uint8
 }
 
 // Type returns the type of the file represented by the Remote.
@@ -31,45 +46,62 @@ func (file *Remote) Type() QIDType {
 	return file.qid.Type
 }
 
-func (file *Remote) walk(p string) (*Remote, error) {
+// Walk returns a new Remote for the file at p, relative to the
+// current one, without opening it. If any element of p can't be
+// walked to, it returns an error that wraps fs.ErrNotExist.
+func (file *Remote) Walk(p string) (*Remote, error) {
+	return file.WalkContext(context.Background(), p)
+}
+
+// WalkContext is like Walk, but flushes the request if ctx is
+// cancelled before it completes.
+func (file *Remote) WalkContext(ctx context.Context, p string) (*Remote, error) {
 	fid := file.client.nextFID()
 
-	w := []string{path.Clean(p)}
-	if w[0] != "/" {
-		w = strings.Split(w[0], "/")
-	}
-	if (len(w) == 1) && (w[0] == ".") {
-		w = nil
-	}
-	rsp, err := file.client.Send(&Twalk{
+	w := splitPath(p)
+	rsp, gen, err := file.client.send(ctx, file, true, &Twalk{
 		FID:    file.fid,
 		NewFID: fid,
 		Wname:  w,
-	})
+	}, nil)
 	if err != nil {
 		return nil, err
 	}
 	walk := rsp.(*Rwalk)
 
+	// If the walk was only partially successful, the server does not
+	// establish the new FID.
+	if len(walk.WQID) != len(w) {
+		return nil, util.Errorf("walk %v: %w", p, fs.ErrNotExist)
+	}
+
 	qid := file.qid
 	if len(walk.WQID) != 0 {
 		qid = walk.WQID[len(walk.WQID)-1]
 	}
-	if len(walk.WQID) != len(w) {
-		qid = QID{
-			Type:    0xFF,
-			Version: 0xFFFFFFFF,
-			Path:    0xFFFFFFFFFFFFFFFF,
-		}
-	}
 
 	return &Remote{
 		client: file.client,
 		fid:    fid,
 		qid:    qid,
+		gen:    gen,
+		attach: file.attach,
+		path:   path.Join(file.path, p),
 	}, nil
 }
 
+// splitPath splits p into path elements for a walk.
+func splitPath(p string) []string {
+	w := []string{path.Clean(p)}
+	if w[0] != "/" {
+		w = strings.Split(w[0], "/")
+	}
+	if (len(w) == 1) && (w[0] == ".") {
+		w = nil
+	}
+	return w
+}
+
 // Open opens and returns a file relative to the current one. In many
 // cases, this will likely be relative to the filesystem root. For
 // example:
@@ -77,21 +109,29 @@ func (file *Remote) walk(p string) (*Remote, error) {
 //	root, _ := client.Attach(nil, "anyone", "/")
 //	file, _ := root.Open("some/file/or/another", p9.OREAD)
 func (file *Remote) Open(p string, mode uint8) (*Remote, error) {
-	next, err := file.walk(p)
+	return file.OpenContext(context.Background(), p, mode)
+}
+
+// OpenContext is like Open, but flushes the request if ctx is
+// cancelled before it completes.
+func (file *Remote) OpenContext(ctx context.Context, p string, mode uint8) (*Remote, error) {
+	next, err := file.WalkContext(ctx, p)
 	if err != nil {
 		return nil, err
 	}
 
-	rsp, err := file.client.Send(&Topen{
+	rsp, _, err := file.client.send(ctx, next, true, &Topen{
 		FID:  next.fid,
 		Mode: mode,
-	})
+	}, nil)
 	if err != nil {
+		next.Close()
 		return nil, err
 	}
 	open := rsp.(*Ropen)
 
 	next.qid = open.QID
+	next.setOpened(mode)
 
 	return next, nil
 }
@@ -99,44 +139,120 @@ func (file *Remote) Open(p string, mode uint8) (*Remote, error) {
 // Create creates, with the given permissions, and opens, with the
 // given mode, a new file at p relative to the current file.
 func (file *Remote) Create(p string, perm FileMode, mode uint8) (*Remote, error) {
+	return file.CreateContext(context.Background(), p, perm, mode)
+}
+
+// CreateContext is like Create, but flushes the request if ctx is
+// cancelled before it completes.
+func (file *Remote) CreateContext(ctx context.Context, p string, perm FileMode, mode uint8) (*Remote, error) {
+	return file.create(ctx, p, perm, mode, "")
+}
+
+// create creates a file at p. ext is the extension used to create
+// special files with 9P2000.u.
+func (file *Remote) create(ctx context.Context, p string, perm FileMode, mode uint8, ext string) (*Remote, error) {
 	dir, name := path.Split(p)
-	next, err := file.walk(path.Clean(dir))
+	next, err := file.WalkContext(ctx, path.Clean(dir))
 	if err != nil {
 		return nil, err
 	}
 
-	rsp, err := file.client.Send(&Tcreate{
+	var msg any = &Tcreate{
 		FID:  next.fid,
 		Name: name,
 		Perm: perm,
 		Mode: mode,
-	})
+	}
+	if file.client.dotu() {
+		msg = &TcreateDotU{
+			Tcreate:   *msg.(*Tcreate),
+			Extension: ext,
+		}
+	}
+
+	rsp, _, err := file.client.send(ctx, next, false, msg, nil)
 	if err != nil {
+		next.Close()
 		return nil, err
 	}
 	create := rsp.(*Rcreate)
 
 	next.qid = create.QID
+	next.rm.Lock()
+	next.path = path.Join(next.path, name)
+	next.rm.Unlock()
+	next.setOpened(mode)
 
 	return next, nil
 }
 
+// Symlink creates a symbolic link at p, relative to the current file,
+// that points to target. Symlinks can only be created when using
+// 9P2000.u.
+func (file *Remote) Symlink(target, p string) error {
+	return file.SymlinkContext(context.Background(), target, p)
+}
+
+// SymlinkContext is like Symlink, but flushes the request if ctx is
+// cancelled before it completes.
+func (file *Remote) SymlinkContext(ctx context.Context, target, p string) error {
+	if !file.client.dotu() {
+		return util.Errorf("symlink %v: %w", p, errors.ErrUnsupported)
+	}
+
+	link, err := file.create(ctx, p, ModeSymlink|0777, OREAD, target)
+	if err != nil {
+		return err
+	}
+	return link.CloseContext(ctx)
+}
+
+// Readlink returns the target of the symbolic link at p, relative to
+// the current file. If p is "", it is considered to be the current
+// file. Targets are only sent by servers when using 9P2000.u.
+func (file *Remote) Readlink(p string) (string, error) {
+	return file.ReadlinkContext(context.Background(), p)
+}
+
+// ReadlinkContext is like Readlink, but flushes the request if ctx is
+// cancelled before it completes.
+func (file *Remote) ReadlinkContext(ctx context.Context, p string) (string, error) {
+	if !file.client.dotu() {
+		return "", util.Errorf("readlink %v: %w", p, errors.ErrUnsupported)
+	}
+
+	stat, err := file.StatContext(ctx, p)
+	if err != nil {
+		return "", err
+	}
+	if stat.FileMode&ModeSymlink == 0 {
+		return "", util.Errorf("readlink %v: %w", p, fs.ErrInvalid)
+	}
+	return stat.Extension, nil
+}
+
 // Remove deletes the file at p, relative to the current file. If p is
 // "", it closes the current file, if open, and deletes it.
 func (file *Remote) Remove(p string) error {
+	return file.RemoveContext(context.Background(), p)
+}
+
+// RemoveContext is like Remove, but flushes the request if ctx is
+// cancelled before it completes.
+func (file *Remote) RemoveContext(ctx context.Context, p string) error {
 	if p != "" {
-		file, err := file.walk(p)
+		file, err := file.WalkContext(ctx, p)
 		if err != nil {
 			return err
 		}
 		// Close is not necessary. Remove is also a clunk.
 
-		return file.Remove("")
+		return file.RemoveContext(ctx, "")
 	}
 
-	_, err := file.client.Send(&Tremove{
+	_, _, err := file.client.send(ctx, file, false, &Tremove{
 		FID: file.fid,
-	})
+	}, nil)
 	return err
 }
 
@@ -148,6 +264,8 @@ func (file *Remote) Seek(offset int64, whence int) (int64, error) {
 	file.m.Lock()
 	defer file.m.Unlock()
 
+	file.dir = nil
+
 	switch whence {
 	case io.SeekStart:
 		if offset < 0 {
@@ -184,27 +302,27 @@ func (file *Remote) Seek(offset int64, whence int) (int64, error) {
 	panic(util.Errorf("Invalid whence: %v", whence))
 }
 
-// Read reads from the file at the internally-tracked offset. For more
-// information, see ReadAt.
+// Read reads from the file at the internally-tracked offset. Unlike
+// ReadAt, it makes at most one request, so it may return fewer bytes
+// than requested.
 func (file *Remote) Read(buf []byte) (int, error) {
-	file.m.Lock()
-	defer file.m.Unlock()
-
-	n, err := file.ReadAt(buf, int64(file.pos))
-	file.pos += uint64(n)
-	return n, err
+	return remoteReader{ctx: context.Background(), file: file}.Read(buf)
 }
 
 func (file *Remote) maxBufSize() int {
 	return int(file.client.Msize() - IOHeaderSize)
 }
 
-func (file *Remote) readPart(buf []byte, off int64) (int, error) {
-	rsp, err := file.client.Send(&Tread{
+func (file *Remote) readPart(ctx context.Context, buf []byte, off int64) (int, error) {
+	// Directories can only be read sequentially from the beginning,
+	// so a retry on a new connection is only possible at the start.
+	retry := (file.qid.Type&QTDir == 0) || (off == 0)
+
+	rsp, _, err := file.client.send(ctx, file, retry, &Tread{
 		FID:    file.fid,
 		Offset: uint64(off),
 		Count:  uint32(len(buf)),
-	})
+	}, buf)
 	if err != nil {
 		return 0, err
 	}
@@ -213,6 +331,12 @@ func (file *Remote) readPart(buf []byte, off int64) (int, error) {
 		return 0, io.EOF
 	}
 
+	// The data is normally read directly into buf, in which case
+	// there's nothing to copy.
+	if &read.Data[0] == &buf[0] {
+		return len(read.Data), nil
+	}
+
 	n := copy(buf, read.Data)
 	return n, nil
 }
@@ -221,19 +345,27 @@ func (file *Remote) readPart(buf []byte, off int64) (int, error) {
 // will result in a response that is larger than the currently allowed
 // message size, as established by the handshake, it will perform
 // multiple read requests in sequence, reading each into the
-// appropriate parts of the buffer. It returns the number of bytes
-// read and an error, if any occurred.
+// appropriate parts of the buffer. As required by io.ReaderAt, it
+// continues until buf is full or the end of the file is reached, in
+// which case it returns io.EOF. It returns the number of bytes read
+// and an error, if any occurred.
 //
 // If an error occurs while performing the sequential requests, it
 // will return immediately.
 func (file *Remote) ReadAt(buf []byte, off int64) (int, error) {
-	size := min(len(buf), file.maxBufSize())
+	return file.ReadAtContext(context.Background(), buf, off)
+}
+
+// ReadAtContext is like ReadAt, but stops early if ctx is cancelled,
+// flushing the current request.
+func (file *Remote) ReadAtContext(ctx context.Context, buf []byte, off int64) (int, error) {
+	size := file.maxBufSize()
 
 	var total int
-	for start := 0; start < len(buf); start += size {
-		end := min(start+size, len(buf))
+	for total < len(buf) {
+		end := min(total+size, len(buf))
 
-		n, err := file.readPart(buf[start:end], off+int64(start))
+		n, err := file.readPart(ctx, buf[total:end], off+int64(total))
 		total += n
 		if err != nil {
 			return total, err
@@ -253,12 +385,12 @@ func (file *Remote) Write(data []byte) (int, error) {
 	return n, err
 }
 
-func (file *Remote) writePart(data []byte, off int64) (int, error) {
-	rsp, err := file.client.Send(&Twrite{
+func (file *Remote) writePart(ctx context.Context, data []byte, off int64) (int, error) {
+	rsp, _, err := file.client.send(ctx, file, false, &Twrite{
 		FID:    file.fid,
 		Offset: uint64(off),
 		Data:   data,
-	})
+	}, nil)
 	if err != nil {
 		return 0, err
 	}
@@ -280,13 +412,20 @@ func (file *Remote) writePart(data []byte, off int64) (int, error) {
 // If an error occurs while performing the sequential requests, it
 // will return immediately.
 func (file *Remote) WriteAt(data []byte, off int64) (int, error) {
+	return file.WriteAtContext(context.Background(), data, off)
+}
+
+// WriteAtContext is like WriteAt, but stops early if ctx is
+// cancelled, flushing the current request. Note that a flushed write
+// may or may not have been performed by the server.
+func (file *Remote) WriteAtContext(ctx context.Context, data []byte, off int64) (int, error) {
 	size := min(len(data), file.maxBufSize())
 
 	var total int
 	for start := 0; start < len(data); start += size {
 		end := min(start+size, len(data))
 
-		n, err := file.writePart(data[start:end], off+int64(start))
+		n, err := file.writePart(ctx, data[start:end], off+int64(start))
 		total += n
 		if err != nil {
 			return total, err
@@ -297,36 +436,78 @@ func (file *Remote) WriteAt(data []byte, off int64) (int, error) {
 
 // Close closes the file on the server. Further usage of the file will
 // produce errors.
+//
+// If the connection that the file was established on has been lost,
+// Close does nothing, as the file no longer exists on the server.
 func (file *Remote) Close() error {
-	_, err := file.client.Send(&Tclunk{
+	return file.CloseContext(context.Background())
+}
+
+// CloseContext is like Close, but flushes the request if ctx is
+// cancelled before it completes.
+func (file *Remote) CloseContext(ctx context.Context) error {
+	// Closing never reconnects, as a FID from a lost connection no
+	// longer exists and so doesn't need to be clunked.
+	pc, gen := file.client.current()
+
+	file.rm.Lock()
+	defer file.rm.Unlock()
+
+	if file.gen != gen {
+		return nil
+	}
+
+	_, err := pc.SendContext(ctx, &Tclunk{
 		FID: file.fid,
 	})
+	if errors.Is(err, proto.ErrConnectionLost) {
+		return nil
+	}
 	return err
 }
 
+// setOpened records that file has been opened with the given mode.
+func (file *Remote) setOpened(mode uint8) {
+	file.rm.Lock()
+	defer file.rm.Unlock()
+
+	file.opened = true
+	file.mode = mode
+}
+
 // Stat fetches and returns the DirEntry for the file located at p,
 // relative to the current file. If p is "", it is considered to be
 // the current file.
 func (file *Remote) Stat(p string) (DirEntry, error) {
+	return file.StatContext(context.Background(), p)
+}
+
+// StatContext is like Stat, but flushes the request if ctx is
+// cancelled before it completes.
+func (file *Remote) StatContext(ctx context.Context, p string) (DirEntry, error) {
 	if p != "" {
-		file, err := file.walk(p)
+		file, err := file.WalkContext(ctx, p)
 		if err != nil {
 			return DirEntry{}, err
 		}
 		defer file.Close()
 
-		return file.Stat("")
+		return file.StatContext(ctx, "")
 	}
 
-	rsp, err := file.client.Send(&Tstat{
+	rsp, _, err := file.client.send(ctx, file, true, &Tstat{
 		FID: file.fid,
-	})
+	}, nil)
 	if err != nil {
 		return DirEntry{}, err
 	}
-	stat := rsp.(*Rstat)
 
-	return stat.Stat.DirEntry(), nil
+	switch stat := rsp.(type) {
+	case *RstatDotU:
+		return stat.Stat.DirEntry(), nil
+	default:
+		return stat.(*Rstat).Stat.DirEntry(), nil
+	}
 }
 
 // Readdir reads the file as a directory, returning the list of
@@ -337,5 +518,108 @@ func (file *Remote) Stat(p string) (DirEntry, error) {
 // Note that to read this list again, the file must first be seeked to
 // the beginning.
 func (file *Remote) Readdir() ([]DirEntry, error) {
-	return ReadDir(bufio.NewReaderSize(file, file.maxBufSize()))
+	return file.ReaddirContext(context.Background())
+}
+
+// ReaddirContext is like Readdir, but stops early if ctx is
+// cancelled, flushing the current request.
+func (file *Remote) ReaddirContext(ctx context.Context) ([]DirEntry, error) {
+	return file.ReadDirNContext(ctx, -1)
+}
+
+// ReadDirN reads the file as a directory, returning up to n entries
+// and continuing from where the previous call left off. Entries are
+// requested from the server only as they are needed, so large
+// directories can be read a piece at a time.
+//
+// If n is greater than 0, ReadDirN returns io.EOF once there are no
+// more entries, in the same way as os.File.ReadDir. Otherwise, it
+// returns all of the remaining entries and a nil error.
+//
+// Note that to read the directory again, the file must first be
+// seeked to the beginning.
+func (file *Remote) ReadDirN(n int) ([]DirEntry, error) {
+	return file.ReadDirNContext(context.Background(), n)
+}
+
+// ReadDirNContext is like ReadDirN, but stops early if ctx is
+// cancelled, flushing the current request.
+func (file *Remote) ReadDirNContext(ctx context.Context, n int) ([]DirEntry, error) {
+	file.m.Lock()
+	defer file.m.Unlock()
+
+	var entries []DirEntry
+	for (n <= 0) || (len(entries) < n) {
+		entry, ok, err := file.nextEntry()
+		if err != nil {
+			return entries, err
+		}
+		if ok {
+			entries = append(entries, entry)
+			continue
+		}
+
+		// The server should only send whole entries, but entries are
+		// buffered in case one is split between reads anyway.
+		buf := make([]byte, file.maxBufSize())
+		read, err := file.readPart(ctx, buf, int64(file.pos))
+		file.pos += uint64(read)
+		file.dir = append(file.dir, buf[:read]...)
+		if err == io.EOF {
+			if len(file.dir) != 0 {
+				return entries, io.ErrUnexpectedEOF
+			}
+			if (n > 0) && (len(entries) == 0) {
+				return nil, io.EOF
+			}
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+	}
+
+	return entries, nil
+}
+
+// nextEntry parses the next directory entry from the data buffered by
+// ReadDirN. It returns false if a whole entry isn't buffered. file.m
+// must be locked.
+func (file *Remote) nextEntry() (DirEntry, bool, error) {
+	if len(file.dir) < 2 {
+		return DirEntry{}, false, nil
+	}
+	size := 2 + int(binary.LittleEndian.Uint16(file.dir))
+	if len(file.dir) < size {
+		return DirEntry{}, false, nil
+	}
+
+	var stat Stat
+	err := stat.decode(bytes.NewReader(file.dir[:size]), file.client.dotu())
+	if err != nil {
+		return DirEntry{}, false, err
+	}
+	file.dir = file.dir[size:]
+	return stat.DirEntry(), true, nil
+}
+
+// remoteReader reads from a Remote at its internally-tracked offset
+// using a context.
+type remoteReader struct {
+	ctx  context.Context
+	file *Remote
+}
+
+func (r remoteReader) Read(buf []byte) (int, error) {
+	r.file.m.Lock()
+	defer r.file.m.Unlock()
+
+	if len(buf) == 0 {
+		return 0, nil
+	}
+
+	buf = buf[:min(len(buf), r.file.maxBufSize())]
+	n, err := r.file.readPart(r.ctx, buf, int64(r.file.pos))
+	r.file.pos += uint64(n)
+	return n, err
 }
@@ -0,0 +1,100 @@
+package p9_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DeedleFake/p9"
+	"github.com/DeedleFake/p9/proto"
+)
+
+func TestRemote(t *testing.T) {
+	const msize = 512
+
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("0123456789"), 200)
+	err := os.WriteFile(filepath.Join(dir, "a"), data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go proto.Serve(lis, p9.Proto(), p9.FSConnHandler(p9.Dir(dir), msize))
+
+	c, err := p9.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err = c.Handshake(msize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := c.Attach(nil, "test", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	t.Run("PartialWalk", func(t *testing.T) {
+		_, err := root.Walk("a/missing")
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Expected fs.ErrNotExist but got %v", err)
+		}
+	})
+
+	file, err := root.Open("a", p9.OREAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	t.Run("ReadAt", func(t *testing.T) {
+		// Larger than a single message, so that multiple requests are
+		// needed to fill it.
+		buf := make([]byte, 3*msize)
+		n, err := file.ReadAt(buf, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:n], data[10:10+len(buf)]) {
+			t.Errorf("Read wrong data")
+		}
+
+		buf = make([]byte, 100)
+		n, err = file.ReadAt(buf, int64(len(data)-50))
+		if (n != 50) || (err != io.EOF) {
+			t.Errorf("Expected 50, io.EOF at end of file but got %v, %v", n, err)
+		}
+	})
+
+	t.Run("Read", func(t *testing.T) {
+		buf := make([]byte, 3*msize)
+		n, err := file.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (n == 0) || (n > msize-p9.IOHeaderSize) {
+			t.Errorf("Expected a single message of data but got %v bytes", n)
+		}
+
+		all, err := io.ReadAll(io.MultiReader(bytes.NewReader(buf[:n]), file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(all, data) {
+			t.Errorf("Read wrong data")
+		}
+	})
+}
@@ -0,0 +1,158 @@
+package p9
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+// RemoteFS returns an fs.FS that provides access to the files under
+// root. Paths given to it are interpreted relative to root.
+//
+// The returned fs.FS also implements fs.StatFS, fs.ReadDirFS,
+// fs.ReadFileFS, and fs.SubFS. Files returned by its Open method
+// implement fs.ReadDirFile, io.Seeker, and io.ReaderAt. Errors are
+// returned as *fs.PathError, and errors from the server can be
+// matched against fs.ErrNotExist and the like using errors.Is.
+//
+// Closing the returned fs.FS is not necessary, but root must remain
+// open for as long as it is in use.
+func RemoteFS(root *Remote) fs.FS {
+	return &remoteFS{root: root, dir: "."}
+}
+
+type remoteFS struct {
+	root *Remote
+	dir  string
+}
+
+// path returns the path relative to the root of the Remote that
+// corresponds to name.
+func (fsys *remoteFS) path(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return path.Join(fsys.dir, name), nil
+}
+
+func (fsys *remoteFS) Open(name string) (fs.File, error) {
+	p, err := fsys.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := fsys.root.Open(p, OREAD)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return &remoteFile{Remote: file, name: name}, nil
+}
+
+func (fsys *remoteFS) Stat(name string) (fs.FileInfo, error) {
+	p, err := fsys.path("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := fsys.root.Stat(p)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	stat.EntryName = path.Base(name)
+	return stat, nil
+}
+
+func (fsys *remoteFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.Unwrap(err)}
+	}
+	defer file.Close()
+
+	entries, err := file.(*remoteFile).ReadDir(-1)
+	slices.SortFunc(entries, func(e1, e2 fs.DirEntry) int {
+		return strings.Compare(e1.Name(), e2.Name())
+	})
+	return entries, err
+}
+
+func (fsys *remoteFS) ReadFile(name string) ([]byte, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errors.Unwrap(err)}
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+func (fsys *remoteFS) Sub(dir string) (fs.FS, error) {
+	p, err := fsys.path("sub", dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &remoteFS{root: fsys.root, dir: p}, nil
+}
+
+// remoteFile is an fs.File that wraps a Remote.
+type remoteFile struct {
+	*Remote
+	name string
+}
+
+func (file *remoteFile) Stat() (fs.FileInfo, error) {
+	stat, err := file.Remote.Stat("")
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: file.name, Err: err}
+	}
+
+	stat.EntryName = path.Base(file.name)
+	return stat, nil
+}
+
+func (file *remoteFile) Read(buf []byte) (int, error) {
+	if file.Type()&QTDir != 0 {
+		return 0, &fs.PathError{Op: "read", Path: file.name, Err: errors.New("is a directory")}
+	}
+
+	n, err := file.Remote.Read(buf)
+	if (err != nil) && (err != io.EOF) {
+		err = &fs.PathError{Op: "read", Path: file.name, Err: err}
+	}
+	return n, err
+}
+
+func (file *remoteFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if file.Type()&QTDir == 0 {
+		return nil, &fs.PathError{Op: "readdir", Path: file.name, Err: errors.New("not a directory")}
+	}
+
+	entries, err := file.ReadDirN(n)
+	if (err != nil) && (err != io.EOF) {
+		err = &fs.PathError{Op: "readdir", Path: file.name, Err: err}
+	}
+
+	r := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		r = append(r, fs.FileInfoToDirEntry(entry))
+	}
+	return r, err
+}
+
+func (file *remoteFile) Close() error {
+	err := file.Remote.Close()
+	if err != nil {
+		return &fs.PathError{Op: "close", Path: file.name, Err: err}
+	}
+	return nil
+}
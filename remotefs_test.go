@@ -0,0 +1,81 @@
+package p9_test
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DeedleFake/p9"
+	"github.com/DeedleFake/p9/proto"
+)
+
+func TestRemoteFS(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a":         "This is a test.",
+		"dir/b":     "This is also a test.",
+		"dir/sub/c": "",
+	}
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(p, []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go proto.Serve(lis, p9.Proto(), p9.FSConnHandler(p9.Dir(dir), 8192))
+
+	c, err := p9.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err = c.Handshake(8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := c.Attach(nil, "test", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	fsys := p9.RemoteFS(root)
+	err = fstest.TestFS(fsys, "a", "dir/b", "dir/sub/c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := fs.Sub(fsys, "dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fstest.TestFS(sub, "b", "sub/c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = fs.Stat(fsys, "missing")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist but got %v", err)
+	}
+	_, err = fsys.Open("dir/missing")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist but got %v", err)
+	}
+}
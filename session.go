@@ -0,0 +1,231 @@
+package p9
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"strconv"
+	"sync"
+)
+
+// SessionDir is a RefNode that implements the clone file pattern used
+// by Plan 9 services such as /net. It contains a file named clone and
+// a numbered directory for each active session. Opening the clone file
+// allocates a new session, the directory for which is provided by
+// calling New.
+//
+// If the directory of the new session has an entry named ctl, opening
+// the clone file opens that instead, as in Plan 9. Conventionally,
+// reading from the ctl file yields the number of the session. If
+// there is no ctl entry, the clone file can only be opened for
+// reading, and reading from it yields the number of the session
+// followed by a newline.
+//
+// A session lasts for as long as the file opened via the clone file
+// remains open or any FID refers to the session's directory or to a
+// file inside of it. Once none do, the session's directory is removed
+// and, if it implements io.Closer, closed. Session numbers are never
+// reused.
+//
+// A SessionDir only works when served by a Mux, as it relies on the
+// Mux to tell it about references to sessions. It must not be copied
+// after first use.
+type SessionDir struct {
+	// Perm holds the permission bits of the directory. If it is zero,
+	// the directory is readable and searchable by everyone.
+	Perm FileMode
+
+	// New is called to create the directory for a new session with the
+	// given number.
+	New func(id int) (DirNode, error)
+
+	m        sync.Mutex
+	next     int
+	sessions map[int]*session
+}
+
+type session struct {
+	dir  DirNode
+	refs int
+}
+
+// Mode returns the mode of the directory.
+func (d *SessionDir) Mode() FileMode {
+	if d.Perm != 0 {
+		return d.Perm
+	}
+	return 0555
+}
+
+// Open implements Node.Open. It always returns an error, as Mux
+// handles the opening of directories itself.
+func (d *SessionDir) Open(mode uint8) (File, error) {
+	return nil, errors.New("is a directory")
+}
+
+// Entries implements DirNode.Entries.
+func (d *SessionDir) Entries() ([]string, error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	names := make([]string, 0, 1+len(d.sessions))
+	names = append(names, "clone")
+	for id := range d.sessions {
+		names = append(names, strconv.Itoa(id))
+	}
+	return names, nil
+}
+
+// Lookup implements DirNode.Lookup.
+func (d *SessionDir) Lookup(name string) (Node, error) {
+	if name == "clone" {
+		return cloneNode{d: d}, nil
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	s, ok := d.session(name)
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return s.dir, nil
+}
+
+// session returns the session with the given name. d.m must be held.
+func (d *SessionDir) session(name string) (*session, bool) {
+	id, err := strconv.Atoi(name)
+	if (err != nil) || (strconv.Itoa(id) != name) {
+		return nil, false
+	}
+
+	s, ok := d.sessions[id]
+	return s, ok
+}
+
+// Ref implements RefNode.Ref.
+func (d *SessionDir) Ref(name string) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if s, ok := d.session(name); ok {
+		s.refs++
+	}
+}
+
+// Unref implements RefNode.Unref.
+func (d *SessionDir) Unref(name string) {
+	id, err := strconv.Atoi(name)
+	if err != nil {
+		return
+	}
+	d.release(id)
+}
+
+// release drops a reference to the session with the given number,
+// removing it if it was the last one.
+func (d *SessionDir) release(id int) {
+	d.m.Lock()
+	s, ok := d.sessions[id]
+	if !ok {
+		d.m.Unlock()
+		return
+	}
+	s.refs--
+	if s.refs > 0 {
+		d.m.Unlock()
+		return
+	}
+	delete(d.sessions, id)
+	d.m.Unlock()
+
+	if c, ok := s.dir.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// clone creates a new session, holding a reference to it for the
+// caller.
+func (d *SessionDir) clone() (int, DirNode, error) {
+	d.m.Lock()
+	id := d.next
+	d.next++
+	d.m.Unlock()
+
+	dir, err := d.New(id)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if d.sessions == nil {
+		d.sessions = make(map[int]*session)
+	}
+	d.sessions[id] = &session{dir: dir, refs: 1}
+
+	return id, dir, nil
+}
+
+// cloneNode is the clone file of a SessionDir.
+type cloneNode struct {
+	d *SessionDir
+}
+
+func (n cloneNode) Mode() FileMode {
+	return 0666
+}
+
+func (n cloneNode) Open(mode uint8) (File, error) {
+	id, dir, err := n.d.clone()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := n.open(id, dir, mode)
+	if err != nil {
+		n.d.release(id)
+		return nil, err
+	}
+
+	return &cloneFile{FileContext: fileWithContext(file), d: n.d, id: id}, nil
+}
+
+// open opens the file that the clone file stands in for in the
+// session with the given number.
+func (n cloneNode) open(id int, dir DirNode, mode uint8) (File, error) {
+	ctl, err := dir.Lookup("ctl")
+	if err == nil {
+		return ctl.Open(mode)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	if mode&3 != OREAD {
+		return nil, fs.ErrPermission
+	}
+	return &synthFile{data: []byte(strconv.Itoa(id) + "\n")}, nil
+}
+
+// cloneFile is an open clone file. It holds a reference to its session
+// until it is closed.
+type cloneFile struct {
+	FileContext
+	d  *SessionDir
+	id int
+
+	close sync.Once
+}
+
+func (f *cloneFile) Close() error {
+	err := f.FileContext.Close()
+	f.close.Do(func() { f.d.release(f.id) })
+	return err
+}
+
+var (
+	_ RefNode = (*SessionDir)(nil)
+	_ Node    = cloneNode{}
+)
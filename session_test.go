@@ -0,0 +1,164 @@
+package p9_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/DeedleFake/p9"
+	"github.com/DeedleFake/p9/proto"
+)
+
+type testSession struct {
+	*p9.SynthDir
+	closed chan<- int
+	id     int
+}
+
+func (s *testSession) Close() error {
+	s.closed <- s.id
+	return nil
+}
+
+func TestSessionDir(t *testing.T) {
+	closed := make(chan int, 10)
+
+	var mux p9.Mux
+	mux.Handle("net", &p9.SessionDir{
+		New: func(id int) (p9.DirNode, error) {
+			ctl := &p9.SynthFile{
+				Read:  func() ([]byte, error) { return []byte(strconv.Itoa(id)), nil },
+				Write: func(line string) error { return nil },
+			}
+			data := p9.StaticFile([]byte("data"))
+			return &testSession{
+				SynthDir: &p9.SynthDir{
+					EntriesFunc: func() ([]string, error) {
+						return []string{"ctl", "data"}, nil
+					},
+					LookupFunc: func(name string) (p9.Node, error) {
+						switch name {
+						case "ctl":
+							return ctl, nil
+						case "data":
+							return data, nil
+						}
+						return nil, fs.ErrNotExist
+					},
+				},
+				closed: closed,
+				id:     id,
+			}, nil
+		},
+	})
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go proto.Serve(lis, p9.Proto(), p9.FSConnHandler(&mux, 4096))
+
+	c, err := p9.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err = c.Handshake(4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := c.Attach(nil, "test", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	clone := func(expected string) *p9.Remote {
+		t.Helper()
+
+		file, err := root.Open("net/clone", p9.ORDWR)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := io.ReadAll(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(id) != expected {
+			t.Fatalf("Expected session %q but got %q", expected, id)
+		}
+		return file
+	}
+	entries := func() []string {
+		t.Helper()
+
+		dir, err := root.Open("net", p9.OREAD)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dir.Close()
+
+		entries, err := dir.Readdir()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := make([]string, 0, len(entries))
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return names
+	}
+
+	ctl := clone("0")
+	if e := entries(); !slices.Equal(e, []string{"0", "clone"}) {
+		t.Errorf("Unexpected entries: %v", e)
+	}
+
+	dir, err := root.Walk("net/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ctl.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := root.Open("net/0/data", p9.OREAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dir.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case id := <-closed:
+		t.Fatalf("Session %v closed while still referenced", id)
+	default:
+	}
+
+	err = data.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := <-closed; id != 0 {
+		t.Errorf("Expected session 0 to close but got %v", id)
+	}
+
+	_, err = root.Stat("net/0")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist but got %v", err)
+	}
+
+	clone("1")
+	c.Close()
+	if id := <-closed; id != 1 {
+		t.Errorf("Expected session 1 to close but got %v", id)
+	}
+}
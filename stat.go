@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"math"
 	"os"
 	"time"
 	"unsafe"
@@ -22,7 +23,11 @@ var (
 // directory.
 type FileMode uint32
 
-// FileMode type bitmasks.
+// FileMode type bitmasks. Their values match those used by 9P2000.u.
+// Note that this means that ModeNamedPipe, ModeSocket, ModeSetuid, and
+// ModeSetgid each have a different value than in earlier versions of
+// this package, so their names should be used rather than their
+// values.
 const (
 	ModeDir FileMode = 1 << (31 - iota)
 	ModeAppend
@@ -31,15 +36,21 @@ const (
 	ModeAuth
 	ModeTemporary
 	ModeSymlink
-	_
+	ModeLink
 	ModeDevice
+	_
 	ModeNamedPipe
 	ModeSocket
 	ModeSetuid
 	ModeSetgid
+	_
+	ModeSticky
 )
 
-// ModeFromOS converts an os.FileMode to a FileMode.
+// ModeFromOS converts an os.FileMode to a FileMode. As 9P2000.u only
+// has a single device type, os.ModeCharDevice is converted to
+// ModeDevice. Whether a device is a character or a block device is
+// instead stored in the Extension field of a Stat.
 func ModeFromOS(m os.FileMode) FileMode {
 	r := FileMode(m.Perm())
 
@@ -58,7 +69,7 @@ func ModeFromOS(m os.FileMode) FileMode {
 	if m&os.ModeSymlink != 0 {
 		r |= ModeSymlink
 	}
-	if m&os.ModeDevice != 0 {
+	if m&(os.ModeDevice|os.ModeCharDevice) != 0 {
 		r |= ModeDevice
 	}
 	if m&os.ModeNamedPipe != 0 {
@@ -73,6 +84,9 @@ func ModeFromOS(m os.FileMode) FileMode {
 	if m&os.ModeSetgid != 0 {
 		r |= ModeSetgid
 	}
+	if m&os.ModeSticky != 0 {
+		r |= ModeSticky
+	}
 
 	return r
 }
@@ -111,6 +125,9 @@ func (m FileMode) OS() os.FileMode {
 	if m&ModeSetgid != 0 {
 		r |= os.ModeSetgid
 	}
+	if m&ModeSticky != 0 {
+		r |= os.ModeSticky
+	}
 
 	return r
 }
@@ -135,7 +152,7 @@ func (m FileMode) Perm() FileMode {
 func (m FileMode) String() string {
 	buf := []byte("----------")
 
-	const types = "dalMATL!DpSug"
+	const types = "dalMATLHD!pSug"
 	for i := range types {
 		if m&(1<<uint(31-i)) != 0 {
 			buf[0] = types[i]
@@ -153,6 +170,10 @@ func (m FileMode) String() string {
 }
 
 // Stat is a stat value.
+//
+// The Extension, NUID, NGID, and NMUID fields are only transmitted
+// when using 9P2000.u. When decoding a 9P2000 stat, the numeric IDs
+// are set to NoUID.
 type Stat struct {
 	Type   uint16
 	Dev    uint32
@@ -165,6 +186,11 @@ type Stat struct {
 	UID    string
 	GID    string
 	MUID   string
+
+	Extension string
+	NUID      uint32
+	NGID      uint32
+	NMUID     uint32
 }
 
 // DirEntry returns a DirEntry that corresponds to the Stat.
@@ -179,16 +205,29 @@ func (s Stat) DirEntry() DirEntry {
 		GID:       s.GID,
 		MUID:      s.MUID,
 
+		Extension: s.Extension,
+		NUID:      s.NUID,
+		NGID:      s.NGID,
+		NMUID:     s.NMUID,
+
 		Path:    s.QID.Path,
 		Version: s.QID.Version,
 	}
 }
 
-func (s Stat) size() uint16 {
-	return uint16(47 + len(s.Name) + len(s.UID) + len(s.GID) + len(s.MUID))
+func (s Stat) size(dotu bool) uint16 {
+	size := 47 + len(s.Name) + len(s.UID) + len(s.GID) + len(s.MUID)
+	if dotu {
+		size += 2 + len(s.Extension) + 12
+	}
+	return uint16(size)
+}
+
+func (s Stat) P9Encode() ([]byte, error) {
+	return s.encode(false)
 }
 
-func (s Stat) P9Encode() (r []byte, err error) {
+func (s Stat) encode(dotu bool) (r []byte, err error) {
 	var buf bytes.Buffer
 	write := func(v any) {
 		if err != nil {
@@ -198,7 +237,7 @@ func (s Stat) P9Encode() (r []byte, err error) {
 		err = proto.Write(&buf, v)
 	}
 
-	write(s.size())
+	write(s.size(dotu))
 	write(s.Type)
 	write(s.Dev)
 	write(s.QID)
@@ -211,10 +250,21 @@ func (s Stat) P9Encode() (r []byte, err error) {
 	write(s.GID)
 	write(s.MUID)
 
+	if dotu {
+		write(s.Extension)
+		write(s.NUID)
+		write(s.NGID)
+		write(s.NMUID)
+	}
+
 	return buf.Bytes(), err
 }
 
-func (s *Stat) P9Decode(r io.Reader) (err error) {
+func (s *Stat) P9Decode(r io.Reader) error {
+	return s.decode(r, false)
+}
+
+func (s *Stat) decode(r io.Reader, dotu bool) (err error) {
 	var size uint16
 	err = proto.Read(r, &size)
 	if err != nil {
@@ -247,9 +297,32 @@ func (s *Stat) P9Decode(r io.Reader) (err error) {
 	read(&s.GID)
 	read(&s.MUID)
 
+	if !dotu {
+		s.NUID, s.NGID, s.NMUID = NoUID, NoUID, NoUID
+		return err
+	}
+
+	read(&s.Extension)
+	read(&s.NUID)
+	read(&s.NGID)
+	read(&s.NMUID)
+
 	return err
 }
 
+// statDotU wraps a Stat so that it is encoded in the 9P2000.u format.
+type statDotU struct {
+	*Stat
+}
+
+func (s statDotU) P9Encode() ([]byte, error) {
+	return s.encode(true)
+}
+
+func (s statDotU) P9Decode(r io.Reader) error {
+	return s.decode(r, true)
+}
+
 // DirEntry is a smaller version of Stat that eliminates unnecessary
 // or duplicate fields.
 type DirEntry struct {
@@ -262,6 +335,15 @@ type DirEntry struct {
 	GID       string
 	MUID      string
 
+	// Extension, NUID, NGID, and NMUID are only used with 9P2000.u.
+	// Extension holds extra information about special files, such as
+	// the target of a symlink. Numeric IDs that are not known should
+	// be set to NoUID.
+	Extension string
+	NUID      uint32
+	NGID      uint32
+	NMUID     uint32
+
 	Path    uint64
 	Version uint32
 }
@@ -283,6 +365,11 @@ func (d DirEntry) Stat() Stat {
 		UID:    d.UID,
 		GID:    d.GID,
 		MUID:   d.MUID,
+
+		Extension: d.Extension,
+		NUID:      d.NUID,
+		NGID:      d.NGID,
+		NMUID:     d.NMUID,
 	}
 }
 
@@ -322,11 +409,18 @@ func (c StatChanges) Mode() (FileMode, bool) {
 }
 
 func (c StatChanges) ATime() (time.Time, bool) {
-	return c.DirEntry.ATime, c.DirEntry.ATime.Unix() != -1
+	return c.DirEntry.ATime, !unsetTime(c.DirEntry.ATime)
 }
 
 func (c StatChanges) MTime() (time.Time, bool) {
-	return c.DirEntry.MTime, c.DirEntry.MTime.Unix() != -1
+	return c.DirEntry.MTime, !unsetTime(c.DirEntry.MTime)
+}
+
+// unsetTime reports whether t is one of the "don't touch" values. On
+// the wire this is the maximum uint32, but -1 is accepted as well.
+func unsetTime(t time.Time) bool {
+	u := t.Unix()
+	return (u == -1) || (u == math.MaxUint32)
 }
 
 func (c StatChanges) Length() (uint64, bool) {
@@ -348,3 +442,11 @@ func (c StatChanges) GID() (string, bool) {
 func (c StatChanges) MUID() (string, bool) {
 	return c.DirEntry.MUID, c.DirEntry.MUID != ""
 }
+
+func (c StatChanges) NUID() (uint32, bool) {
+	return c.DirEntry.NUID, c.DirEntry.NUID != NoUID
+}
+
+func (c StatChanges) NGID() (uint32, bool) {
+	return c.DirEntry.NGID, c.DirEntry.NGID != NoUID
+}
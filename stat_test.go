@@ -0,0 +1,37 @@
+package p9_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/DeedleFake/p9"
+)
+
+func TestModeFromOS(t *testing.T) {
+	tests := []struct {
+		os   os.FileMode
+		mode p9.FileMode
+		back os.FileMode
+	}{
+		{0644, 0644, 0644},
+		{os.ModeDir | 0755, p9.ModeDir | 0755, os.ModeDir | 0755},
+		{os.ModeSymlink | 0777, p9.ModeSymlink | 0777, os.ModeSymlink | 0777},
+		{os.ModeNamedPipe | 0600, p9.ModeNamedPipe | 0600, os.ModeNamedPipe | 0600},
+		{os.ModeSocket | 0600, p9.ModeSocket | 0600, os.ModeSocket | 0600},
+		{os.ModeDevice | 0660, p9.ModeDevice | 0660, os.ModeDevice | 0660},
+		{os.ModeDevice | os.ModeCharDevice | 0660, p9.ModeDevice | 0660, os.ModeDevice | 0660},
+		{os.ModeCharDevice | 0660, p9.ModeDevice | 0660, os.ModeDevice | 0660},
+		{os.ModeSetuid | os.ModeSetgid | 0755, p9.ModeSetuid | p9.ModeSetgid | 0755, os.ModeSetuid | os.ModeSetgid | 0755},
+		{os.ModeDir | os.ModeSticky | 0777, p9.ModeDir | p9.ModeSticky | 0777, os.ModeDir | os.ModeSticky | 0777},
+	}
+
+	for _, test := range tests {
+		mode := p9.ModeFromOS(test.os)
+		if mode != test.mode {
+			t.Errorf("ModeFromOS(%v) = %#x, expected %#x", test.os, uint32(mode), uint32(test.mode))
+		}
+		if back := mode.OS(); back != test.back {
+			t.Errorf("%#x.OS() = %v, expected %v", uint32(mode), back, test.back)
+		}
+	}
+}
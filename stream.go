@@ -0,0 +1,226 @@
+package p9
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+)
+
+// Stream is a Node that serves a stream of messages, such as events,
+// to any number of readers. Each open of the file gets its own cursor
+// into the stream, receiving every message published after it was
+// opened, in order. Offsets given to reads are ignored.
+//
+// A read returns at most one message, blocking until one is
+// available. If a message doesn't fit into a single read, the rest of
+// it is returned by the following reads. A blocked read is
+// interrupted if the client flushes it or clunks the file. Once the
+// stream has been closed, reads return any remaining messages and then
+// io.EOF.
+//
+// A Stream can be added to a Mux using Handle, or its Open method can
+// be called from a custom Attachment's Open method.
+//
+// The zero value of Stream is ready for use. A Stream must not be
+// copied after first use. It is safe for concurrent use.
+type Stream struct {
+	// Perm holds the permission bits of the file. If it is zero, the
+	// file is readable by everyone. A Stream can never be written to,
+	// regardless of its permissions.
+	Perm FileMode
+
+	// Limit is the maximum number of unread messages that are kept for
+	// each open of the file. If a reader falls further behind than
+	// this, the oldest messages are discarded. If Limit is zero, there
+	// is no limit.
+	Limit int
+
+	m      sync.Mutex
+	files  map[*streamFile]struct{}
+	closed bool
+}
+
+// StreamFrom returns a Stream that publishes every message received
+// from ch. The Stream is closed when ch is closed.
+func StreamFrom(ch <-chan []byte) *Stream {
+	s := new(Stream)
+	go func() {
+		for data := range ch {
+			s.Publish(data)
+		}
+		s.Close()
+	}()
+	return s
+}
+
+// Mode returns the mode of the file.
+func (s *Stream) Mode() FileMode {
+	if s.Perm != 0 {
+		return s.Perm
+	}
+	return 0444
+}
+
+// Publish sends a copy of data to every current open of the file.
+// Empty messages and messages published after the Stream is closed
+// are ignored.
+func (s *Stream) Publish(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	data = append([]byte(nil), data...)
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for file := range s.files {
+		file.push(data, s.Limit)
+	}
+}
+
+// Close closes the stream. Reads from files that are already open
+// return io.EOF once they have read every remaining message, and
+// opening the file afterwards yields a file that is immediately at
+// io.EOF.
+func (s *Stream) Close() {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.closed = true
+	for file := range s.files {
+		file.end()
+	}
+	s.files = nil
+}
+
+// Open implements Node.Open.
+func (s *Stream) Open(mode uint8) (File, error) {
+	if mode&3 != OREAD {
+		return nil, fs.ErrPermission
+	}
+
+	file := &streamFile{
+		s:    s,
+		wait: make(chan struct{}),
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.closed {
+		file.end()
+		return file, nil
+	}
+
+	if s.files == nil {
+		s.files = make(map[*streamFile]struct{})
+	}
+	s.files[file] = struct{}{}
+
+	return file, nil
+}
+
+// streamFile is an open Stream.
+type streamFile struct {
+	s *Stream
+
+	m     sync.Mutex
+	queue [][]byte
+	done  bool
+
+	// wait is closed and replaced whenever the state of the file
+	// changes in order to wake up blocked readers.
+	wait chan struct{}
+}
+
+// push adds data to the end of the file's queue, discarding the oldest
+// messages if there are more than limit.
+func (f *streamFile) push(data []byte, limit int) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.queue = append(f.queue, data)
+	if (limit > 0) && (len(f.queue) > limit) {
+		f.queue = f.queue[len(f.queue)-limit:]
+	}
+	f.wake()
+}
+
+// end marks the end of the stream for the file.
+func (f *streamFile) end() {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.done = true
+	f.wake()
+}
+
+// wake wakes up all blocked readers. f.m must be held.
+func (f *streamFile) wake() {
+	close(f.wait)
+	f.wait = make(chan struct{})
+}
+
+func (f *streamFile) ReadAt(buf []byte, off int64) (int, error) {
+	return f.ReadAtContext(context.Background(), buf, off)
+}
+
+func (f *streamFile) ReadAtContext(ctx context.Context, buf []byte, off int64) (int, error) {
+	for {
+		f.m.Lock()
+		if len(f.queue) > 0 {
+			n := copy(buf, f.queue[0])
+			f.queue[0] = f.queue[0][n:]
+			if len(f.queue[0]) == 0 {
+				f.queue[0] = nil
+				f.queue = f.queue[1:]
+			}
+			f.m.Unlock()
+			return n, nil
+		}
+		if f.done {
+			f.m.Unlock()
+			return 0, io.EOF
+		}
+		wait := f.wait
+		f.m.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+func (f *streamFile) WriteAt(data []byte, off int64) (int, error) {
+	return 0, fs.ErrPermission
+}
+
+func (f *streamFile) WriteAtContext(ctx context.Context, data []byte, off int64) (int, error) {
+	return f.WriteAt(data, off)
+}
+
+func (f *streamFile) Close() error {
+	f.s.m.Lock()
+	delete(f.s.files, f)
+	f.s.m.Unlock()
+
+	f.end()
+	return nil
+}
+
+func (f *streamFile) Readdir() ([]DirEntry, error) {
+	return nil, errors.New("not a directory")
+}
+
+func (f *streamFile) ReaddirContext(ctx context.Context) ([]DirEntry, error) {
+	return f.Readdir()
+}
+
+var (
+	_ Node        = (*Stream)(nil)
+	_ FileContext = (*streamFile)(nil)
+)
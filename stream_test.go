@@ -0,0 +1,113 @@
+package p9_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/DeedleFake/p9"
+	"github.com/DeedleFake/p9/proto"
+)
+
+func TestStream(t *testing.T) {
+	events := make(chan []byte)
+	stream := p9.StreamFrom(events)
+
+	var mux p9.Mux
+	mux.Handle("events", stream)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go proto.Serve(lis, p9.Proto(), p9.FSConnHandler(&mux, 4096))
+
+	c, err := p9.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err = c.Handshake(4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := c.Attach(nil, "test", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	open := func() *p9.Remote {
+		t.Helper()
+
+		file, err := root.Open("events", p9.OREAD)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	read := func(file *p9.Remote, size int, expected string) {
+		t.Helper()
+
+		buf := make([]byte, size)
+		n, err := file.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != expected {
+			t.Errorf("Expected %q but got %q", expected, buf[:n])
+		}
+	}
+
+	f1 := open()
+	defer f1.Close()
+	f2 := open()
+
+	events <- []byte("one")
+	events <- []byte("two")
+
+	read(f1, 10, "one")
+	read(f2, 10, "one")
+	read(f1, 2, "tw")
+	read(f1, 10, "o")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	_, err = f1.ReadAtContext(ctx, make([]byte, 10), 0)
+	cancel()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded but got %v", err)
+	}
+
+	read(f2, 10, "two")
+	errc := make(chan error, 1)
+	go func() {
+		_, err := f2.Read(make([]byte, 10))
+		errc <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	err = f2.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("Read from clunked file succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Read was not unblocked by clunk")
+	}
+
+	f3 := open()
+	defer f3.Close()
+	close(events)
+	_, err = f3.Read(make([]byte, 10))
+	if err != io.EOF {
+		t.Errorf("Expected io.EOF but got %v", err)
+	}
+}